@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stringsFlag is a repeatable flag that also accepts comma separated values.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, splitList(value)...)
+	return nil
+}
+
+// envOr returns the value of the environment variable key, or def when it is
+// unset or empty.
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+
+	return def
+}
+
+// envValues parses typed environment variables, collecting the invalid
+// ones so that startup fails instead of falling back to the defaults.
+type envValues struct {
+	errs []error
+}
+
+// invalid records the invalid value of key.
+func (e *envValues) invalid(key, kind, value string) {
+	e.errs = append(e.errs, fmt.Errorf("invalid %s value %q for environment variable %s", kind, value, key))
+}
+
+// bool returns the boolean in the environment variable key, as accepted by
+// strconv.ParseBool, or def when it is unset.
+func (e *envValues) bool(key string, def bool) bool {
+	v := envOr(key, "")
+	if v == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.invalid(key, "boolean", v)
+		return def
+	}
+
+	return b
+}
+
+// duration returns the duration in the environment variable key, or def
+// when it is unset.
+func (e *envValues) duration(key string, def time.Duration) time.Duration {
+	v := envOr(key, "")
+	if v == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.invalid(key, "duration", v)
+		return def
+	}
+
+	return d
+}
+
+// float returns the number in the environment variable key, or def when it
+// is unset.
+func (e *envValues) float(key string, def float64) float64 {
+	v := envOr(key, "")
+	if v == "" {
+		return def
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.invalid(key, "float", v)
+		return def
+	}
+
+	return f
+}
+
+// err reports every invalid value.
+func (e *envValues) err() error {
+	return errors.Join(e.errs...)
+}
+
+// envList returns the comma separated values of the environment variable key,
+// or def when it is unset or empty.
+func envList(key string, def ...string) stringsFlag {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return splitList(v)
+	}
+
+	return def
+}
+
+func splitList(value string) []string {
+	parts := strings.Split(value, ",")
+	list := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+
+	return list
+}
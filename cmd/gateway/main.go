@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/anhnmt/gprc-dynamic-proto/gateway/config"
+)
+
+func init() {
+	// UNIX Time is faster and smaller than most timestamps
+	consoleWriter := &zerolog.ConsoleWriter{
+		Out:        os.Stdout,
+		TimeFormat: time.RFC3339,
+		NoColor:    false,
+	}
+
+	// Multi Writer
+	writer := []io.Writer{
+		consoleWriter,
+	}
+
+	// Caller Marshal Function
+	zerolog.CallerMarshalFunc = func(_ uintptr, file string, line int) string {
+		return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+
+	l := zerolog.
+		New(zerolog.MultiLevelWriter(writer...)).
+		With().
+		Timestamp().
+		Caller().
+		Logger()
+
+	log.Logger = l
+	zerolog.DefaultContextLogger = &l
+}
+
+const usage = `Usage: gateway <command> [flags]
+
+Commands:
+  serve     Load a schema and serve the gateway
+  validate  Check the configuration without serving
+  help      Show this help
+
+Run "gateway <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "serve":
+		err = serve(args)
+	case "validate":
+		err = validate(args)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return
+	}
+
+	var fieldErrs config.FieldErrors
+	if errors.As(err, &fieldErrs) {
+		for _, fe := range fieldErrs {
+			log.Error().Msg(fe.Error())
+		}
+
+		log.Fatal().Msg("invalid configuration")
+	}
+
+	log.Fatal().Err(err).Msg("gateway failed")
+}
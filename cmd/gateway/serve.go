@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/anhnmt/gprc-dynamic-proto/gateway"
+	"github.com/anhnmt/gprc-dynamic-proto/gateway/config"
+)
+
+type serveFlags struct {
+	configFile     string
+	schemaSource   string
+	upstream       string
+	listen         string
+	importPaths    stringsFlag
+	protos         stringsFlag
+	descriptorSet  string
+	descriptorFmt  string
+	reflectClient  string
+	reflectTimeout time.Duration
+	drainTimeout   time.Duration
+	refresh        time.Duration
+	reflection     bool
+	tlsCertFile    string
+	tlsKeyFile     string
+	tlsClientCA    string
+	health         bool
+	openAPI        bool
+	explorer       bool
+	explorerPath   string
+	metrics        bool
+	tracing        config.Tracing
+	sampleRatio    float64
+	accessLog      string
+	errorFormat    string
+	watch          bool
+}
+
+func parseServeFlags(args []string) (*serveFlags, error) {
+	f := &serveFlags{
+		importPaths: envList("GATEWAY_IMPORT_PATH", "proto", "googleapis"),
+		protos:      envList("GATEWAY_PROTO"),
+	}
+
+	var env envValues
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.StringVar(&f.configFile, "config", envOr("GATEWAY_CONFIG", ""),
+		"YAML or JSON configuration file, replaces every other flag (env GATEWAY_CONFIG)")
+	fs.StringVar(&f.schemaSource, "schema-source", envOr("GATEWAY_SCHEMA_SOURCE", config.SourceFiles),
+		"where to load the schema from: files, compile, reflect or descriptor-set (env GATEWAY_SCHEMA_SOURCE)")
+	fs.StringVar(&f.upstream, "upstream", envOr("GATEWAY_UPSTREAM", ""),
+		"upstream gRPC server address, URL or unix:///path/to.sock, comma separated to balance over several endpoints, required without --config (env GATEWAY_UPSTREAM)")
+	fs.StringVar(&f.listen, "listen", envOr("GATEWAY_LISTEN", config.DefaultListenAddress),
+		"address the gateway listens on, host:port or unix:///path/to.sock (env GATEWAY_LISTEN)")
+	fs.StringVar(&f.tlsCertFile, "tls-cert-file", envOr("GATEWAY_TLS_CERT_FILE", ""),
+		"PEM certificate terminating TLS on the listener, h2c is served when empty (env GATEWAY_TLS_CERT_FILE)")
+	fs.StringVar(&f.tlsKeyFile, "tls-key-file", envOr("GATEWAY_TLS_KEY_FILE", ""),
+		"PEM key of --tls-cert-file (env GATEWAY_TLS_KEY_FILE)")
+	fs.StringVar(&f.tlsClientCA, "tls-client-ca-file", envOr("GATEWAY_TLS_CLIENT_CA_FILE", ""),
+		"PEM bundle required to verify client certificates (env GATEWAY_TLS_CLIENT_CA_FILE)")
+	fs.Var(&f.importPaths, "import-path",
+		"directory searched for proto imports, repeatable (env GATEWAY_IMPORT_PATH, comma separated)")
+	fs.Var(&f.protos, "proto",
+		"proto file whose services are exposed, repeatable, required by the files and compile sources (env GATEWAY_PROTO, comma separated)")
+	fs.StringVar(&f.descriptorSet, "descriptor-set", envOr("GATEWAY_DESCRIPTOR_SET", ""),
+		"path of the FileDescriptorSet used by the descriptor-set source (env GATEWAY_DESCRIPTOR_SET)")
+	fs.StringVar(&f.descriptorFmt, "descriptor-set-format", envOr("GATEWAY_DESCRIPTOR_SET_FORMAT", ""),
+		"encoding of the descriptor set: binary or json, detected when empty (env GATEWAY_DESCRIPTOR_SET_FORMAT)")
+	fs.StringVar(&f.reflectClient, "reflect-client", envOr("GATEWAY_REFLECT_CLIENT", config.ReflectClientConnect),
+		"reflection client used by the reflect source: connect or grpc (env GATEWAY_REFLECT_CLIENT)")
+	fs.DurationVar(&f.reflectTimeout, "reflect-timeout", env.duration("GATEWAY_REFLECT_TIMEOUT", 10*time.Second),
+		"timeout of reflection requests (env GATEWAY_REFLECT_TIMEOUT)")
+	fs.DurationVar(&f.refresh, "refresh-interval", env.duration("GATEWAY_REFRESH_INTERVAL", 0),
+		"reload the schema periodically, only swapping it when it changed, 0 disables (env GATEWAY_REFRESH_INTERVAL)")
+	fs.DurationVar(&f.drainTimeout, "drain-timeout", env.duration("GATEWAY_DRAIN_TIMEOUT", config.DefaultDrainTimeout),
+		"how long requests in flight may complete on shutdown (env GATEWAY_DRAIN_TIMEOUT)")
+	fs.BoolVar(&f.reflection, "reflection", env.bool("GATEWAY_REFLECTION", true),
+		"serve gRPC server reflection (env GATEWAY_REFLECTION)")
+	fs.BoolVar(&f.health, "health", env.bool("GATEWAY_HEALTH", true),
+		"serve grpc.health.v1, /healthz and /readyz (env GATEWAY_HEALTH)")
+	fs.BoolVar(&f.openAPI, "openapi", env.bool("GATEWAY_OPENAPI", true),
+		"serve the OpenAPI document at /openapi.json and /openapi.yaml (env GATEWAY_OPENAPI)")
+	fs.BoolVar(&f.explorer, "explorer", env.bool("GATEWAY_EXPLORER", true),
+		"serve the API explorer, along with the OpenAPI document (env GATEWAY_EXPLORER)")
+	fs.StringVar(&f.explorerPath, "explorer-path", envOr("GATEWAY_EXPLORER_PATH", gateway.DefaultExplorerPath),
+		"path of the API explorer (env GATEWAY_EXPLORER_PATH)")
+	fs.BoolVar(&f.metrics, "metrics", env.bool("GATEWAY_METRICS", true),
+		"serve Prometheus metrics at /metrics (env GATEWAY_METRICS)")
+	fs.StringVar(&f.accessLog, "access-log", envOr("GATEWAY_ACCESS_LOG", ""),
+		"log every request to stdout in json or console format, disabled when empty (env GATEWAY_ACCESS_LOG)")
+	fs.StringVar(&f.errorFormat, "error-format", envOr("GATEWAY_ERROR_FORMAT", ""),
+		"render REST errors as status, problem or google, left as transcoded when empty (env GATEWAY_ERROR_FORMAT)")
+	fs.StringVar(&f.tracing.Exporter, "tracing-exporter", envOr("GATEWAY_TRACING_EXPORTER", ""),
+		"export OpenTelemetry traces with otlp, otlp-http, stdout or file, disabled when empty (env GATEWAY_TRACING_EXPORTER)")
+	fs.StringVar(&f.tracing.Endpoint, "tracing-endpoint", envOr("GATEWAY_TRACING_ENDPOINT", ""),
+		"OTLP collector, host:port or URL, OTEL_EXPORTER_OTLP_ENDPOINT applies when empty (env GATEWAY_TRACING_ENDPOINT)")
+	fs.BoolVar(&f.tracing.Insecure, "tracing-insecure", env.bool("GATEWAY_TRACING_INSECURE", false),
+		"disable TLS towards the OTLP collector (env GATEWAY_TRACING_INSECURE)")
+	fs.StringVar(&f.tracing.File, "tracing-file", envOr("GATEWAY_TRACING_FILE", ""),
+		"file the file exporter appends spans to (env GATEWAY_TRACING_FILE)")
+	fs.Float64Var(&f.sampleRatio, "tracing-sample-ratio", env.float("GATEWAY_TRACING_SAMPLE_RATIO", 1),
+		"ratio of the traces started by the gateway that are sampled (env GATEWAY_TRACING_SAMPLE_RATIO)")
+	fs.BoolVar(&f.watch, "watch", env.bool("GATEWAY_WATCH", false),
+		"reload the schema when a proto file below the import paths changes (env GATEWAY_WATCH)")
+
+	if err := env.err(); err != nil {
+		return nil, err
+	}
+
+	// Values given on the command line replace the defaults instead of
+	// being appended to them.
+	importPaths, protos := f.importPaths, f.protos
+	f.importPaths, f.protos = nil, nil
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if len(f.importPaths) == 0 {
+		f.importPaths = importPaths
+	}
+
+	if len(f.protos) == 0 {
+		f.protos = protos
+	}
+
+	return f, nil
+}
+
+// loadConfig reads the configuration file, or builds the equivalent
+// configuration from the flags when none is given.
+func (f *serveFlags) loadConfig() (*config.Config, error) {
+	if f.configFile != "" {
+		return config.Load(f.configFile)
+	}
+
+	if f.upstream == "" {
+		return nil, errors.New("no upstream given, set --upstream or GATEWAY_UPSTREAM")
+	}
+
+	if len(f.protos) == 0 && (f.schemaSource == config.SourceFiles || f.schemaSource == config.SourceCompile) {
+		return nil, fmt.Errorf("no proto file given for the %s schema source, set --proto or GATEWAY_PROTO", f.schemaSource)
+	}
+
+	schema := &config.Schema{
+		Source:              f.schemaSource,
+		ImportPaths:         f.importPaths,
+		Protos:              f.protos,
+		DescriptorSet:       f.descriptorSet,
+		DescriptorSetFormat: f.descriptorFmt,
+		Watch:               f.watch,
+		RefreshInterval:     f.refresh,
+	}
+
+	if f.schemaSource == config.SourceReflect {
+		schema.ReflectClient = f.reflectClient
+		schema.Timeout = f.reflectTimeout
+	}
+
+	listener := &config.Listener{
+		Address: f.listen,
+	}
+
+	if f.tlsCertFile != "" || f.tlsKeyFile != "" || f.tlsClientCA != "" {
+		listener.TLS = &config.ListenerTLS{
+			CertFile:     f.tlsCertFile,
+			KeyFile:      f.tlsKeyFile,
+			ClientCAFile: f.tlsClientCA,
+		}
+	}
+
+	// The explorer renders the OpenAPI document, disabling the document
+	// disables it too.
+	explorer := f.explorer && f.openAPI
+
+	cfg := &config.Config{
+		Listeners: []*config.Listener{listener},
+		Schema:    schema,
+		Upstreams: map[string]*config.Upstream{
+			"default": {Addresses: splitList(f.upstream)},
+		},
+		DrainTimeout: f.drainTimeout,
+		Reflection:   &f.reflection,
+		Health:       &f.health,
+		OpenAPI:      &f.openAPI,
+		Explorer:     &explorer,
+		ExplorerPath: f.explorerPath,
+		Metrics:      &f.metrics,
+		ErrorFormat:  f.errorFormat,
+	}
+
+	if f.accessLog != "" {
+		m := &config.Middleware{Name: "access_log"}
+		if err := m.Options.Encode(map[string]string{"format": f.accessLog}); err != nil {
+			return nil, err
+		}
+
+		cfg.Middleware = append(cfg.Middleware, m)
+	}
+
+	if f.tracing.Exporter != "" {
+		cfg.Tracing = &f.tracing
+		cfg.Tracing.SampleRatio = &f.sampleRatio
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func serve(args []string) error {
+	f, err := parseServeFlags(args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := f.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// The first signal drains the gateway, a second one kills it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tp, err := cfg.NewTracerProvider(ctx)
+	if err != nil {
+		return err
+	}
+
+	var gwOpts []gateway.Option
+	if tp != nil {
+		defer flushTraces(tp)
+
+		gwOpts = append(gwOpts, gateway.WithTracerProvider(tp))
+	}
+
+	gw, err := cfg.NewGateway(ctx, gwOpts...)
+	if err != nil {
+		return fmt.Errorf("could not create gateway: %w", err)
+	}
+
+	servers, err := cfg.NewServers(gw)
+	if err != nil {
+		return err
+	}
+
+	errCh := make(chan error, len(servers)+3)
+
+	go func() {
+		errCh <- gw.CheckHealth(ctx)
+	}()
+
+	if paths := cfg.WatchPaths(); len(paths) > 0 {
+		go func() {
+			errCh <- gw.Watch(ctx, paths...)
+		}()
+	}
+
+	if interval := cfg.RefreshInterval(); interval > 0 {
+		go func() {
+			errCh <- gw.Refresh(ctx, interval)
+		}()
+	}
+
+	for _, srv := range servers {
+		log.Info().
+			Strs("schemaSources", cfg.SourceNames()).
+			Strs("services", gw.Schema().ServiceNames()).
+			Bool("tls", srv.TLSConfig != nil).
+			Msgf("Starting server on %s", srv.Addr)
+
+		var ln net.Listener
+		if ln, err = gateway.Listen(srv.Addr); err != nil {
+			// The servers already started are shut down below.
+			err = fmt.Errorf("could not listen on %s: %w", srv.Addr, err)
+			break
+		}
+
+		go func(srv *http.Server, ln net.Listener) {
+			if srv.TLSConfig != nil {
+				errCh <- srv.ServeTLS(ln, "", "")
+				return
+			}
+
+			errCh <- srv.Serve(ln)
+		}(srv, ln)
+	}
+
+	// run the servers until one of them fails or a signal is received
+	if err == nil {
+		select {
+		case err = <-errCh:
+			log.Error().Err(err).Msg("server failed, shutting down")
+		case <-ctx.Done():
+			log.Info().Stringer("drainTimeout", cfg.DrainTimeout).Msg("shutting down")
+		}
+	}
+
+	stop()
+	shutdown(gw, servers, cfg.DrainTimeout)
+
+	return err
+}
+
+// shutdown stops the servers from accepting connections, sends GOAWAY to the
+// HTTP/2 clients and waits for the requests in flight up to timeout.
+func shutdown(gw *gateway.Gateway, servers []*http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+
+			if err := srv.Shutdown(ctx); err != nil {
+				_ = srv.Close()
+			}
+		}(srv)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		_ = gw.Shutdown(ctx)
+	}()
+
+	wg.Wait()
+	log.Info().Msg("gateway stopped")
+}
+
+// flushTraceTimeout bounds the export of the spans pending on exit.
+const flushTraceTimeout = 5 * time.Second
+
+// flushTraces exports the pending spans and stops the tracer provider.
+func flushTraces(tp *sdktrace.TracerProvider) {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTraceTimeout)
+	defer cancel()
+
+	if err := tp.Shutdown(ctx); err != nil {
+		log.Warn().Err(err).Msg("could not flush traces")
+	}
+}
+
+func validate(args []string) error {
+	f, err := parseServeFlags(args)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.loadConfig(); err != nil {
+		return err
+	}
+
+	log.Info().Msg("configuration is valid")
+
+	return nil
+}
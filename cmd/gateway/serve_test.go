@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets the GATEWAY_* environment variables.
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	for _, kv := range os.Environ() {
+		if key, _, _ := strings.Cut(kv, "="); strings.HasPrefix(key, "GATEWAY_") {
+			t.Setenv(key, "")
+		}
+	}
+}
+
+func TestLoadConfigRequiresUpstreamAndProto(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "no upstream",
+			args: []string{"--proto", "user/v1/user.proto"},
+			err:  "no upstream given",
+		},
+		{
+			name: "no proto",
+			args: []string{"--upstream", "localhost:8080"},
+			err:  "no proto file given for the files schema source",
+		},
+		{
+			name: "no proto to compile",
+			args: []string{"--upstream", "localhost:8080", "--schema-source", "compile"},
+			err:  "no proto file given for the compile schema source",
+		},
+		{
+			name: "reflect",
+			args: []string{"--upstream", "localhost:8080", "--schema-source", "reflect"},
+		},
+		{
+			name: "files",
+			args: []string{"--upstream", "localhost:8080", "--proto", "user/v1/user.proto"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+
+			f, err := parseServeFlags(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = f.loadConfig()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("loadConfig failed: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("loadConfig = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseServeFlagsEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("GATEWAY_UPSTREAM", "users-0:8080, users-1:8080")
+	t.Setenv("GATEWAY_SCHEMA_SOURCE", "reflect")
+	t.Setenv("GATEWAY_REFLECT_TIMEOUT", "3s")
+	t.Setenv("GATEWAY_IMPORT_PATH", "a,b")
+
+	f, err := parseServeFlags([]string{"--import-path", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags replace the values of the environment.
+	if !slices.Equal(f.importPaths, []string{"c"}) {
+		t.Errorf("import paths = %v", f.importPaths)
+	}
+
+	cfg, err := f.loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Schema.Timeout != 3*time.Second {
+		t.Errorf("reflect timeout = %v", cfg.Schema.Timeout)
+	}
+
+	if got := cfg.Upstreams["default"].Addresses; !slices.Equal(got, []string{"users-0:8080", "users-1:8080"}) {
+		t.Errorf("upstream addresses = %v", got)
+	}
+}
+
+func TestParseServeFlagsEnvValues(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("GATEWAY_REFLECTION", "0")
+	t.Setenv("GATEWAY_HEALTH", "TRUE")
+	t.Setenv("GATEWAY_TRACING_INSECURE", "1")
+	t.Setenv("GATEWAY_DRAIN_TIMEOUT", "1m30s")
+	t.Setenv("GATEWAY_TRACING_SAMPLE_RATIO", "0.25")
+
+	f, err := parseServeFlags(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.reflection || !f.health || !f.tracing.Insecure || f.drainTimeout != 90*time.Second || f.sampleRatio != 0.25 {
+		t.Errorf("flags = %+v", f)
+	}
+
+	// Invalid values fail instead of falling back to the defaults.
+	t.Setenv("GATEWAY_REFLECTION", "yes")
+	t.Setenv("GATEWAY_TRACING_INSECURE", "ture")
+	t.Setenv("GATEWAY_DRAIN_TIMEOUT", "30")
+	t.Setenv("GATEWAY_TRACING_SAMPLE_RATIO", "half")
+
+	_, err = parseServeFlags(nil)
+	if err == nil {
+		t.Fatal("invalid environment accepted")
+	}
+
+	for _, want := range []string{
+		`invalid boolean value "yes" for environment variable GATEWAY_REFLECTION`,
+		`invalid boolean value "ture" for environment variable GATEWAY_TRACING_INSECURE`,
+		`invalid duration value "30" for environment variable GATEWAY_DRAIN_TIMEOUT`,
+		`invalid float value "half" for environment variable GATEWAY_TRACING_SAMPLE_RATIO`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	return addr
+}
+
+func TestServeClosesListenersOnListenError(t *testing.T) {
+	clearEnv(t)
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	first := freeAddr(t)
+	conf := filepath.Join(t.TempDir(), "gateway.yaml")
+	data := `
+listeners:
+  - address: ` + first + `
+  - address: ` + busy.Addr().String() + `
+schema:
+  source: files
+  import_paths: [../../proto, ../../googleapis]
+  protos: [user/v1/user.proto]
+upstreams:
+  users:
+    address: ` + freeAddr(t) + `
+drain_timeout: 1s
+`
+	if err = os.WriteFile(conf, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serve([]string{"--config", conf})
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("serve still running after a listener failed")
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "could not listen on "+busy.Addr().String()) {
+		t.Fatalf("serve = %v", err)
+	}
+
+	// The listener started before the failure was closed.
+	ln, err := net.Listen("tcp", first)
+	if err != nil {
+		t.Fatalf("first listener still open: %v", err)
+	}
+
+	_ = ln.Close()
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// AccessLog returns a middleware logging one line per request once it
+// completed. Calls matched to a method are logged with the method, the route
+// template of REST calls and the gRPC status code, along with the inbound
+// protocol, HTTP status, durations, peer address and the ID assigned by
+// RequestID, whatever the order of the middleware. The messages of the calls
+// are logged too when payloads is not nil.
+func AccessLog(logger zerolog.Logger, payloads *PayloadLog) Middleware {
+	var payloadLogger *payloadLogger
+	if payloads != nil {
+		payloadLogger = newPayloadLogger(*payloads)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, ok := callFromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			c.payloadLogger = payloadLogger
+
+			// The recorder is shared with metrics and tracing when enabled.
+			if c.recorder == nil {
+				c.recorder = &responseRecorder{ResponseWriter: w}
+				w = c.recorder
+			}
+
+			// Deferred to log the calls the proxy aborts with a panic.
+			defer c.logAccess(logger, r)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// logAccess logs the completed call. r is the request as received by the
+// gateway.
+func (c *call) logAccess(logger zerolog.Logger, r *http.Request) {
+	status := c.recorder.status
+	if status == 0 {
+		// Nothing was written, the server answers 200.
+		status = http.StatusOK
+	}
+
+	e := logger.Info().
+		Str("protocol", c.protocol).
+		Str("http_method", c.httpMethod).
+		Str("path", c.path)
+
+	if c.method != nil {
+		e = e.Str("method", string(c.method.Parent().FullName())+"/"+string(c.method.Name()))
+		if route := c.route(); route != "" {
+			e = e.Str("route", route)
+		}
+
+		e = e.Str("code", c.recorder.code(c.protocol, r.Context().Err() != nil).String()).
+			Dur("upstream_duration", c.upstreamDuration)
+
+		if c.payloads != nil {
+			e = c.payloads.log(e, c.method)
+		}
+	}
+
+	e = e.Int("status", status).
+		Int64("bytes", c.recorder.written).
+		Dur("duration", time.Since(c.start)).
+		Str("peer", r.RemoteAddr)
+
+	if c.requestID != "" {
+		e = e.Str("request_id", c.requestID)
+	}
+
+	e.Msg("request served")
+}
+
+// route returns the path template the call was routed with: the matching
+// google.api.http rule for REST calls, the procedure path otherwise.
+func (c *call) route() string {
+	if c.protocol != ProtocolREST {
+		return "/" + string(c.method.Parent().FullName()) + "/" + string(c.method.Name())
+	}
+
+	route, _ := httpRoute(c.method, c.httpMethod, c.path)
+	return route
+}
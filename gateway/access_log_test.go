@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/rs/zerolog"
+
+	userv1 "github.com/anhnmt/gprc-dynamic-proto/proto/gengo/user/v1"
+	"github.com/anhnmt/gprc-dynamic-proto/proto/gengo/user/v1/userv1connect"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware func(lines lineWriter) []Middleware
+	}{
+		{
+			name: "request id first",
+			middleware: func(lines lineWriter) []Middleware {
+				return []Middleware{RequestID(""), AccessLog(zerolog.New(lines), nil)}
+			},
+		},
+		{
+			name: "access log first",
+			middleware: func(lines lineWriter) []Middleware {
+				return []Middleware{AccessLog(zerolog.New(lines), nil), RequestID("")}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make(lineWriter, 4)
+			_, addr := newUserGateway(t, WithMiddleware(tt.middleware(lines)...))
+
+			req, err := http.NewRequest(http.MethodGet, addr+"/v1/users/7", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set(DefaultRequestIDHeader, "req-1")
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			line := lines.next(t)
+			for key, want := range map[string]any{
+				"protocol":    ProtocolREST,
+				"http_method": http.MethodGet,
+				"path":        "/v1/users/7",
+				"method":      "user.v1.UserService/List",
+				"route":       "/v1/users/{page=*}",
+				"code":        "OK",
+				"status":      float64(http.StatusOK),
+				"request_id":  "req-1",
+			} {
+				if got := line[key]; got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+
+			for _, key := range []string{"bytes", "duration", "upstream_duration", "peer"} {
+				if _, ok := line[key]; !ok {
+					t.Errorf("%s not logged: %v", key, line)
+				}
+			}
+
+			// Errors are logged with their gRPC code, procedures as route.
+			client := userv1connect.NewUserServiceClient(h2cClient(), addr, connect.WithGRPC())
+			_, _ = client.List(context.Background(), connect.NewRequest(&userv1.ListRequest{Page: -1}))
+
+			line = lines.next(t)
+			if line["protocol"] != ProtocolGRPC || line["route"] != "/user.v1.UserService/List" || line["code"] != "InvalidArgument" {
+				t.Errorf("gRPC call logged as %v", line)
+			}
+
+			// Requests not matched to a method are logged without one.
+			res, err = http.Get(addr + "/v1/unknown")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			line = lines.next(t)
+			if _, ok := line["method"]; ok || line["status"] != float64(http.StatusNotFound) {
+				t.Errorf("unmatched request logged as %v", line)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := RequestID("X-Trace")(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	id := w.Header().Get("X-Trace")
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 32 || seen != id {
+		t.Errorf("generated ID %q, seen %q", id, seen)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Trace", "given")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if got := w.Header().Get("X-Trace"); got != "given" || seen != "given" {
+		t.Errorf("ID of the client replaced with %q, seen %q", got, seen)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	handler := Recover()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d", w.Code)
+	}
+}
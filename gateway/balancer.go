@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"net/http"
+	"sync/atomic"
+)
+
+// Balancer picks the endpoint of an upstream cluster serving a request.
+type Balancer interface {
+	// Pick returns one of endpoints, or nil when none can serve r. It may
+	// replace r.Body, for instance to read the request message, as long as
+	// the replacement yields the same content.
+	Pick(r *http.Request, endpoints []*Endpoint) *Endpoint
+}
+
+// RoundRobin returns a Balancer cycling through the endpoints.
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobin) Pick(_ *http.Request, endpoints []*Endpoint) *Endpoint {
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	return endpoints[(b.next.Add(1)-1)%uint64(len(endpoints))]
+}
+
+// LeastOutstanding returns a Balancer picking the endpoint with the fewest
+// requests in flight, which keeps long streams from piling up on a backend.
+// Ties are broken in round-robin order.
+func LeastOutstanding() Balancer {
+	return &leastOutstanding{}
+}
+
+type leastOutstanding struct {
+	next atomic.Uint64
+}
+
+func (b *leastOutstanding) Pick(_ *http.Request, endpoints []*Endpoint) *Endpoint {
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	start := int((b.next.Add(1) - 1) % uint64(len(endpoints)))
+
+	var picked *Endpoint
+	for i := range endpoints {
+		e := endpoints[(start+i)%len(endpoints)]
+		if picked == nil || e.Outstanding() < picked.Outstanding() {
+			picked = e
+		}
+	}
+
+	return picked
+}
+
+// HashHeader returns a Balancer sending the requests with the same value of
+// the given header, gRPC metadata included, to the same endpoint. Requests
+// without the header are balanced in round-robin order.
+func HashHeader(name string) Balancer {
+	return &hashBalancer{
+		key: func(r *http.Request) (string, bool) {
+			v := r.Header.Get(name)
+			return v, v != ""
+		},
+	}
+}
+
+// HashField returns a Balancer sending the requests whose message has the
+// same value at the given field path, such as "user.id", to the same
+// endpoint. Only the first message of server streams is considered. Client
+// and bidi streams, and requests whose message cannot be read, because it is
+// compressed or the field is not set, are balanced in round-robin order.
+func HashField(path string) Balancer {
+	return &hashBalancer{
+		key: func(r *http.Request) (string, bool) {
+			return requestField(r, path)
+		},
+	}
+}
+
+// hashBalancer implements consistent hashing with rendezvous hashing: every
+// endpoint is scored against the key and the highest score wins, so removing
+// an endpoint only moves the keys it was serving.
+type hashBalancer struct {
+	key      func(r *http.Request) (string, bool)
+	fallback roundRobin
+}
+
+func (b *hashBalancer) Pick(r *http.Request, endpoints []*Endpoint) *Endpoint {
+	key, ok := b.key(r)
+	if !ok {
+		return b.fallback.Pick(r, endpoints)
+	}
+
+	var (
+		picked *Endpoint
+		best   uint64
+	)
+
+	for _, e := range endpoints {
+		score := rendezvousScore(key, e.URL.String())
+		if picked == nil || score > best {
+			picked, best = e, score
+		}
+	}
+
+	return picked
+}
+
+func rendezvousScore(key, endpoint string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(endpoint))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+
+	// FNV alone spreads similar inputs poorly, finish with the splitmix64
+	// mixer so that scores of neighboring keys are unrelated.
+	x := binary.BigEndian.Uint64(h.Sum(nil))
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
@@ -0,0 +1,232 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// testEndpoints returns n endpoints named after their index.
+func testEndpoints(n int) []*Endpoint {
+	endpoints := make([]*Endpoint, n)
+	for i := range endpoints {
+		endpoints[i] = &Endpoint{URL: &url.URL{Scheme: "http", Host: fmt.Sprintf("backend-%d:8080", i)}}
+	}
+
+	return endpoints
+}
+
+func TestRoundRobin(t *testing.T) {
+	endpoints := testEndpoints(3)
+	b := RoundRobin()
+
+	for i := 0; i < 6; i++ {
+		if got := b.Pick(nil, endpoints); got != endpoints[i%3] {
+			t.Errorf("pick %d = %s, want %s", i, got, endpoints[i%3])
+		}
+	}
+
+	if got := b.Pick(nil, nil); got != nil {
+		t.Errorf("pick without endpoints = %s", got)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	endpoints := testEndpoints(3)
+	endpoints[0].outstanding.Store(2)
+	endpoints[1].outstanding.Store(1)
+	endpoints[2].outstanding.Store(3)
+
+	b := LeastOutstanding()
+	if got := b.Pick(nil, endpoints); got != endpoints[1] {
+		t.Errorf("pick = %s, want %s", got, endpoints[1])
+	}
+
+	// Ties are broken in round-robin order.
+	endpoints[0].outstanding.Store(1)
+
+	picked := map[*Endpoint]bool{}
+	for i := 0; i < 4; i++ {
+		picked[b.Pick(nil, endpoints)] = true
+	}
+
+	if len(picked) != 2 || picked[endpoints[2]] {
+		t.Errorf("ties picked %v", picked)
+	}
+}
+
+func TestHashHeader(t *testing.T) {
+	endpoints := testEndpoints(5)
+	b := HashHeader("X-Tenant")
+
+	request := func(tenant string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if tenant != "" {
+			r.Header.Set("X-Tenant", tenant)
+		}
+
+		return r
+	}
+
+	picked := make(map[string]*Endpoint)
+	for i := 0; i < 20; i++ {
+		tenant := fmt.Sprint("tenant-", i)
+		picked[tenant] = b.Pick(request(tenant), endpoints)
+
+		if got := b.Pick(request(tenant), endpoints); got != picked[tenant] {
+			t.Errorf("%s picked %s, then %s", tenant, picked[tenant], got)
+		}
+	}
+
+	// Removing an endpoint only moves the keys it was serving.
+	removed := endpoints[2]
+	remaining := append(append([]*Endpoint(nil), endpoints[:2]...), endpoints[3:]...)
+
+	for tenant, e := range picked {
+		if got := b.Pick(request(tenant), remaining); e != removed && got != e {
+			t.Errorf("%s moved from %s to %s", tenant, e, got)
+		}
+	}
+
+	// Requests without the header are balanced in round-robin order.
+	if first, second := b.Pick(request(""), endpoints), b.Pick(request(""), endpoints); first == second {
+		t.Errorf("requests without the header both picked %s", first)
+	}
+}
+
+// accountMethod returns a method of account.v1.AccountService.
+func accountMethod(t *testing.T, name protoreflect.Name) protoreflect.MethodDescriptor {
+	t.Helper()
+
+	schema, err := NewParserSource(writeProto(t, "account/v1/account.proto", accountProto), "account/v1/account.proto").
+		Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return schema.Services[0].Methods().ByName(name)
+}
+
+// envelope frames data as a gRPC or Connect streaming message.
+func envelope(data []byte) []byte {
+	prefix := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(data)))
+
+	return append(prefix, data...)
+}
+
+// unreadable is a request body failing the test when read.
+type unreadable struct {
+	t *testing.T
+}
+
+func (b unreadable) Read([]byte) (int, error) {
+	b.t.Error("client stream read before it was proxied")
+	return 0, io.EOF
+}
+
+func (unreadable) Close() error {
+	return nil
+}
+
+// methodRequest returns a request to md with the given body.
+func methodRequest(md protoreflect.MethodDescriptor, contentType string, body io.Reader) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, procedure(md), body)
+	r.Header.Set("Content-Type", contentType)
+
+	return r.WithContext(context.WithValue(r.Context(), methodKey{}, md))
+}
+
+func TestHashField(t *testing.T) {
+	login := accountMethod(t, "Login")
+
+	msg := dynamicpb.NewMessage(login.Input())
+	msg.Set(login.Input().Fields().ByName("user"), protoreflect.ValueOfString("alice"))
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+	}{
+		{name: "connect json", contentType: "application/json", body: []byte(`{"user":"alice"}`)},
+		{name: "connect proto", contentType: "application/proto", body: data},
+		{name: "grpc", contentType: "application/grpc", body: envelope(data)},
+		{name: "grpc-web json", contentType: "application/grpc-web+json", body: envelope([]byte(`{"user":"alice"}`))},
+	}
+
+	endpoints := testEndpoints(5)
+	b := HashField("user")
+
+	var picked *Endpoint
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if key, ok := requestField(methodRequest(login, tt.contentType, bytes.NewReader(tt.body)), "user"); key != "alice" || !ok {
+				t.Errorf("requestField = %q, %v", key, ok)
+			}
+
+			r := methodRequest(login, tt.contentType, bytes.NewReader(tt.body))
+
+			e := b.Pick(r, endpoints)
+			if picked == nil {
+				picked = e
+			} else if e != picked {
+				t.Errorf("picked %s, want %s as for the other protocols", e, picked)
+			}
+
+			// The upstream still receives the whole body.
+			body, err := io.ReadAll(r.Body)
+			if err != nil || !bytes.Equal(body, tt.body) {
+				t.Errorf("body left %q, %v", body, err)
+			}
+		})
+	}
+}
+
+func TestHashFieldFallsBack(t *testing.T) {
+	login := accountMethod(t, "Login")
+	imp := accountMethod(t, "Import")
+
+	compressed := methodRequest(login, "application/json", strings.NewReader("compressed"))
+	compressed.Header.Set("Content-Encoding", "gzip")
+
+	tests := []struct {
+		name string
+		r    *http.Request
+	}{
+		{name: "unset field", r: methodRequest(login, "application/json", strings.NewReader(`{}`))},
+		{name: "compressed", r: compressed},
+		{name: "unknown codec", r: methodRequest(login, "application/xml", strings.NewReader("<user/>"))},
+		{name: "invalid message", r: methodRequest(login, "application/json", strings.NewReader(`{"user":`))},
+		// Client streams may wait for the response headers before sending
+		// their first message, so their body is not read.
+		{name: "client stream", r: methodRequest(imp, "application/grpc", unreadable{t: t})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if key, ok := requestField(tt.r, "user"); ok {
+				t.Errorf("requestField = %q", key)
+			}
+
+			if e := HashField("user").Pick(tt.r, testEndpoints(2)); e == nil {
+				t.Error("no endpoint picked")
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/anhnmt/gprc-dynamic-proto/gateway"
+)
+
+// NewGateway loads the configured schema and builds the gateway. Extra
+// options are applied after the ones derived from the configuration.
+func (c *Config) NewGateway(ctx context.Context, opts ...gateway.Option) (*gateway.Gateway, error) {
+	upstreams, err := c.newUpstreams()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]gateway.SchemaSource, 0, len(c.Schemas))
+	for i, s := range c.Schemas {
+		source, err := c.newSchemaSource(s, upstreams)
+		if err != nil {
+			return nil, fmt.Errorf("schema %d: %w", i, err)
+		}
+
+		sources = append(sources, source)
+	}
+
+	source := sources[0]
+	if len(sources) > 1 {
+		source = gateway.NewMultiSource(gateway.Precedence(c.SchemaPrecedence), sources...)
+	}
+
+	gwOpts := []gateway.Option{
+		gateway.WithSchemaSource(source),
+	}
+
+	if c.DefaultUpstream != "" {
+		gwOpts = append(gwOpts, gateway.WithDefaultUpstream(upstreams[c.DefaultUpstream]))
+	}
+
+	for _, r := range c.Routes {
+		gwOpts = append(gwOpts, gateway.WithServiceUpstream(r.Service, upstreams[r.Upstream]))
+	}
+
+	if c.ReflectionEnabled() {
+		gwOpts = append(gwOpts, gateway.WithReflection())
+	}
+
+	if c.HealthEnabled() {
+		gwOpts = append(gwOpts, gateway.WithHealth())
+	}
+
+	if c.OpenAPIEnabled() {
+		gwOpts = append(gwOpts, gateway.WithOpenAPI())
+	}
+
+	if c.ExplorerEnabled() {
+		gwOpts = append(gwOpts, gateway.WithExplorer(c.ExplorerPath))
+	}
+
+	if c.MetricsEnabled() {
+		gwOpts = append(gwOpts, gateway.WithMetrics(nil))
+	}
+
+	if c.ErrorFormat != "" {
+		gwOpts = append(gwOpts, gateway.WithErrorFormat(gateway.ErrorFormat(c.ErrorFormat)))
+	}
+
+	for _, m := range c.Middleware {
+		mw, err := middlewareFactories[m.Name](&m.Options)
+		if err != nil {
+			return nil, fmt.Errorf("could not create middleware %q: %w", m.Name, err)
+		}
+
+		gwOpts = append(gwOpts, gateway.WithMiddleware(mw))
+	}
+
+	return gateway.New(ctx, append(gwOpts, opts...)...)
+}
+
+// NewTracerProvider returns the tracer provider exporting the configured
+// traces, nil when tracing is disabled. It must be shut down to flush the
+// pending spans.
+func (c *Config) NewTracerProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	t := c.Tracing
+	if t == nil {
+		return nil, nil
+	}
+
+	return gateway.NewTracerProvider(ctx, gateway.TraceExport{
+		Exporter:    t.Exporter,
+		Endpoint:    t.Endpoint,
+		Insecure:    t.Insecure,
+		File:        t.File,
+		SampleRatio: *t.SampleRatio,
+		ServiceName: t.ServiceName,
+	})
+}
+
+// NewServers returns one server per configured listener. Servers with a
+// TLSConfig terminate TLS and are started with ListenAndServeTLS("", "").
+func (c *Config) NewServers(gw *gateway.Gateway) ([]*http.Server, error) {
+	servers := make([]*http.Server, 0, len(c.Listeners))
+	for _, l := range c.Listeners {
+		srv := gw.NewServer(l.Address)
+		if l.TLS != nil {
+			tlsConfig, err := gateway.NewServerTLSConfig(gateway.ServerTLS{
+				CertFile:     l.TLS.CertFile,
+				KeyFile:      l.TLS.KeyFile,
+				ClientCAFile: l.TLS.ClientCAFile,
+				ClientAuth:   l.TLS.ClientAuth,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("listener %q: %w", l.Address, err)
+			}
+
+			srv = gw.NewTLSServer(l.Address, tlsConfig)
+		}
+
+		srv.ReadHeaderTimeout = l.ReadHeaderTimeout
+		srv.ReadTimeout = l.ReadTimeout
+		srv.WriteTimeout = l.WriteTimeout
+		srv.IdleTimeout = l.IdleTimeout
+
+		servers = append(servers, srv)
+	}
+
+	return servers, nil
+}
+
+func (c *Config) newUpstreams() (map[string]*gateway.Upstream, error) {
+	upstreams := make(map[string]*gateway.Upstream, len(c.Upstreams))
+	for name, u := range c.Upstreams {
+		transport, err := newUpstreamTransport(u)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %q: %w", name, err)
+		}
+
+		var endpoints []*url.URL
+		for _, address := range u.addresses() {
+			target, err := ParseAddress(address)
+			if err != nil {
+				return nil, fmt.Errorf("upstream %q: %w", name, err)
+			}
+
+			if u.Transport == TransportTLS {
+				target.Scheme = "https"
+			}
+
+			endpoints = append(endpoints, target)
+		}
+
+		var healthCheck *gateway.HealthCheck
+		if hc := u.HealthCheck; hc != nil {
+			healthCheck = &gateway.HealthCheck{
+				Interval:           hc.Interval,
+				Timeout:            hc.Timeout,
+				UnhealthyThreshold: hc.UnhealthyThreshold,
+				HealthyThreshold:   hc.HealthyThreshold,
+				EjectionTime:       hc.EjectionTime,
+			}
+		}
+
+		upstreams[name] = &gateway.Upstream{
+			Name: name,
+			// The first endpoint also serves the reflection requests of
+			// the reflect schema source.
+			Target:      endpoints[0],
+			Endpoints:   endpoints,
+			Balancer:    newBalancer(u.Balancer),
+			Transport:   transport,
+			Timeout:     u.Timeout,
+			HealthCheck: healthCheck,
+		}
+	}
+
+	return upstreams, nil
+}
+
+// newUpstreamTransport returns the HTTP/2 transport reaching an upstream.
+func newUpstreamTransport(u *Upstream) (*http2.Transport, error) {
+	if u.Transport != TransportTLS {
+		return gateway.NewH2CTransport(), nil
+	}
+
+	var clientTLS gateway.ClientTLS
+	if t := u.TLS; t != nil {
+		clientTLS = gateway.ClientTLS{
+			CAFile:     t.CAFile,
+			CertFile:   t.CertFile,
+			KeyFile:    t.KeyFile,
+			ServerName: t.ServerName,
+		}
+	}
+
+	tlsConfig, err := gateway.NewClientTLSConfig(clientTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	return gateway.NewTLSTransport(tlsConfig), nil
+}
+
+// grpcCredentials returns the credentials of the gRPC connections to an
+// upstream, matching its transport.
+func grpcCredentials(upstream *gateway.Upstream) credentials.TransportCredentials {
+	if t, ok := upstream.Transport.(*http2.Transport); ok && t.TLSClientConfig != nil {
+		return credentials.NewTLS(gateway.ClientTLSConfigForHost(t.TLSClientConfig, upstream.Target.Hostname()))
+	}
+
+	return insecure.NewCredentials()
+}
+
+// newBalancer returns the configured balancer, nil for the default one.
+func newBalancer(b *Balancer) gateway.Balancer {
+	if b == nil {
+		return nil
+	}
+
+	switch b.Policy {
+	case BalancerLeastOutstanding:
+		return gateway.LeastOutstanding()
+	case BalancerHash:
+		if b.HashHeader != "" {
+			return gateway.HashHeader(b.HashHeader)
+		}
+
+		return gateway.HashField(b.HashField)
+	default:
+		return gateway.RoundRobin()
+	}
+}
+
+// newSchemaSource builds the source of a schema, bounded by its timeout.
+func (c *Config) newSchemaSource(s *Schema, upstreams map[string]*gateway.Upstream) (gateway.SchemaSource, error) {
+	source, err := c.newBaseSchemaSource(s, upstreams)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Timeout > 0 {
+		source = &timeoutSource{
+			source:  source,
+			timeout: s.Timeout,
+		}
+	}
+
+	return source, nil
+}
+
+func (c *Config) newBaseSchemaSource(s *Schema, upstreams map[string]*gateway.Upstream) (gateway.SchemaSource, error) {
+	switch s.Source {
+	case SourceFiles:
+		return gateway.NewParserSource(s.ImportPaths, s.Protos...), nil
+	case SourceCompile:
+		return gateway.NewCompilerSource(s.ImportPaths, s.Protos...), nil
+	case SourceDescriptorSet:
+		source := gateway.NewDescriptorSetSource(s.DescriptorSet, s.Protos...)
+		source.Format = s.DescriptorSetFormat
+
+		return source, nil
+	case SourceReflect:
+		name := s.Upstream
+		if name == "" {
+			name = c.DefaultUpstream
+		}
+
+		upstream := upstreams[name]
+		if s.ReflectClient == ReflectClientGRPC {
+			// grpc-go dials unix:// targets itself.
+			target := upstream.Target.Host
+			if upstream.Target.Scheme == gateway.UnixScheme {
+				target = upstream.Target.String()
+			}
+
+			return gateway.RouteSource(gateway.DialGRPCReflectSource(
+				target,
+				grpc.WithTransportCredentials(grpcCredentials(upstream)),
+			), upstream), nil
+		}
+
+		httpClient, baseURL := upstream.NewClient()
+
+		return gateway.RouteSource(gateway.NewReflectSource(httpClient, baseURL), upstream), nil
+	default:
+		return nil, fmt.Errorf("unknown schema source %q", s.Source)
+	}
+}
+
+// timeoutSource bounds every load of a source, including reloads.
+type timeoutSource struct {
+	source  gateway.SchemaSource
+	timeout time.Duration
+}
+
+// Load implements gateway.SchemaSource.
+func (s *timeoutSource) Load(ctx context.Context) (*gateway.Schema, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.source.Load(ctx)
+}
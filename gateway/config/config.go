@@ -0,0 +1,375 @@
+// Package config loads the declarative YAML or JSON configuration of a
+// gateway and turns it into gateway options and servers.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema source types.
+const (
+	SourceFiles         = "files"
+	SourceCompile       = "compile"
+	SourceReflect       = "reflect"
+	SourceDescriptorSet = "descriptor-set"
+)
+
+// Reflection clients used by the reflect schema source.
+const (
+	ReflectClientConnect = "connect"
+	ReflectClientGRPC    = "grpc"
+)
+
+// Transports used to reach an upstream.
+const (
+	TransportH2C = "h2c"
+	TransportTLS = "tls"
+)
+
+// Load balancing policies of an upstream.
+const (
+	BalancerRoundRobin       = "round_robin"
+	BalancerLeastOutstanding = "least_outstanding"
+	BalancerHash             = "hash"
+)
+
+// DefaultListenAddress is used when no listener is configured.
+const DefaultListenAddress = ":8000"
+
+// DefaultDrainTimeout is used when no drain timeout is configured.
+const DefaultDrainTimeout = 30 * time.Second
+
+// Config is the root of a gateway configuration file.
+type Config struct {
+	// Listeners are the addresses the gateway serves on.
+	Listeners []*Listener `yaml:"listeners"`
+	// Schema describes where the served services are loaded from.
+	Schema *Schema `yaml:"schema"`
+	// Schemas merges several schema sources, it replaces Schema.
+	Schemas []*Schema `yaml:"schemas"`
+	// SchemaPrecedence decides which of Schemas serves a service found in
+	// several of them: first (default), last or error.
+	SchemaPrecedence string `yaml:"schema_precedence"`
+	// Upstreams are the backends keyed by name.
+	Upstreams map[string]*Upstream `yaml:"upstreams"`
+	// Routes send services to a specific upstream.
+	Routes []*Route `yaml:"routes"`
+	// DefaultUpstream receives services without a route. It may be omitted
+	// when a single upstream is declared.
+	DefaultUpstream string `yaml:"default_upstream"`
+	// Reflection serves gRPC server reflection, enabled by default.
+	Reflection *bool `yaml:"reflection"`
+	// Health serves grpc.health.v1.Health, /healthz and /readyz, enabled by
+	// default.
+	Health *bool `yaml:"health"`
+	// OpenAPI serves the OpenAPI document of the loaded services at
+	// /openapi.json and /openapi.yaml, enabled by default.
+	OpenAPI *bool `yaml:"openapi"`
+	// Explorer serves a web UI to browse and call the services, enabled by
+	// default along with OpenAPI, whose document it renders.
+	Explorer *bool `yaml:"explorer"`
+	// ExplorerPath is where the explorer is served,
+	// gateway.DefaultExplorerPath when empty.
+	ExplorerPath string `yaml:"explorer_path"`
+	// Metrics serves Prometheus metrics at /metrics and records them for
+	// every call, enabled by default.
+	Metrics *bool `yaml:"metrics"`
+	// Tracing exports OpenTelemetry traces of the calls when set.
+	Tracing *Tracing `yaml:"tracing"`
+	// ErrorFormat renders the errors returned to REST clients as status,
+	// problem or google. They are left as written by the transcoder when
+	// empty.
+	ErrorFormat string `yaml:"error_format"`
+	// Middleware wraps every request, the first entry being the outermost.
+	Middleware []*Middleware `yaml:"middleware"`
+	// DrainTimeout is how long requests in flight may complete on shutdown,
+	// DefaultDrainTimeout when zero.
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+}
+
+// Tracing configures the export of OpenTelemetry traces.
+type Tracing struct {
+	// Exporter is otlp, over gRPC, otlp-http, stdout or file.
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the OTLP collector, a host:port or a URL. The
+	// OTEL_EXPORTER_OTLP_* environment variables apply when empty.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure disables TLS towards the collector.
+	Insecure bool `yaml:"insecure"`
+	// File is where the file exporter appends spans.
+	File string `yaml:"file"`
+	// SampleRatio is the ratio of the traces started by the gateway that
+	// are sampled, 1 by default. Calls carrying a trace context follow its
+	// sampling decision.
+	SampleRatio *float64 `yaml:"sample_ratio"`
+	// ServiceName defaults to gateway.DefaultTraceServiceName.
+	ServiceName string `yaml:"service_name"`
+}
+
+// Listener is an address the gateway serves on.
+type Listener struct {
+	Address           string        `yaml:"address"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// TLS terminates TLS on the listener, which serves h2c otherwise.
+	TLS *ListenerTLS `yaml:"tls"`
+}
+
+// ListenerTLS configures TLS termination on a listener, which negotiates
+// HTTP/2 or HTTP/1.1 with ALPN. Certificate files are reloaded when they
+// change.
+type ListenerTLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile is a PEM bundle verifying client certificates.
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientAuth is none, optional or require, the default when
+	// client_ca_file is set.
+	ClientAuth string `yaml:"client_auth"`
+}
+
+// Schema describes a schema source.
+type Schema struct {
+	// Source is one of files, compile, reflect or descriptor-set.
+	Source string `yaml:"source"`
+	// ImportPaths are searched for imports by the files and compile sources.
+	ImportPaths []string `yaml:"import_paths"`
+	// Protos are the files whose services are exposed.
+	Protos []string `yaml:"protos"`
+	// DescriptorSet is the FileDescriptorSet read by the descriptor-set source.
+	DescriptorSet string `yaml:"descriptor_set"`
+	// DescriptorSetFormat is binary or json, detected when empty.
+	DescriptorSetFormat string `yaml:"descriptor_set_format"`
+	// Upstream is the upstream queried by the reflect source, the default
+	// upstream when empty. Discovered services are proxied to it unless a
+	// route says otherwise.
+	Upstream string `yaml:"upstream"`
+	// ReflectClient is either connect or grpc.
+	ReflectClient string `yaml:"reflect_client"`
+	// Timeout bounds schema loading when positive.
+	Timeout time.Duration `yaml:"timeout"`
+	// RefreshInterval reloads the schema periodically when positive, which
+	// picks up services added to an upstream discovered over reflection.
+	// With several schemas the gateway refreshes at the shortest interval.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// Watch reloads the schema when a .proto file below the import paths
+	// changes. Only supported by the files and compile sources.
+	Watch bool `yaml:"watch"`
+}
+
+// importPaths returns the import paths, defaulting to the working directory.
+func (s *Schema) importPaths() []string {
+	if len(s.ImportPaths) == 0 {
+		return []string{"."}
+	}
+
+	return s.ImportPaths
+}
+
+// WatchPaths returns the directories watched for proto changes by the
+// schemas with watch enabled.
+func (c *Config) WatchPaths() []string {
+	var paths []string
+	seen := make(map[string]struct{})
+	for _, s := range c.Schemas {
+		if !s.Watch {
+			continue
+		}
+
+		for _, path := range s.importPaths() {
+			if _, ok := seen[path]; !ok {
+				seen[path] = struct{}{}
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	return paths
+}
+
+// RefreshInterval returns the shortest positive refresh interval of the
+// schemas, zero when none is refreshed.
+func (c *Config) RefreshInterval() time.Duration {
+	var interval time.Duration
+	for _, s := range c.Schemas {
+		if s.RefreshInterval > 0 && (interval == 0 || s.RefreshInterval < interval) {
+			interval = s.RefreshInterval
+		}
+	}
+
+	return interval
+}
+
+// SourceNames returns the source type of every schema.
+func (c *Config) SourceNames() []string {
+	names := make([]string, 0, len(c.Schemas))
+	for _, s := range c.Schemas {
+		names = append(names, s.Source)
+	}
+
+	return names
+}
+
+// Upstream is a backend the gateway proxies to.
+type Upstream struct {
+	// Address is a URL or a host:port, which defaults to plaintext http.
+	Address string `yaml:"address"`
+	// Addresses lists the endpoints of a cluster, in the same form as
+	// Address. It replaces Address.
+	Addresses []string `yaml:"addresses"`
+	// Balancer spreads requests over the endpoints, round-robin by default.
+	Balancer *Balancer `yaml:"balancer"`
+	// Timeout bounds every proxied request when positive.
+	Timeout time.Duration `yaml:"timeout"`
+	// HealthCheck ejects failing endpoints from balancing when set.
+	HealthCheck *HealthCheck `yaml:"health_check"`
+	// Transport is h2c, plaintext HTTP/2, or tls. It defaults to tls when
+	// the address uses https or tls is set, and to h2c otherwise.
+	Transport string `yaml:"transport"`
+	// TLS configures the tls transport.
+	TLS *UpstreamTLS `yaml:"tls"`
+}
+
+// UpstreamTLS configures TLS toward an upstream. Certificate files are
+// reloaded when they change.
+type UpstreamTLS struct {
+	// CAFile is a PEM bundle verifying the upstream, the system roots when
+	// empty.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the PEM client certificate and key for mTLS.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName overrides SNI and the name verified in the certificate.
+	ServerName string `yaml:"server_name"`
+}
+
+// HealthCheck configures the health checking of the endpoints of an
+// upstream, see gateway.HealthCheck. Requests failing to reach an endpoint
+// always count as failures.
+type HealthCheck struct {
+	// Interval enables active probes with grpc.health.v1 when positive.
+	Interval time.Duration `yaml:"interval"`
+	// Timeout bounds every probe.
+	Timeout time.Duration `yaml:"timeout"`
+	// UnhealthyThreshold is the number of consecutive failures ejecting an
+	// endpoint.
+	UnhealthyThreshold int `yaml:"unhealthy_threshold"`
+	// HealthyThreshold is the number of consecutive successes re-admitting
+	// an endpoint.
+	HealthyThreshold int `yaml:"healthy_threshold"`
+	// EjectionTime re-admits endpoints after this long when there are no
+	// active probes.
+	EjectionTime time.Duration `yaml:"ejection_time"`
+}
+
+// addresses returns the addresses of the upstream endpoints.
+func (u *Upstream) addresses() []string {
+	if len(u.Addresses) > 0 {
+		return u.Addresses
+	}
+
+	return []string{u.Address}
+}
+
+// Balancer selects the load balancing policy of an upstream.
+type Balancer struct {
+	// Policy is one of round_robin, least_outstanding or hash.
+	Policy string `yaml:"policy"`
+	// HashHeader is the header, or gRPC metadata, hashed by the hash policy.
+	HashHeader string `yaml:"hash_header"`
+	// HashField is the dot-separated path of the request message field hashed
+	// by the hash policy, e.g. user.id.
+	HashField string `yaml:"hash_field"`
+}
+
+// Route sends a service to an upstream.
+type Route struct {
+	// Service is a fully-qualified service name or a package glob such as
+	// billing.* (one level) or billing.** (any depth). Routes naming a service
+	// take precedence over globs, which are matched in order.
+	Service string `yaml:"service"`
+	// Upstream is the name of the upstream receiving the service.
+	Upstream string `yaml:"upstream"`
+}
+
+// Middleware is a named middleware and its options.
+type Middleware struct {
+	Name    string    `yaml:"name"`
+	Options yaml.Node `yaml:"options"`
+}
+
+// Load reads, interpolates and validates the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, withFile(path, err)
+	}
+
+	return cfg, nil
+}
+
+// Parse decodes, interpolates and validates a YAML or JSON configuration.
+func Parse(data []byte) (*Config, error) {
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(data, root); err != nil {
+		return nil, err
+	}
+
+	if root.Kind == 0 {
+		return nil, errors.New("config is empty")
+	}
+
+	if err := interpolate(root, nil); err != nil {
+		return nil, err
+	}
+
+	retypeScalars(root, reflect.TypeOf(Config{}))
+
+	cfg := &Config{}
+	if err := root.Decode(cfg); err != nil {
+		return nil, err
+	}
+
+	// Unknown keys are reported together with the validation errors so a
+	// single run points at every problem.
+	var errs FieldErrors
+	walkKnownFields(root, reflect.TypeOf(Config{}), nil, &errs)
+
+	var validationErrs FieldErrors
+	if errors.As(cfg.validate(root), &validationErrs) {
+		errs = append(errs, validationErrs...)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return cfg, nil
+}
+
+// withFile prefixes field errors with the file they come from.
+func withFile(path string, err error) error {
+	var fieldErrs FieldErrors
+	if errors.As(err, &fieldErrs) {
+		for _, fe := range fieldErrs {
+			fe.File = path
+		}
+
+		return fieldErrs
+	}
+
+	return fmt.Errorf("%s: %w", path, err)
+}
@@ -0,0 +1,507 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fieldErrors parses data and returns its field errors by key.
+func fieldErrors(t *testing.T, data string) map[string]*FieldError {
+	t.Helper()
+
+	_, err := Parse([]byte(data))
+
+	var errs FieldErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse = %v, want field errors", err)
+	}
+
+	byKey := make(map[string]*FieldError, len(errs))
+	for _, fe := range errs {
+		byKey[fe.Key] = fe
+	}
+
+	return byKey
+}
+
+// checkFieldError checks errs holds an error for key whose message contains
+// msg.
+func checkFieldError(t *testing.T, errs map[string]*FieldError, key, msg string) {
+	t.Helper()
+
+	fe, ok := errs[key]
+	switch {
+	case !ok:
+		t.Errorf("no error for %s, got %v", key, errs)
+	case !strings.Contains(fe.Msg, msg):
+		t.Errorf("%s: %q, want %q", key, fe.Msg, msg)
+	}
+}
+
+func TestParseReportsEveryError(t *testing.T) {
+	errs := fieldErrors(t, `
+listeners:
+  - address: :8000
+  - address: :8000
+    idle_timeout: -1s
+schema:
+  source: files
+upstreams:
+  users:
+    address: localhost:8080
+    timeoutt: 1s
+routes:
+  - service: user.v1.UserService
+    upstream: billing
+  - service: "user..v1"
+    upstream: users
+middleware:
+  - name: gzip
+`)
+
+	checkFieldError(t, errs, "listeners[1].address", `address ":8000" is already used by listeners[0]`)
+	checkFieldError(t, errs, "listeners[1].idle_timeout", "must not be negative")
+	checkFieldError(t, errs, "schema.protos", `at least one proto is required with source "files"`)
+	checkFieldError(t, errs, "upstreams.users.timeoutt", "unknown key")
+	checkFieldError(t, errs, "routes[0].upstream", `unknown upstream "billing", expected one of users`)
+	checkFieldError(t, errs, "routes[1].service", "is not a valid fully-qualified service name or package glob")
+	checkFieldError(t, errs, "middleware[0].name", `unknown middleware "gzip"`)
+
+	if len(errs) != 7 {
+		t.Errorf("got %d errors: %v", len(errs), errs)
+	}
+
+	// Errors point at the offending key, or at the parent of a missing one.
+	for key, line := range map[string]int{
+		"listeners[1].address":     4,
+		"schema.protos":            7,
+		"upstreams.users.timeoutt": 11,
+		"routes[0].upstream":       14,
+	} {
+		if fe := errs[key]; fe != nil && fe.Line != line {
+			t.Errorf("%s reported on line %d, want %d", key, fe.Line, line)
+		}
+	}
+}
+
+func TestParseRequiresSchemaAndUpstream(t *testing.T) {
+	errs := fieldErrors(t, `listeners: [{address: ":8000"}]`)
+
+	checkFieldError(t, errs, "schema", "schema is required")
+	checkFieldError(t, errs, "upstreams", "at least one upstream is required")
+
+	if _, err := Parse([]byte("# nothing\n")); err == nil {
+		t.Error("empty configuration accepted")
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	cfg, err := Parse([]byte(`
+schema:
+  source: reflect
+upstreams:
+  users:
+    address: localhost:8080
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.Listeners) != 1 || cfg.Listeners[0].Address != DefaultListenAddress {
+		t.Errorf("listeners = %+v", cfg.Listeners)
+	}
+
+	if cfg.DefaultUpstream != "users" {
+		t.Errorf("default upstream = %q", cfg.DefaultUpstream)
+	}
+
+	if cfg.DrainTimeout != DefaultDrainTimeout {
+		t.Errorf("drain timeout = %v", cfg.DrainTimeout)
+	}
+
+	if cfg.Schema.ReflectClient != ReflectClientConnect {
+		t.Errorf("reflect client = %q", cfg.Schema.ReflectClient)
+	}
+
+	if !cfg.ReflectionEnabled() || !cfg.HealthEnabled() || !cfg.OpenAPIEnabled() || !cfg.MetricsEnabled() {
+		t.Error("features disabled by default")
+	}
+}
+
+func TestParseInterpolatesEnv(t *testing.T) {
+	t.Setenv("TEST_UPSTREAM", "users:9090")
+	t.Setenv("TEST_TIMEOUT", "5s")
+	t.Setenv("TEST_EMPTY", "")
+
+	cfg, err := Parse([]byte(`
+listeners:
+  - address: ${TEST_LISTEN:-:9000}
+schema:
+  source: files
+  protos: ["$${TEST_UPSTREAM}.proto", "${TEST_EMPTY:-user.proto}"]
+upstreams:
+  users:
+    address: ${TEST_UPSTREAM}
+    timeout: ${TEST_TIMEOUT}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cfg.Listeners[0].Address; got != ":9000" {
+		t.Errorf("listener address = %q", got)
+	}
+
+	if got := cfg.Upstreams["users"]; got.Address != "users:9090" || got.Timeout != 5*time.Second {
+		t.Errorf("upstream = %+v", got)
+	}
+
+	if got := cfg.Schema.Protos; len(got) != 2 || got[0] != "${TEST_UPSTREAM}.proto" || got[1] != "user.proto" {
+		t.Errorf("protos = %v", got)
+	}
+
+	errs := fieldErrors(t, `
+schema:
+  source: files
+  protos: [user.proto]
+upstreams:
+  users:
+    address: ${TEST_UNSET_UPSTREAM}
+`)
+	checkFieldError(t, errs, "upstreams.users.address", "environment variable TEST_UNSET_UPSTREAM is not set")
+}
+
+func TestParseInterpolatesLiteralStrings(t *testing.T) {
+	t.Setenv("TEST_NULL", "null")
+	t.Setenv("TEST_TILDE", "~")
+	t.Setenv("TEST_YES", "yes")
+	t.Setenv("TEST_FALSE", "false")
+
+	cfg, err := Parse([]byte(`
+schema:
+  source: files
+  import_paths:
+    - ${TEST_NULL}
+    - ${TEST_TILDE}
+  protos: [user.proto]
+upstreams:
+  users:
+    address: localhost:8080
+reflection: ${TEST_FALSE}
+middleware:
+  - name: request_id
+    options:
+      header: ${TEST_YES}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Values landing in strings are taken literally.
+	if got := cfg.Schema.ImportPaths; len(got) != 2 || got[0] != "null" || got[1] != "~" {
+		t.Errorf("import paths = %q", got)
+	}
+
+	var opts struct {
+		Header string `yaml:"header"`
+	}
+	if err := decodeOptions(&cfg.Middleware[0].Options, &opts); err != nil || opts.Header != "yes" {
+		t.Errorf("request_id header = %q, %v", opts.Header, err)
+	}
+
+	// Others are typed from their content.
+	if cfg.Reflection == nil || *cfg.Reflection {
+		t.Errorf("reflection = %v", cfg.Reflection)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	if err := os.WriteFile(path, []byte("schema: {source: files}\nupstreams: {users: {address: localhost:8080}}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+":1: schema.protos: ") {
+		t.Errorf("Load = %v, want an error prefixed with the file and line", err)
+	}
+
+	t.Setenv("GATEWAY_LISTEN", "")
+	t.Setenv("USERS_UPSTREAM", "")
+
+	if _, err = Load("../../gateway.example.yaml"); err != nil {
+		t.Errorf("example configuration rejected: %v", err)
+	}
+}
+
+func TestNewGateway(t *testing.T) {
+	cfg, err := Parse([]byte(`
+schema:
+  source: files
+  import_paths: [../../proto, ../../googleapis]
+  protos: [user/v1/user.proto]
+upstreams:
+  users:
+    address: localhost:8080
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gw, err := cfg.NewGateway(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := gw.Schema().ServiceNames(); len(got) != 1 || got[0] != "user.v1.UserService" {
+		t.Errorf("services = %v", got)
+	}
+
+	servers, err := cfg.NewServers(gw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(servers) != 1 || servers[0].Addr != DefaultListenAddress {
+		t.Errorf("servers = %v", servers)
+	}
+}
+
+func TestParseSchemas(t *testing.T) {
+	errs := fieldErrors(t, `
+schema:
+  source: files
+  protos: [user.proto]
+schemas:
+  - source: reflect
+schema_precedence: random
+upstreams:
+  users:
+    address: localhost:8080
+`)
+
+	checkFieldError(t, errs, "schemas", "schema and schemas are mutually exclusive")
+
+	errs = fieldErrors(t, `
+schemas:
+  - source: files
+    protos: [user.proto]
+  - source: reflect
+    upstream: billing
+schema_precedence: random
+upstreams:
+  users:
+    address: localhost:8080
+`)
+
+	checkFieldError(t, errs, "schemas[1].upstream", `unknown upstream "billing"`)
+	checkFieldError(t, errs, "schema_precedence", `unknown precedence "random"`)
+}
+
+func TestParseBalancer(t *testing.T) {
+	tests := []struct {
+		balancer string
+		key      string
+		msg      string
+	}{
+		{balancer: "{policy: random}", key: "upstreams.users.balancer.policy", msg: `unknown policy "random"`},
+		{balancer: "{policy: hash}", key: "upstreams.users.balancer", msg: "policy hash requires hash_header or hash_field"},
+		{balancer: "{policy: hash, hash_header: x-tenant, hash_field: user.id}", key: "upstreams.users.balancer.hash_field", msg: "mutually exclusive"},
+		{balancer: "{policy: hash, hash_field: user..id}", key: "upstreams.users.balancer.hash_field", msg: `"user..id" is not a valid field path`},
+		{balancer: "{policy: round_robin, hash_header: x-tenant}", key: "upstreams.users.balancer.policy", msg: "require policy hash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.balancer, func(t *testing.T) {
+			errs := fieldErrors(t, `
+schema: {source: reflect}
+upstreams:
+  users:
+    addresses: [localhost:8080, localhost:8081]
+    balancer: `+tt.balancer+`
+`)
+
+			checkFieldError(t, errs, tt.key, tt.msg)
+		})
+	}
+
+	for _, balancer := range []string{
+		"{policy: least_outstanding}",
+		"{policy: hash, hash_header: x-tenant}",
+		"{policy: hash, hash_field: user.id}",
+	} {
+		if _, err := Parse([]byte(`
+schema: {source: reflect}
+upstreams:
+  users:
+    addresses: [localhost:8080, localhost:8081]
+    balancer: ` + balancer + `
+`)); err != nil {
+			t.Errorf("balancer %s rejected: %v", balancer, err)
+		}
+	}
+}
+
+func TestParseUpstreamAddresses(t *testing.T) {
+	errs := fieldErrors(t, `
+schema: {source: reflect}
+default_upstream: both
+upstreams:
+  both:
+    address: localhost:8080
+    addresses: [localhost:8081]
+  invalid:
+    addresses: [localhost:8080, "http://[::1"]
+  missing:
+    timeout: 1s
+`)
+
+	checkFieldError(t, errs, "upstreams.both.addresses", "address and addresses are mutually exclusive")
+	checkFieldError(t, errs, "upstreams.invalid.addresses[1]", `invalid address "http://[::1"`)
+	checkFieldError(t, errs, "upstreams.missing.address", "address is required")
+
+	if len(errs) != 3 {
+		t.Errorf("got %d errors: %v", len(errs), errs)
+	}
+}
+
+func TestParseHealthCheck(t *testing.T) {
+	errs := fieldErrors(t, `
+schema: {source: reflect}
+upstreams:
+  users:
+    address: localhost:8080
+    health_check:
+      interval: -1s
+      unhealthy_threshold: -1
+      healthy_threshold: -2
+`)
+
+	checkFieldError(t, errs, "upstreams.users.health_check.interval", "must not be negative")
+	checkFieldError(t, errs, "upstreams.users.health_check.unhealthy_threshold", "must not be negative")
+	checkFieldError(t, errs, "upstreams.users.health_check.healthy_threshold", "must not be negative")
+
+	if len(errs) != 3 {
+		t.Errorf("got %d errors: %v", len(errs), errs)
+	}
+}
+
+func TestParseListenerTLS(t *testing.T) {
+	errs := fieldErrors(t, `
+listeners:
+  - address: :8443
+    tls: {client_auth: require}
+  - address: :9443
+    tls: {cert_file: cert.pem, key_file: key.pem, client_auth: none, client_ca_file: ca.pem}
+  - address: :10443
+    tls: {cert_file: cert.pem, key_file: key.pem, client_auth: always}
+schema: {source: reflect}
+upstreams:
+  users:
+    address: localhost:8080
+`)
+
+	checkFieldError(t, errs, "listeners[0].tls.cert_file", "cert_file is required")
+	checkFieldError(t, errs, "listeners[0].tls.key_file", "key_file is required")
+	checkFieldError(t, errs, "listeners[0].tls.client_ca_file", "client_ca_file is required with client_auth require")
+	checkFieldError(t, errs, "listeners[1].tls.client_auth", "client_ca_file is ignored with client_auth none")
+	checkFieldError(t, errs, "listeners[2].tls.client_auth", `unknown client_auth "always"`)
+
+	if len(errs) != 5 {
+		t.Errorf("got %d errors: %v", len(errs), errs)
+	}
+}
+
+func TestParseUnixSockets(t *testing.T) {
+	errs := fieldErrors(t, `
+listeners:
+  - address: "unix://"
+schema: {source: reflect}
+default_upstream: users
+upstreams:
+  users:
+    address: unix:///run/users.sock
+    transport: tls
+`)
+
+	checkFieldError(t, errs, "listeners[0].address", "missing socket path")
+	checkFieldError(t, errs, "upstreams.users.transport", `transport tls cannot reach unix socket "unix:///run/users.sock"`)
+
+	if len(errs) != 2 {
+		t.Errorf("got %d errors: %v", len(errs), errs)
+	}
+
+	if _, err := Parse([]byte(`
+listeners: [{address: "unix:///run/gateway.sock"}]
+schema: {source: reflect}
+upstreams: {users: {address: "unix:///run/users.sock"}}
+`)); err != nil {
+		t.Errorf("unix sockets rejected: %v", err)
+	}
+}
+
+func TestParseExplorer(t *testing.T) {
+	errs := fieldErrors(t, `
+schema: {source: reflect}
+upstreams: {users: {address: localhost:8080}}
+openapi: false
+explorer: true
+explorer_path: ui
+`)
+
+	checkFieldError(t, errs, "explorer", "the explorer requires openapi to be enabled")
+	checkFieldError(t, errs, "explorer_path", `invalid path "ui", expected an absolute path`)
+
+	for path, msg := range map[string]string{
+		"/":                      "the explorer cannot be mounted at the root, it would shadow every route",
+		"/grpc.health.v1.Health": `path "/grpc.health.v1.Health" collides with /grpc.health.v1.Health/`,
+		"/grpc.reflection.v1.ServerReflection/ui/": `path "/grpc.reflection.v1.ServerReflection/ui/" collides with /grpc.reflection.v1.ServerReflection/`,
+	} {
+		errs := fieldErrors(t, `
+schema: {source: reflect}
+upstreams: {users: {address: localhost:8080}}
+explorer_path: `+path+`
+`)
+
+		checkFieldError(t, errs, "explorer_path", msg)
+	}
+
+	// The explorer follows the OpenAPI document unless set.
+	cfg, err := Parse([]byte(`
+schema: {source: reflect}
+upstreams: {users: {address: localhost:8080}}
+openapi: false
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.ExplorerEnabled() {
+		t.Error("explorer enabled without the OpenAPI document")
+	}
+}
+
+func TestParseErrorFormat(t *testing.T) {
+	errs := fieldErrors(t, `
+schema: {source: reflect}
+upstreams: {users: {address: localhost:8080}}
+error_format: xml
+`)
+
+	checkFieldError(t, errs, "error_format", `unknown error format "xml", expected one of status, problem, google`)
+
+	for _, format := range []string{"status", "problem", "google"} {
+		if _, err := Parse([]byte(`
+schema: {source: reflect}
+upstreams: {users: {address: localhost:8080}}
+error_format: ` + format + `
+`)); err != nil {
+			t.Errorf("error format %s rejected: %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// interpolate expands ${NAME} and ${NAME:-default} references to environment
+// variables in every scalar value of the tree. "$$" produces a literal "$".
+// Keys are left untouched.
+func interpolate(node *yaml.Node, path keyPath) error {
+	var errs FieldErrors
+	walkInterpolate(node, node, path, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func walkInterpolate(root, node *yaml.Node, path keyPath, errs *FieldErrors) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			walkInterpolate(root, n, path, errs)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkInterpolate(root, node.Content[i+1], path.Key(node.Content[i].Value), errs)
+		}
+	case yaml.SequenceNode:
+		for i, n := range node.Content {
+			walkInterpolate(root, n, path.Index(i), errs)
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return
+		}
+
+		value, err := expandEnv(node.Value)
+		if err != nil {
+			*errs = append(*errs, &FieldError{
+				Line: node.Line,
+				Key:  path.String(),
+				Msg:  err.Error(),
+			})
+
+			return
+		}
+
+		// The value keeps the !!str tag of the reference, so that a secret
+		// reading "null" or "yes" stays a string, see retypeScalars.
+		node.Value = value
+	}
+}
+
+// retypeScalars resolves the type of the plain scalars of node from their
+// content where the target in typ is a boolean or a number, so that
+// interpolated values such as "${PORT}" or "${ENABLED}" can fill them.
+// Scalars landing in strings keep their tag.
+func retypeScalars(node *yaml.Node, typ reflect.Type) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch {
+	case typ == yamlNodeType:
+	case node.Kind == yaml.DocumentNode:
+		for _, n := range node.Content {
+			retypeScalars(n, typ)
+		}
+	case node.Kind == yaml.ScalarNode:
+		switch typ.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+		}
+	case typ.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if f, ok := fieldByKey(typ, node.Content[i].Value); ok {
+				retypeScalars(node.Content[i+1], f.Type)
+			}
+		}
+	case typ.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			retypeScalars(node.Content[i], typ.Elem())
+		}
+	case typ.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, n := range node.Content {
+			retypeScalars(n, typ.Elem())
+		}
+	}
+}
+
+// expandEnv replaces environment references in s.
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+			continue
+		case '{':
+		default:
+			b.WriteByte(s[i])
+			continue
+		}
+
+		end := strings.IndexByte(s[i+2:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s)
+		}
+
+		expr := s[i+2 : i+2+end]
+		name, def, hasDef := strings.Cut(expr, ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty variable reference in %q", s)
+		}
+
+		value, ok := os.LookupEnv(name)
+		switch {
+		case ok && value != "":
+		case hasDef:
+			value = def
+		case !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		b.WriteString(value)
+		i += 2 + end
+	}
+
+	return b.String(), nil
+}
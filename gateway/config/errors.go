@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FieldError reports an invalid configuration value.
+type FieldError struct {
+	// File is the configuration file, when loaded from disk.
+	File string
+	// Line is the line of the offending key, zero when unknown.
+	Line int
+	// Key is the dotted path of the offending key, e.g. routes[1].upstream.
+	Key string
+	// Msg describes the problem.
+	Msg string
+}
+
+func (e *FieldError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		b.WriteString(":")
+	}
+
+	if e.Line > 0 {
+		b.WriteString(strconv.Itoa(e.Line))
+		b.WriteString(":")
+	}
+
+	if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+
+	b.WriteString(e.Key)
+	b.WriteString(": ")
+	b.WriteString(e.Msg)
+
+	return b.String()
+}
+
+// FieldErrors collects every FieldError found while validating.
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// keyPath is the path of a key in the configuration tree. Map keys are
+// stored as is and sequence indexes as "[i]".
+type keyPath []string
+
+func (p keyPath) Key(name string) keyPath {
+	return append(p[:len(p):len(p)], name)
+}
+
+func (p keyPath) Index(i int) keyPath {
+	return append(p[:len(p):len(p)], "["+strconv.Itoa(i)+"]")
+}
+
+func (p keyPath) String() string {
+	var b strings.Builder
+	for i, seg := range p {
+		if i > 0 && !strings.HasPrefix(seg, "[") {
+			b.WriteString(".")
+		}
+
+		b.WriteString(seg)
+	}
+
+	return b.String()
+}
+
+// lookup returns the node at the path, or the deepest existing ancestor so
+// errors about missing keys point at their parent.
+func (p keyPath) lookup(root *yaml.Node) *yaml.Node {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, seg := range p {
+		next := child(node, seg)
+		if next == nil {
+			return node
+		}
+
+		node = next
+	}
+
+	return node
+}
+
+// child returns the value of a mapping key, or the element of a sequence for
+// "[i]" segments.
+func child(node *yaml.Node, seg string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == seg {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if !strings.HasPrefix(seg, "[") {
+			return nil
+		}
+
+		i, err := strconv.Atoi(strings.Trim(seg, "[]"))
+		if err != nil || i < 0 || i >= len(node.Content) {
+			return nil
+		}
+
+		return node.Content[i]
+	}
+
+	return nil
+}
+
+// fieldErrorf returns a FieldError for the key at path, resolving its line
+// from the configuration tree.
+func fieldErrorf(root *yaml.Node, path keyPath, format string, args ...any) *FieldError {
+	fe := &FieldError{
+		Key: path.String(),
+		Msg: fmt.Sprintf(format, args...),
+	}
+
+	if root != nil {
+		fe.Line = path.lookup(root).Line
+	}
+
+	return fe
+}
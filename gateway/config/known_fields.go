@@ -0,0 +1,71 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var yamlNodeType = reflect.TypeOf(yaml.Node{})
+
+// walkKnownFields appends an error for every mapping key that does not match
+// a yaml tag of the target type. Unlike yaml.Decoder.KnownFields it works on
+// the interpolated tree and reports every unknown key with its line.
+func walkKnownFields(node *yaml.Node, typ reflect.Type, path keyPath, errs *FieldErrors) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if node.Kind == yaml.DocumentNode {
+		for _, n := range node.Content {
+			walkKnownFields(n, typ, path, errs)
+		}
+
+		return
+	}
+
+	if typ == yamlNodeType {
+		return
+	}
+
+	switch {
+	case typ.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fieldByKey(typ, key.Value)
+			if !ok {
+				*errs = append(*errs, &FieldError{
+					Line: key.Line,
+					Key:  path.Key(key.Value).String(),
+					Msg:  "unknown key",
+				})
+
+				continue
+			}
+
+			walkKnownFields(value, field.Type, path.Key(key.Value), errs)
+		}
+	case typ.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			walkKnownFields(node.Content[i+1], typ.Elem(), path.Key(key), errs)
+		}
+	case typ.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, n := range node.Content {
+			walkKnownFields(n, typ.Elem(), path.Index(i), errs)
+		}
+	}
+}
+
+// fieldByKey returns the field of the struct typ whose yaml tag is key.
+func fieldByKey(typ reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if name, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); key != "" && key != "-" && name == key {
+			return f, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"gopkg.in/yaml.v3"
+
+	"github.com/anhnmt/gprc-dynamic-proto/gateway"
+)
+
+// middlewareFactory builds a middleware from its options node, which is
+// zero when no options were given.
+type middlewareFactory func(options *yaml.Node) (gateway.Middleware, error)
+
+var middlewareFactories = map[string]middlewareFactory{
+	"access_log": newAccessLogMiddleware,
+	"recover":    newRecoverMiddleware,
+	"request_id": newRequestIDMiddleware,
+}
+
+// Formats of the access log.
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+func middlewareNames() []string {
+	names := make([]string, 0, len(middlewareFactories))
+	for name := range middlewareFactories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// decodeOptions decodes the options node into out, rejecting unknown keys.
+func decodeOptions(options *yaml.Node, out any) error {
+	if options.Kind == 0 {
+		return nil
+	}
+
+	var errs FieldErrors
+	walkKnownFields(options, reflect.TypeOf(out), nil, &errs)
+	if len(errs) > 0 {
+		return fmt.Errorf("unknown option %q", errs[0].Key)
+	}
+
+	retypeScalars(options, reflect.TypeOf(out))
+
+	return options.Decode(out)
+}
+
+func newRecoverMiddleware(options *yaml.Node) (gateway.Middleware, error) {
+	if err := decodeOptions(options, &struct{}{}); err != nil {
+		return nil, err
+	}
+
+	return gateway.Recover(), nil
+}
+
+func newRequestIDMiddleware(options *yaml.Node) (gateway.Middleware, error) {
+	opts := struct {
+		Header string `yaml:"header"`
+	}{}
+	if err := decodeOptions(options, &opts); err != nil {
+		return nil, err
+	}
+
+	return gateway.RequestID(opts.Header), nil
+}
+
+func newAccessLogMiddleware(options *yaml.Node) (gateway.Middleware, error) {
+	opts := struct {
+		// Format is json, the default, or console.
+		Format string `yaml:"format"`
+		// Output is stdout, the default, or stderr.
+		Output string `yaml:"output"`
+		// Payloads enables the logging of the messages when set.
+		Payloads *payloadLogOptions `yaml:"payloads"`
+	}{}
+	if err := decodeOptions(options, &opts); err != nil {
+		return nil, err
+	}
+
+	var out io.Writer
+	switch opts.Output {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		return nil, fmt.Errorf("unknown output %q, expected stdout or stderr", opts.Output)
+	}
+
+	switch opts.Format {
+	case "", LogFormatJSON:
+	case LogFormatConsole:
+		out = zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339}
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected %s or %s", opts.Format, LogFormatJSON, LogFormatConsole)
+	}
+
+	var payloads *gateway.PayloadLog
+	if opts.Payloads != nil {
+		var err error
+		if payloads, err = opts.Payloads.payloadLog(); err != nil {
+			return nil, err
+		}
+	}
+
+	return gateway.AccessLog(zerolog.New(out).With().Timestamp().Logger(), payloads), nil
+}
+
+// payloadLogOptions are the options of the payloads of the access log.
+type payloadLogOptions struct {
+	// SampleRatio defaults to 1.
+	SampleRatio *float64 `yaml:"sample_ratio"`
+	// MethodSampleRatios is keyed by package.Service/Method or
+	// package.Service.
+	MethodSampleRatios map[string]float64 `yaml:"method_sample_ratios"`
+	// Redact lists fully-qualified field names.
+	Redact  []string `yaml:"redact"`
+	MaxSize int      `yaml:"max_size"`
+}
+
+func (o *payloadLogOptions) payloadLog() (*gateway.PayloadLog, error) {
+	payloads := &gateway.PayloadLog{
+		SampleRatio:        1,
+		MethodSampleRatios: o.MethodSampleRatios,
+		Redact:             o.Redact,
+		MaxSize:            o.MaxSize,
+	}
+
+	if o.SampleRatio != nil {
+		payloads.SampleRatio = *o.SampleRatio
+	}
+
+	if payloads.SampleRatio < 0 || payloads.SampleRatio > 1 {
+		return nil, fmt.Errorf("payloads sample ratio %v is not between 0 and 1", payloads.SampleRatio)
+	}
+
+	for method, ratio := range o.MethodSampleRatios {
+		if ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("payloads sample ratio %v of %q is not between 0 and 1", ratio, method)
+		}
+	}
+
+	for _, name := range o.Redact {
+		if !protoreflect.FullName(name).IsValid() {
+			return nil, fmt.Errorf("payloads redact %q is not a fully-qualified field name", name)
+		}
+	}
+
+	if o.MaxSize < 0 {
+		return nil, fmt.Errorf("payloads max size %d is negative", o.MaxSize)
+	}
+
+	return payloads, nil
+}
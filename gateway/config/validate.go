@@ -0,0 +1,544 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"gopkg.in/yaml.v3"
+
+	"github.com/anhnmt/gprc-dynamic-proto/gateway"
+)
+
+// Validate checks the configuration and fills in defaults. It is called by
+// Load and Parse, and must be called on configurations built in code.
+func (c *Config) Validate() error {
+	return c.validate(nil)
+}
+
+// validate checks the configuration, resolving error lines from root when
+// the configuration was parsed.
+func (c *Config) validate(root *yaml.Node) error {
+	v := &validator{root: root}
+
+	c.setDefaults()
+	c.validateListeners(v)
+	c.validateUpstreams(v)
+	c.validateSchemas(v)
+	c.validateRoutes(v)
+	c.validateMiddleware(v)
+	c.validateExplorer(v)
+	c.validateTracing(v)
+	c.validateErrorFormat(v)
+	checkDuration(v, keyPath{"drain_timeout"}, c.DrainTimeout)
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+
+	return nil
+}
+
+type validator struct {
+	root *yaml.Node
+	errs FieldErrors
+}
+
+func (v *validator) errorf(path keyPath, format string, args ...any) {
+	v.errs = append(v.errs, fieldErrorf(v.root, path, format, args...))
+}
+
+func (c *Config) setDefaults() {
+	if len(c.Listeners) == 0 {
+		c.Listeners = []*Listener{{Address: DefaultListenAddress}}
+	}
+
+	if c.Schema != nil && len(c.Schemas) == 0 {
+		c.Schemas = []*Schema{c.Schema}
+	}
+
+	for _, s := range c.Schemas {
+		if s != nil && s.Source == SourceReflect && s.ReflectClient == "" {
+			s.ReflectClient = ReflectClientConnect
+		}
+	}
+
+	if c.DrainTimeout == 0 {
+		c.DrainTimeout = DefaultDrainTimeout
+	}
+
+	if c.ExplorerPath == "" {
+		c.ExplorerPath = gateway.DefaultExplorerPath
+	}
+
+	if c.Tracing != nil && c.Tracing.SampleRatio == nil {
+		ratio := 1.0
+		c.Tracing.SampleRatio = &ratio
+	}
+
+	if c.SchemaPrecedence == "" {
+		c.SchemaPrecedence = string(gateway.PrecedenceFirst)
+	}
+
+	for _, u := range c.Upstreams {
+		if u == nil || u.Transport != "" {
+			continue
+		}
+
+		u.Transport = TransportH2C
+		if u.TLS != nil || strings.HasPrefix(u.Address, "https://") ||
+			len(u.Addresses) > 0 && strings.HasPrefix(u.Addresses[0], "https://") {
+			u.Transport = TransportTLS
+		}
+	}
+
+	if c.DefaultUpstream == "" && len(c.Upstreams) == 1 {
+		for name := range c.Upstreams {
+			c.DefaultUpstream = name
+		}
+	}
+}
+
+// ReflectionEnabled reports whether gRPC server reflection is served.
+func (c *Config) ReflectionEnabled() bool {
+	return c.Reflection == nil || *c.Reflection
+}
+
+// HealthEnabled reports whether the gateway health endpoints are served.
+func (c *Config) HealthEnabled() bool {
+	return c.Health == nil || *c.Health
+}
+
+// OpenAPIEnabled reports whether the OpenAPI document is served.
+func (c *Config) OpenAPIEnabled() bool {
+	return c.OpenAPI == nil || *c.OpenAPI
+}
+
+// ExplorerEnabled reports whether the API explorer is served. It follows
+// OpenAPIEnabled unless set.
+func (c *Config) ExplorerEnabled() bool {
+	if c.Explorer == nil {
+		return c.OpenAPIEnabled()
+	}
+
+	return *c.Explorer
+}
+
+// MetricsEnabled reports whether Prometheus metrics are served.
+func (c *Config) MetricsEnabled() bool {
+	return c.Metrics == nil || *c.Metrics
+}
+
+func (c *Config) validateExplorer(v *validator) {
+	if !c.ExplorerEnabled() {
+		return
+	}
+
+	if !c.OpenAPIEnabled() {
+		v.errorf(keyPath{"explorer"}, "the explorer requires openapi to be enabled")
+	}
+
+	if err := gateway.ValidateExplorerPath(c.ExplorerPath); err != nil {
+		v.errorf(keyPath{"explorer_path"}, "%v", err)
+	}
+}
+
+func (c *Config) validateTracing(v *validator) {
+	t := c.Tracing
+	if t == nil {
+		return
+	}
+
+	path := keyPath{"tracing"}
+	switch t.Exporter {
+	case "":
+		v.errorf(path.Key("exporter"), "exporter is required")
+	case gateway.TraceExporterOTLP, gateway.TraceExporterOTLPHTTP:
+		if t.File != "" {
+			v.errorf(path.Key("file"), "file is only used by the %s exporter", gateway.TraceExporterFile)
+		}
+	case gateway.TraceExporterStdout, gateway.TraceExporterFile:
+		if t.Endpoint != "" {
+			v.errorf(path.Key("endpoint"), "endpoint is ignored by the %s exporter", t.Exporter)
+		}
+
+		if t.Exporter == gateway.TraceExporterFile && t.File == "" {
+			v.errorf(path.Key("file"), "file is required with the %s exporter", t.Exporter)
+		}
+
+		if t.Exporter == gateway.TraceExporterStdout && t.File != "" {
+			v.errorf(path.Key("file"), "file is only used by the %s exporter", gateway.TraceExporterFile)
+		}
+	default:
+		v.errorf(path.Key("exporter"), "unknown exporter %q, expected one of %s, %s, %s, %s", t.Exporter,
+			gateway.TraceExporterOTLP, gateway.TraceExporterOTLPHTTP, gateway.TraceExporterStdout, gateway.TraceExporterFile)
+	}
+
+	if t.SampleRatio != nil && (*t.SampleRatio < 0 || *t.SampleRatio > 1) {
+		v.errorf(path.Key("sample_ratio"), "sample_ratio must be between 0 and 1")
+	}
+}
+
+func (c *Config) validateErrorFormat(v *validator) {
+	switch gateway.ErrorFormat(c.ErrorFormat) {
+	case "", gateway.ErrorFormatStatus, gateway.ErrorFormatProblem, gateway.ErrorFormatGoogle:
+	default:
+		v.errorf(keyPath{"error_format"}, "unknown error format %q, expected one of %s, %s, %s",
+			c.ErrorFormat, gateway.ErrorFormatStatus, gateway.ErrorFormatProblem, gateway.ErrorFormatGoogle)
+	}
+}
+
+func (c *Config) validateListeners(v *validator) {
+	seen := make(map[string]int, len(c.Listeners))
+	for i, l := range c.Listeners {
+		path := keyPath{"listeners"}.Index(i)
+		if l == nil {
+			v.errorf(path, "listener must not be empty")
+			continue
+		}
+
+		if l.Address == "" {
+			v.errorf(path.Key("address"), "address is required")
+		} else if strings.HasPrefix(l.Address, gateway.UnixScheme+"://") && strings.TrimPrefix(l.Address, gateway.UnixScheme+"://") == "" {
+			v.errorf(path.Key("address"), "invalid address %q: missing socket path", l.Address)
+		} else if j, ok := seen[l.Address]; ok {
+			v.errorf(path.Key("address"), "address %q is already used by listeners[%d]", l.Address, j)
+		} else {
+			seen[l.Address] = i
+		}
+
+		checkDuration(v, path.Key("read_header_timeout"), l.ReadHeaderTimeout)
+		checkDuration(v, path.Key("read_timeout"), l.ReadTimeout)
+		checkDuration(v, path.Key("write_timeout"), l.WriteTimeout)
+		checkDuration(v, path.Key("idle_timeout"), l.IdleTimeout)
+
+		if l.TLS != nil {
+			validateListenerTLS(v, path.Key("tls"), l.TLS)
+		}
+	}
+}
+
+func validateListenerTLS(v *validator, path keyPath, t *ListenerTLS) {
+	if t.CertFile == "" {
+		v.errorf(path.Key("cert_file"), "cert_file is required")
+	}
+
+	if t.KeyFile == "" {
+		v.errorf(path.Key("key_file"), "key_file is required")
+	}
+
+	switch t.ClientAuth {
+	case "":
+	case gateway.ClientAuthNone:
+		if t.ClientCAFile != "" {
+			v.errorf(path.Key("client_auth"), "client_ca_file is ignored with client_auth %s", t.ClientAuth)
+		}
+	case gateway.ClientAuthOptional, gateway.ClientAuthRequire:
+		if t.ClientCAFile == "" {
+			v.errorf(path.Key("client_ca_file"), "client_ca_file is required with client_auth %s", t.ClientAuth)
+		}
+	default:
+		v.errorf(path.Key("client_auth"), "unknown client_auth %q, expected one of %s, %s, %s",
+			t.ClientAuth, gateway.ClientAuthNone, gateway.ClientAuthOptional, gateway.ClientAuthRequire)
+	}
+}
+
+func (c *Config) validateUpstreams(v *validator) {
+	if len(c.Upstreams) == 0 {
+		v.errorf(keyPath{"upstreams"}, "at least one upstream is required")
+		return
+	}
+
+	for _, name := range c.upstreamNames() {
+		u := c.Upstreams[name]
+		path := keyPath{"upstreams"}.Key(name)
+		if u == nil {
+			v.errorf(path, "upstream must not be empty")
+			continue
+		}
+
+		switch {
+		case u.Address != "" && len(u.Addresses) > 0:
+			v.errorf(path.Key("addresses"), "address and addresses are mutually exclusive")
+		case len(u.Addresses) > 0:
+			for i, address := range u.Addresses {
+				if _, err := ParseAddress(address); err != nil {
+					v.errorf(path.Key("addresses").Index(i), "%v", err)
+				}
+			}
+		case u.Address == "":
+			v.errorf(path.Key("address"), "address is required")
+		default:
+			if _, err := ParseAddress(u.Address); err != nil {
+				v.errorf(path.Key("address"), "%v", err)
+			}
+		}
+
+		if u.Balancer != nil {
+			validateBalancer(v, path.Key("balancer"), u.Balancer)
+		}
+
+		c.validateUpstreamTransport(v, path, u)
+
+		if hc := u.HealthCheck; hc != nil {
+			hcPath := path.Key("health_check")
+			checkDuration(v, hcPath.Key("interval"), hc.Interval)
+			checkDuration(v, hcPath.Key("timeout"), hc.Timeout)
+			checkDuration(v, hcPath.Key("ejection_time"), hc.EjectionTime)
+
+			if hc.UnhealthyThreshold < 0 {
+				v.errorf(hcPath.Key("unhealthy_threshold"), "unhealthy_threshold must not be negative")
+			}
+
+			if hc.HealthyThreshold < 0 {
+				v.errorf(hcPath.Key("healthy_threshold"), "healthy_threshold must not be negative")
+			}
+		}
+
+		checkDuration(v, path.Key("timeout"), u.Timeout)
+	}
+
+	if c.DefaultUpstream != "" {
+		c.checkUpstreamRef(v, keyPath{"default_upstream"}, c.DefaultUpstream)
+	}
+}
+
+func (c *Config) validateUpstreamTransport(v *validator, path keyPath, u *Upstream) {
+	switch u.Transport {
+	case TransportH2C:
+		if u.TLS != nil {
+			v.errorf(path.Key("tls"), "tls requires transport %s", TransportTLS)
+		}
+
+		for _, address := range u.addresses() {
+			if strings.HasPrefix(address, "https://") {
+				v.errorf(path.Key("transport"), "transport %s cannot reach https address %q", TransportH2C, address)
+				break
+			}
+		}
+	case TransportTLS:
+		for _, address := range u.addresses() {
+			if strings.HasPrefix(address, gateway.UnixScheme+"://") {
+				v.errorf(path.Key("transport"), "transport %s cannot reach unix socket %q", TransportTLS, address)
+				break
+			}
+		}
+
+		if t := u.TLS; t != nil && (t.CertFile == "") != (t.KeyFile == "") {
+			v.errorf(path.Key("tls"), "cert_file and key_file must be set together")
+		}
+	default:
+		v.errorf(path.Key("transport"), "unknown transport %q, expected %s or %s", u.Transport, TransportH2C, TransportTLS)
+	}
+}
+
+func validateBalancer(v *validator, path keyPath, b *Balancer) {
+	switch b.Policy {
+	case "", BalancerRoundRobin, BalancerLeastOutstanding:
+		if b.HashHeader != "" || b.HashField != "" {
+			v.errorf(path.Key("policy"), "hash_header and hash_field require policy %s", BalancerHash)
+		}
+	case BalancerHash:
+		switch {
+		case b.HashHeader == "" && b.HashField == "":
+			v.errorf(path, "policy %s requires hash_header or hash_field", BalancerHash)
+		case b.HashHeader != "" && b.HashField != "":
+			v.errorf(path.Key("hash_field"), "hash_header and hash_field are mutually exclusive")
+		case b.HashField != "":
+			for _, name := range strings.Split(b.HashField, ".") {
+				if !protoreflect.Name(name).IsValid() {
+					v.errorf(path.Key("hash_field"), "%q is not a valid field path", b.HashField)
+					break
+				}
+			}
+		}
+	default:
+		v.errorf(path.Key("policy"), "unknown policy %q, expected one of %s", b.Policy, strings.Join([]string{
+			BalancerRoundRobin,
+			BalancerLeastOutstanding,
+			BalancerHash,
+		}, ", "))
+	}
+}
+
+func (c *Config) validateSchemas(v *validator) {
+	switch {
+	case c.Schema != nil && len(c.Schemas) > 0 && c.Schemas[0] != c.Schema:
+		v.errorf(keyPath{"schemas"}, "schema and schemas are mutually exclusive")
+		return
+	case len(c.Schemas) == 0:
+		v.errorf(keyPath{"schema"}, "schema is required")
+		return
+	case c.Schema != nil:
+		c.validateSchema(v, keyPath{"schema"}, c.Schema)
+	default:
+		for i, s := range c.Schemas {
+			c.validateSchema(v, keyPath{"schemas"}.Index(i), s)
+		}
+	}
+
+	switch gateway.Precedence(c.SchemaPrecedence) {
+	case gateway.PrecedenceFirst, gateway.PrecedenceLast, gateway.PrecedenceError:
+	default:
+		v.errorf(keyPath{"schema_precedence"}, "unknown precedence %q, expected one of %s, %s, %s",
+			c.SchemaPrecedence, gateway.PrecedenceFirst, gateway.PrecedenceLast, gateway.PrecedenceError)
+	}
+}
+
+func (c *Config) validateSchema(v *validator, path keyPath, s *Schema) {
+	if s == nil {
+		v.errorf(path, "schema must not be empty")
+		return
+	}
+
+	switch s.Source {
+	case SourceFiles, SourceCompile:
+		if len(s.Protos) == 0 {
+			v.errorf(path.Key("protos"), "at least one proto is required with source %q", s.Source)
+		}
+	case SourceDescriptorSet:
+		if s.DescriptorSet == "" {
+			v.errorf(path.Key("descriptor_set"), "descriptor_set is required with source %q", s.Source)
+		}
+
+		switch s.DescriptorSetFormat {
+		case "", gateway.DescriptorSetFormatBinary, gateway.DescriptorSetFormatJSON:
+		default:
+			v.errorf(path.Key("descriptor_set_format"), "unknown format %q, expected %s or %s",
+				s.DescriptorSetFormat, gateway.DescriptorSetFormatBinary, gateway.DescriptorSetFormatJSON)
+		}
+	case SourceReflect:
+		switch {
+		case s.Upstream != "":
+			c.checkUpstreamRef(v, path.Key("upstream"), s.Upstream)
+		case c.DefaultUpstream == "":
+			v.errorf(path.Key("upstream"), "upstream is required with source %q when there is no default_upstream", s.Source)
+		}
+
+		if s.ReflectClient != ReflectClientConnect && s.ReflectClient != ReflectClientGRPC {
+			v.errorf(path.Key("reflect_client"), "unknown reflect client %q, expected %s or %s",
+				s.ReflectClient, ReflectClientConnect, ReflectClientGRPC)
+		}
+	case "":
+		v.errorf(path.Key("source"), "source is required")
+	default:
+		v.errorf(path.Key("source"), "unknown source %q, expected one of %s", s.Source, strings.Join([]string{
+			SourceFiles,
+			SourceCompile,
+			SourceReflect,
+			SourceDescriptorSet,
+		}, ", "))
+	}
+
+	if s.Watch && s.Source != SourceFiles && s.Source != SourceCompile {
+		v.errorf(path.Key("watch"), "watch is only supported with sources %s and %s", SourceFiles, SourceCompile)
+	}
+
+	checkDuration(v, path.Key("timeout"), s.Timeout)
+	checkDuration(v, path.Key("refresh_interval"), s.RefreshInterval)
+}
+
+func (c *Config) validateRoutes(v *validator) {
+	seen := make(map[string]int, len(c.Routes))
+	for i, r := range c.Routes {
+		path := keyPath{"routes"}.Index(i)
+		if r == nil {
+			v.errorf(path, "route must not be empty")
+			continue
+		}
+
+		switch {
+		case r.Service == "":
+			v.errorf(path.Key("service"), "service is required")
+		case !gateway.ValidServicePattern(r.Service):
+			v.errorf(path.Key("service"), "%q is not a valid fully-qualified service name or package glob", r.Service)
+		default:
+			if j, ok := seen[r.Service]; ok {
+				v.errorf(path.Key("service"), "service %q is already routed by routes[%d]", r.Service, j)
+			}
+
+			seen[r.Service] = i
+		}
+
+		if r.Upstream == "" {
+			v.errorf(path.Key("upstream"), "upstream is required")
+		} else {
+			c.checkUpstreamRef(v, path.Key("upstream"), r.Upstream)
+		}
+	}
+}
+
+func (c *Config) validateMiddleware(v *validator) {
+	for i, m := range c.Middleware {
+		path := keyPath{"middleware"}.Index(i)
+		if m == nil {
+			v.errorf(path, "middleware must not be empty")
+			continue
+		}
+
+		factory, ok := middlewareFactories[m.Name]
+		switch {
+		case m.Name == "":
+			v.errorf(path.Key("name"), "name is required")
+		case !ok:
+			v.errorf(path.Key("name"), "unknown middleware %q, expected one of %s",
+				m.Name, strings.Join(middlewareNames(), ", "))
+		default:
+			if _, err := factory(&m.Options); err != nil {
+				v.errorf(path.Key("options"), "%v", err)
+			}
+		}
+	}
+}
+
+func (c *Config) checkUpstreamRef(v *validator, path keyPath, name string) {
+	if _, ok := c.Upstreams[name]; !ok {
+		v.errorf(path, "unknown upstream %q, expected one of %s", name, strings.Join(c.upstreamNames(), ", "))
+	}
+}
+
+func (c *Config) upstreamNames() []string {
+	names := make([]string, 0, len(c.Upstreams))
+	for name := range c.Upstreams {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func checkDuration(v *validator, path keyPath, d time.Duration) {
+	if d < 0 {
+		v.errorf(path, "must not be negative")
+	}
+}
+
+// ParseAddress accepts either a URL, a unix:// socket URL or a bare
+// host:port, which defaults to plaintext http.
+func ParseAddress(address string) (*url.URL, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	target, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+
+	if target.Scheme == gateway.UnixScheme {
+		if target.Host == "" && target.Path == "" {
+			return nil, fmt.Errorf("invalid address %q: missing socket path", address)
+		}
+
+		return target, nil
+	}
+
+	if target.Host == "" {
+		return nil, fmt.Errorf("invalid address %q: missing host", address)
+	}
+
+	return target, nil
+}
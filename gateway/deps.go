@@ -0,0 +1,249 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// MissingFileError is returned when a file imported by the schema cannot be
+// resolved.
+type MissingFileError struct {
+	// Name is the path of the missing file.
+	Name string
+	// ImportedBy is the path of a file importing it.
+	ImportedBy string
+	// Err is the error returned while fetching the file, if any.
+	Err error
+}
+
+func (e *MissingFileError) Error() string {
+	msg := fmt.Sprintf("file %q imported by %q is missing", e.Name, e.ImportedBy)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *MissingFileError) Unwrap() error {
+	return e.Err
+}
+
+// ImportCycleError is returned when files import each other.
+type ImportCycleError struct {
+	// Cycle lists the files of the cycle, starting and ending with the same
+	// file.
+	Cycle []string
+}
+
+func (e *ImportCycleError) Error() string {
+	return "import cycle: " + strings.Join(e.Cycle, " -> ")
+}
+
+// fetchFunc requests a file, and possibly some of its dependencies, by path.
+type fetchFunc func(name string) ([]*descriptorpb.FileDescriptorProto, error)
+
+// fileGraph is a set of file descriptor protos linked by their imports. It
+// accepts files in any order, as reflection servers return them, and builds
+// a registry with every file registered after its dependencies.
+type fileGraph struct {
+	files map[string]*descriptorpb.FileDescriptorProto
+	// order keeps the insertion order so that results are deterministic.
+	order []string
+}
+
+func newFileGraph() *fileGraph {
+	return &fileGraph{
+		files: make(map[string]*descriptorpb.FileDescriptorProto),
+	}
+}
+
+// add inserts the files, ignoring duplicates and reporting files defined
+// twice with a different content.
+func (g *fileGraph) add(fdps ...*descriptorpb.FileDescriptorProto) error {
+	for _, fdp := range fdps {
+		name := fdp.GetName()
+		prev, ok := g.files[name]
+		if !ok {
+			g.files[name] = fdp
+			g.order = append(g.order, name)
+			continue
+		}
+
+		if !sameFileProto(prev, fdp) {
+			return &ConflictError{
+				Name:  name,
+				Files: [2]string{name, name},
+			}
+		}
+	}
+
+	return nil
+}
+
+// sameFileProto is sameFile for file descriptor protos.
+func sameFileProto(a, b *descriptorpb.FileDescriptorProto) bool {
+	a, b = proto.Clone(a).(*descriptorpb.FileDescriptorProto), proto.Clone(b).(*descriptorpb.FileDescriptorProto)
+	a.SourceCodeInfo, b.SourceCodeInfo = nil, nil
+
+	return proto.Equal(a, b)
+}
+
+// missing returns the imported files absent from the graph, each with one
+// of the files importing it.
+func (g *fileGraph) missing() map[string]string {
+	missing := make(map[string]string)
+	for _, name := range g.order {
+		for _, dep := range g.files[name].GetDependency() {
+			if _, ok := g.files[dep]; ok {
+				continue
+			}
+
+			if _, ok := missing[dep]; !ok {
+				missing[dep] = name
+			}
+		}
+	}
+
+	return missing
+}
+
+// fetchMissing requests absent imports with fetch until the graph is
+// complete. Servers are not required to send transitive dependencies along
+// with a file, so several rounds may be needed.
+func (g *fileGraph) fetchMissing(fetch fetchFunc) error {
+	requested := make(map[string]struct{})
+	for missing := g.missing(); len(missing) > 0; missing = g.missing() {
+		for _, name := range sortedKeys(missing) {
+			if _, ok := requested[name]; ok || fetch == nil {
+				return &MissingFileError{Name: name, ImportedBy: missing[name]}
+			}
+
+			requested[name] = struct{}{}
+
+			fdps, err := fetch(name)
+			if err != nil {
+				return &MissingFileError{Name: name, ImportedBy: missing[name], Err: err}
+			}
+
+			if err = g.add(fdps...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// sorted returns the files in topological order, dependencies first.
+func (g *fileGraph) sorted() ([]*descriptorpb.FileDescriptorProto, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := make(map[string]int, len(g.files))
+	sorted := make([]*descriptorpb.FileDescriptorProto, 0, len(g.files))
+
+	// stack holds the files being visited, to report the cycle.
+	var stack []string
+
+	var visit func(name, importedBy string) error
+	visit = func(name, importedBy string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, n := range stack {
+				if n == name {
+					start = i
+				}
+			}
+
+			cycle := append(append([]string{}, stack[start:]...), name)
+			return &ImportCycleError{Cycle: cycle}
+		}
+
+		fdp, ok := g.files[name]
+		if !ok {
+			return &MissingFileError{Name: name, ImportedBy: importedBy}
+		}
+
+		state[name] = visiting
+		stack = append(stack, name)
+
+		for _, dep := range fdp.GetDependency() {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		sorted = append(sorted, fdp)
+
+		return nil
+	}
+
+	for _, name := range g.order {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// build returns an isolated registry holding every file of the graph.
+func (g *fileGraph) build() (*protoregistry.Files, error) {
+	sorted, err := g.sorted()
+	if err != nil {
+		return nil, err
+	}
+
+	files := &protoregistry.Files{}
+	for _, fdp := range sorted {
+		file, err := protodesc.NewFile(fdp, files)
+		if err != nil {
+			return nil, fmt.Errorf("could not create file %q: %w", fdp.GetName(), err)
+		}
+
+		if err = registerFile(files, file); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// newFilesFromProtos builds an isolated registry from file descriptor protos
+// given in any order, fetching missing imports with fetch when not nil.
+func newFilesFromProtos(fdps []*descriptorpb.FileDescriptorProto, fetch fetchFunc) (*protoregistry.Files, error) {
+	g := newFileGraph()
+	if err := g.add(fdps...); err != nil {
+		return nil, err
+	}
+
+	if err := g.fetchMissing(fetch); err != nil {
+		return nil, err
+	}
+
+	return g.build()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,117 @@
+package gateway
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// fileProto returns a file declaring a message, whose package is named after
+// the file, importing deps.
+func fileProto(name string, deps ...string) *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(name),
+		Package:    proto.String(strings.TrimSuffix(name, ".proto")),
+		Syntax:     proto.String("proto3"),
+		Dependency: deps,
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Message"),
+		}},
+	}
+}
+
+func TestNewFilesFromProtosInAnyOrder(t *testing.T) {
+	files, err := newFilesFromProtos([]*descriptorpb.FileDescriptorProto{
+		fileProto("c.proto", "b.proto"),
+		fileProto("b.proto", "a.proto"),
+		fileProto("a.proto"),
+		// Reflection servers send the same file along with several others.
+		fileProto("a.proto"),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files.NumFiles() != 3 {
+		t.Errorf("%d files registered", files.NumFiles())
+	}
+}
+
+func TestNewFilesFromProtosFetchesMissingImports(t *testing.T) {
+	available := map[string]*descriptorpb.FileDescriptorProto{
+		"b.proto": fileProto("b.proto", "a.proto"),
+		"a.proto": fileProto("a.proto"),
+	}
+
+	var fetched []string
+	fetch := func(name string) ([]*descriptorpb.FileDescriptorProto, error) {
+		fetched = append(fetched, name)
+		if fdp, ok := available[name]; ok {
+			return []*descriptorpb.FileDescriptorProto{fdp}, nil
+		}
+
+		return nil, errors.New("not found")
+	}
+
+	files, err := newFilesFromProtos([]*descriptorpb.FileDescriptorProto{fileProto("c.proto", "b.proto")}, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files.NumFiles() != 3 || !slices.Equal(fetched, []string{"b.proto", "a.proto"}) {
+		t.Errorf("%d files registered, fetched %v", files.NumFiles(), fetched)
+	}
+
+	// Imports the server cannot resolve are reported with their importer.
+	delete(available, "a.proto")
+	fetched = nil
+
+	_, err = newFilesFromProtos([]*descriptorpb.FileDescriptorProto{fileProto("c.proto", "b.proto")}, fetch)
+
+	var missing *MissingFileError
+	if !errors.As(err, &missing) || missing.Name != "a.proto" || missing.ImportedBy != "b.proto" || missing.Err == nil {
+		t.Errorf("newFilesFromProtos = %v, want a.proto missing", err)
+	}
+
+	_, err = newFilesFromProtos([]*descriptorpb.FileDescriptorProto{fileProto("c.proto", "b.proto")}, nil)
+	if !errors.As(err, &missing) || missing.Name != "b.proto" || missing.ImportedBy != "c.proto" {
+		t.Errorf("newFilesFromProtos without fetch = %v, want b.proto missing", err)
+	}
+}
+
+func TestNewFilesFromProtosReportsCycles(t *testing.T) {
+	_, err := newFilesFromProtos([]*descriptorpb.FileDescriptorProto{
+		fileProto("a.proto", "b.proto"),
+		fileProto("b.proto", "c.proto"),
+		fileProto("c.proto", "b.proto"),
+	}, nil)
+
+	var cycle *ImportCycleError
+	if !errors.As(err, &cycle) || !slices.Equal(cycle.Cycle, []string{"b.proto", "c.proto", "b.proto"}) {
+		t.Errorf("newFilesFromProtos = %v, want the cycle b.proto -> c.proto -> b.proto", err)
+	}
+}
+
+func TestNewFilesFromProtosReportsConflicts(t *testing.T) {
+	// Source code info is ignored, reflection servers usually strip it.
+	withInfo := fileProto("a.proto")
+	withInfo.SourceCodeInfo = &descriptorpb.SourceCodeInfo{}
+
+	if _, err := newFilesFromProtos([]*descriptorpb.FileDescriptorProto{fileProto("a.proto"), withInfo}, nil); err != nil {
+		t.Errorf("same file with source code info rejected: %v", err)
+	}
+
+	changed := fileProto("a.proto")
+	changed.MessageType[0].Name = proto.String("Other")
+
+	_, err := newFilesFromProtos([]*descriptorpb.FileDescriptorProto{fileProto("a.proto"), changed}, nil)
+
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Name != "a.proto" {
+		t.Errorf("newFilesFromProtos = %v, want a conflict on a.proto", err)
+	}
+}
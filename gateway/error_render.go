@@ -0,0 +1,494 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	// The standard error details resolve even when the schema does not
+	// import google/rpc/error_details.proto.
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// ErrorFormat is the body of the errors returned to REST clients, see
+// WithErrorFormat.
+type ErrorFormat string
+
+const (
+	// ErrorFormatStatus renders the google.rpc.Status as JSON, the shape
+	// vanguard writes: {"code": 5, "message": "...", "details": [...]}.
+	ErrorFormatStatus ErrorFormat = "status"
+	// ErrorFormatProblem renders RFC 9457 problem details as
+	// application/problem+json, with the google.rpc.Code name in code and
+	// the details in details.
+	ErrorFormatProblem ErrorFormat = "problem"
+	// ErrorFormatGoogle renders the JSON error shape of Google APIs:
+	// {"error": {"code": 404, "message": "...", "status": "NOT_FOUND",
+	// "details": [...]}}.
+	ErrorFormatGoogle ErrorFormat = "google"
+)
+
+// maxErrorBody bounds the error bodies buffered to be rendered.
+const maxErrorBody = 64 << 10
+
+// renderErrors renders the errors of the REST calls served by handler in
+// format. The status of the upstream response is preferred over the error
+// written by the transcoder, which loses the details whose types are not
+// linked in the binary. Details are resolved with types.
+func renderErrors(handler http.Handler, format ErrorFormat, types *dynamicpb.Types) http.Handler {
+	resolver := detailResolver{types: types}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := callFromContext(r.Context())
+		if !ok || c.protocol != ProtocolREST {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		c.captureStatus = true
+		ew := &errorWriter{ResponseWriter: w}
+
+		// Deferred to render the errors of the calls the proxy aborts with
+		// a panic.
+		defer ew.render(c, format, resolver)
+
+		handler.ServeHTTP(ew, r)
+	})
+}
+
+// errorWriter holds back error responses until they are rendered.
+type errorWriter struct {
+	http.ResponseWriter
+	// status is the held status, zero unless an error is buffered.
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (w *errorWriter) WriteHeader(status int) {
+	if w.wrote || w.status != 0 {
+		return
+	}
+
+	if status >= http.StatusBadRequest {
+		w.status = status
+		return
+	}
+
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	if !w.wrote && w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.wrote {
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.body.Write(p)
+	if w.body.Len() > maxErrorBody {
+		// Too large to be an error rendered by the transcoder.
+		if err := w.flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// flush writes the held error as is.
+func (w *errorWriter) flush() error {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(w.status)
+
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	w.body.Reset()
+
+	return err
+}
+
+// Flush implements http.Flusher, which streaming responses rely on.
+func (w *errorWriter) Flush() {
+	if !w.wrote && w.status != 0 {
+		return
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *errorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// render writes the held error in format, or as is when it is not a
+// google.rpc.Status, such as the 404 of unknown paths.
+func (w *errorWriter) render(c *call, format ErrorFormat, resolver detailResolver) {
+	if w.wrote || w.status == 0 {
+		return
+	}
+
+	st := c.upstreamStatus
+	if st == nil {
+		st = &spb.Status{}
+		opts := protojson.UnmarshalOptions{Resolver: resolver, DiscardUnknown: true}
+		if opts.Unmarshal(w.body.Bytes(), st) != nil || st.GetCode() == 0 {
+			_ = w.flush()
+			return
+		}
+	}
+
+	status := httpStatusFromCode(codes.Code(st.GetCode()))
+	contentType, body := renderStatus(st, status, format, resolver, c.path)
+
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Del("Content-Encoding")
+
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(status)
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+// renderStatus returns the content type and body of st in format. instance
+// is the path of the call, reported by problem details.
+func renderStatus(st *spb.Status, status int, format ErrorFormat, resolver detailResolver, instance string) (string, []byte) {
+	details := marshalDetails(st.GetDetails(), resolver)
+
+	var (
+		contentType = "application/json"
+		body        any
+	)
+
+	switch format {
+	case ErrorFormatProblem:
+		contentType = "application/problem+json"
+		body = struct {
+			Type     string            `json:"type"`
+			Title    string            `json:"title"`
+			Status   int               `json:"status"`
+			Detail   string            `json:"detail,omitempty"`
+			Instance string            `json:"instance,omitempty"`
+			Code     string            `json:"code"`
+			Details  []json.RawMessage `json:"details,omitempty"`
+		}{
+			Type:     "about:blank",
+			Title:    http.StatusText(status),
+			Status:   status,
+			Detail:   st.GetMessage(),
+			Instance: instance,
+			Code:     code.Code(st.GetCode()).String(),
+			Details:  details,
+		}
+	case ErrorFormatGoogle:
+		type googleError struct {
+			Code    int               `json:"code"`
+			Message string            `json:"message"`
+			Status  string            `json:"status"`
+			Details []json.RawMessage `json:"details,omitempty"`
+		}
+
+		body = struct {
+			Error googleError `json:"error"`
+		}{
+			Error: googleError{
+				Code:    status,
+				Message: st.GetMessage(),
+				Status:  code.Code(st.GetCode()).String(),
+				Details: details,
+			},
+		}
+	default:
+		body = struct {
+			Code    int32             `json:"code"`
+			Message string            `json:"message"`
+			Details []json.RawMessage `json:"details"`
+		}{
+			Code:    st.GetCode(),
+			Message: st.GetMessage(),
+			Details: append([]json.RawMessage{}, details...),
+		}
+	}
+
+	data, _ := json.Marshal(body)
+	return contentType, data
+}
+
+// marshalDetails returns the details as protojson. Details of unknown types
+// keep their encoded value.
+func marshalDetails(details []*anypb.Any, resolver detailResolver) []json.RawMessage {
+	opts := protojson.MarshalOptions{Resolver: resolver}
+
+	out := make([]json.RawMessage, 0, len(details))
+	for _, detail := range details {
+		data, err := opts.Marshal(detail)
+		if err != nil {
+			data, _ = json.Marshal(map[string]string{
+				"@type": detail.GetTypeUrl(),
+				"value": base64.StdEncoding.EncodeToString(detail.GetValue()),
+			})
+		}
+
+		out = append(out, data)
+	}
+
+	return out
+}
+
+// detailResolver resolves the types of error details in the schema, then
+// among the types linked in the binary.
+type detailResolver struct {
+	types *dynamicpb.Types
+}
+
+// FindMessageByName implements protoregistry.MessageTypeResolver.
+func (r detailResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	mt, err := r.types.FindMessageByName(name)
+	if errors.Is(err, protoregistry.NotFound) {
+		return protoregistry.GlobalTypes.FindMessageByName(name)
+	}
+
+	return mt, err
+}
+
+// FindMessageByURL implements protoregistry.MessageTypeResolver.
+func (r detailResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	mt, err := r.types.FindMessageByURL(url)
+	if errors.Is(err, protoregistry.NotFound) {
+		return protoregistry.GlobalTypes.FindMessageByURL(url)
+	}
+
+	return mt, err
+}
+
+// FindExtensionByName implements protoregistry.ExtensionTypeResolver.
+func (r detailResolver) FindExtensionByName(name protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	xt, err := r.types.FindExtensionByName(name)
+	if errors.Is(err, protoregistry.NotFound) {
+		return protoregistry.GlobalTypes.FindExtensionByName(name)
+	}
+
+	return xt, err
+}
+
+// FindExtensionByNumber implements protoregistry.ExtensionTypeResolver.
+func (r detailResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	xt, err := r.types.FindExtensionByNumber(message, field)
+	if errors.Is(err, protoregistry.NotFound) {
+		return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+	}
+
+	return xt, err
+}
+
+// statusWriter captures the status of the upstream response of a call for
+// the error renderer.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+	// metadata holds the status metadata of the response headers, which
+	// the transcoder consumes once they are written.
+	metadata http.Header
+	body     bytes.Buffer
+}
+
+// statusMetadata lists the metadata of gRPC statuses.
+var statusMetadata = []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+
+		w.metadata = make(http.Header, len(statusMetadata))
+		for _, key := range statusMetadata {
+			if value := w.Header().Get(key); value != "" {
+				w.metadata.Set(key, value)
+			}
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	if w.code != http.StatusOK && w.body.Len() < maxErrorBody {
+		w.body.Write(p[:min(n, maxErrorBody-w.body.Len())])
+	}
+
+	return n, err
+}
+
+// Flush implements http.Flusher, which streaming responses rely on.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// status returns the error of the completed upstream response, nil when it
+// succeeded: the grpc-status, grpc-message and grpc-status-details-bin
+// metadata of gRPC and gRPC-Web, or the body of Connect unary errors.
+func (w *statusWriter) status() *spb.Status {
+	header := w.metadata
+	if header.Get("Grpc-Status") == "" {
+		// Trailers.
+		header = w.Header()
+	}
+
+	if value := metadata(header, "Grpc-Status"); value != "" {
+		return grpcStatus(header, value)
+	}
+
+	if w.code == 0 || w.code == http.StatusOK {
+		return nil
+	}
+
+	return connectStatus(w.body.Bytes())
+}
+
+// metadata returns a response header or trailer.
+func metadata(header http.Header, key string) string {
+	if value := header.Get(key); value != "" {
+		return value
+	}
+
+	return header.Get(http.TrailerPrefix + key)
+}
+
+// grpcStatus returns the status of a gRPC response whose grpc-status is
+// value.
+func grpcStatus(header http.Header, value string) *spb.Status {
+	c, err := strconv.Atoi(value)
+	if err != nil || c == int(codes.OK) {
+		return nil
+	}
+
+	message := metadata(header, "Grpc-Message")
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+
+	st := &spb.Status{
+		Code:    int32(c),
+		Message: message,
+	}
+
+	// The details hold the whole status, whose code must match.
+	if bin := metadata(header, "Grpc-Status-Details-Bin"); bin != "" {
+		var details spb.Status
+		if data, err := decodeBinary(bin); err == nil &&
+			proto.Unmarshal(data, &details) == nil && details.GetCode() == st.GetCode() {
+			return &details
+		}
+	}
+
+	return st
+}
+
+// connectStatus returns the status of a Connect unary error body, nil when
+// it is not one.
+func connectStatus(body []byte) *spb.Status {
+	var e struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Details []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"details"`
+	}
+
+	if json.Unmarshal(body, &e) != nil || e.Code == "" {
+		return nil
+	}
+
+	st := &spb.Status{
+		Code:    int32(connectCode(e.Code)),
+		Message: e.Message,
+	}
+
+	for _, detail := range e.Details {
+		value, err := decodeBinary(detail.Value)
+		if err != nil {
+			continue
+		}
+
+		st.Details = append(st.Details, &anypb.Any{
+			TypeUrl: "type.googleapis.com/" + detail.Type,
+			Value:   value,
+		})
+	}
+
+	return st
+}
+
+// decodeBinary decodes the base64 of binary metadata and Connect error
+// details, which should be unpadded but may not be.
+func decodeBinary(value string) ([]byte, error) {
+	b, err := base64.RawStdEncoding.DecodeString(value)
+	if err != nil {
+		b, err = base64.StdEncoding.DecodeString(value)
+	}
+
+	return b, err
+}
+
+// httpStatusFromCode maps a gRPC code to an HTTP status, following
+// google.rpc.Code.
+func httpStatusFromCode(c codes.Code) int {
+	switch c {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,301 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"connectrpc.com/connect"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const failProto = `
+syntax = "proto3";
+
+package fail.v1;
+
+import "google/api/annotations.proto";
+
+service FailService {
+  rpc Fail(FailRequest) returns (FailRequest) {
+    option (google.api.http) = {get: "/v1/fail"};
+  }
+}
+
+message FailRequest {}
+
+// Reason is only known to the schema.
+message Reason {
+  string text = 1;
+}
+`
+
+// failStatus is the error of failUpstream: a detail of the schema, a
+// standard one and one of an unknown type.
+func failStatus(t *testing.T) *spb.Status {
+	t.Helper()
+
+	badRequest, err := anypb.New(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "id", Description: "required"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &spb.Status{
+		Code:    5,
+		Message: "no such thing",
+		Details: []*anypb.Any{
+			// text: "gone"
+			{TypeUrl: "type.googleapis.com/fail.v1.Reason", Value: []byte("\x0a\x04gone")},
+			badRequest,
+			{TypeUrl: "type.googleapis.com/unknown.Type", Value: []byte{1, 2}},
+		},
+	}
+}
+
+// failUpstream answers every gRPC call with st, as a trailers-only
+// response.
+func failUpstream(t *testing.T, st *spb.Status) http.Handler {
+	t.Helper()
+
+	bin, err := proto.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "5")
+		w.Header().Set("Grpc-Message", "no%20such%20thing")
+		w.Header().Set("Grpc-Status-Details-Bin", base64.RawStdEncoding.EncodeToString(bin))
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// newFailGateway serves failProto in front of failUpstream.
+func newFailGateway(t *testing.T, opts ...Option) string {
+	t.Helper()
+
+	_, addr := newTestGateway(t, append([]Option{
+		WithSchemaSource(NewParserSource(writeProto(t, "fail/v1/fail.proto", failProto), "fail/v1/fail.proto")),
+		WithUpstream(newUpstream(t, failUpstream(t, failStatus(t)))),
+	}, opts...)...)
+
+	return addr
+}
+
+// getJSON gets url and returns the response along with its decoded body.
+func getJSON(t *testing.T, url string) (*http.Response, any) {
+	t.Helper()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body any
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("%s: %v\n%s", url, err, data)
+	}
+
+	return res, body
+}
+
+// decodeJSON decodes the expected body of a test.
+func decodeJSON(t *testing.T, data string) any {
+	t.Helper()
+
+	var v any
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func TestRenderErrors(t *testing.T) {
+	const details = `[
+		{"@type": "type.googleapis.com/fail.v1.Reason", "text": "gone"},
+		{"@type": "type.googleapis.com/google.rpc.BadRequest", "fieldViolations": [{"field": "id", "description": "required"}]},
+		{"@type": "type.googleapis.com/unknown.Type", "value": "AQI="}
+	]`
+
+	tests := []struct {
+		format      ErrorFormat
+		contentType string
+		want        string
+	}{
+		{
+			format:      ErrorFormatStatus,
+			contentType: "application/json",
+			want:        `{"code": 5, "message": "no such thing", "details": ` + details + `}`,
+		},
+		{
+			format:      ErrorFormatProblem,
+			contentType: "application/problem+json",
+			want: `{
+				"type": "about:blank",
+				"title": "Not Found",
+				"status": 404,
+				"detail": "no such thing",
+				"instance": "/v1/fail",
+				"code": "NOT_FOUND",
+				"details": ` + details + `
+			}`,
+		},
+		{
+			format:      ErrorFormatGoogle,
+			contentType: "application/json",
+			want:        `{"error": {"code": 404, "message": "no such thing", "status": "NOT_FOUND", "details": ` + details + `}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			addr := newFailGateway(t, WithErrorFormat(tt.format))
+
+			res, body := getJSON(t, addr+"/v1/fail")
+			if res.StatusCode != http.StatusNotFound {
+				t.Errorf("status = %d", res.StatusCode)
+			}
+
+			if got := res.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(body, want) {
+				t.Errorf("body = %v, want %v", body, want)
+			}
+
+			// Unknown paths are not calls, their 404 is left as is.
+			res, err := http.Get(addr + "/v1/unknown")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if ct := res.Header.Get("Content-Type"); res.StatusCode != http.StatusNotFound || ct == "application/problem+json" {
+				t.Errorf("unknown path: status %d, Content-Type %q", res.StatusCode, ct)
+			}
+		})
+	}
+}
+
+func TestRenderErrorsWithoutUpstreamStatus(t *testing.T) {
+	// The error written by the transcoder is rendered when the upstream
+	// could not be reached.
+	_, addr := newTestGateway(t,
+		WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+		WithUpstream(closedURL(t)),
+		WithErrorFormat(ErrorFormatGoogle),
+	)
+
+	res, body := getJSON(t, addr+"/v1/users/1")
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d", res.StatusCode)
+	}
+
+	e, _ := body.(map[string]any)["error"].(map[string]any)
+	if e["code"] != float64(http.StatusServiceUnavailable) || e["status"] != "UNAVAILABLE" {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestRenderErrorsLeavesOtherProtocols(t *testing.T) {
+	addr := newFailGateway(t, WithErrorFormat(ErrorFormatProblem))
+
+	// FailRequest has the encoding of Empty.
+	client := connect.NewClient[emptypb.Empty, emptypb.Empty](h2cClient(), addr+"/fail.v1.FailService/Fail", connect.WithGRPC())
+	_, err := client.CallUnary(context.Background(), connect.NewRequest(&emptypb.Empty{}))
+
+	var cerr *connect.Error
+	if !errors.As(err, &cerr) || cerr.Code() != connect.CodeNotFound || cerr.Message() != "no such thing" || len(cerr.Details()) != 3 {
+		t.Errorf("Fail = %v", err)
+	}
+}
+
+func TestUpstreamStatus(t *testing.T) {
+	st := failStatus(t)
+	bin, err := proto.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		write func(w http.ResponseWriter)
+		want  *spb.Status
+	}{
+		{
+			name: "success",
+			write: func(w http.ResponseWriter) {
+				w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+				w.WriteHeader(http.StatusOK)
+			},
+		},
+		{
+			name: "grpc trailers",
+			write: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusOK)
+				w.Header().Set(http.TrailerPrefix+"Grpc-Status", "5")
+				w.Header().Set(http.TrailerPrefix+"Grpc-Message", "no%20such%20thing")
+				w.Header().Set(http.TrailerPrefix+"Grpc-Status-Details-Bin", base64.StdEncoding.EncodeToString(bin))
+			},
+			want: st,
+		},
+		{
+			// The details of another code are ignored.
+			name: "mismatched details",
+			write: func(w http.ResponseWriter) {
+				w.Header().Set("Grpc-Status", "3")
+				w.Header().Set("Grpc-Message", "bad")
+				w.Header().Set("Grpc-Status-Details-Bin", base64.RawStdEncoding.EncodeToString(bin))
+				w.WriteHeader(http.StatusOK)
+			},
+			want: &spb.Status{Code: 3, Message: "bad"},
+		},
+		{
+			name: "connect",
+			write: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"code": "not_found", "message": "no such thing", "details": [{"type": "fail.v1.Reason", "value": "CgRnb25l"}]}`))
+			},
+			want: &spb.Status{Code: 5, Message: "no such thing", Details: st.Details[:1]},
+		},
+		{
+			name: "not an error body",
+			write: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadGateway)
+				_, _ = w.Write([]byte("bad gateway"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &statusWriter{ResponseWriter: httptest.NewRecorder()}
+			tt.write(w)
+
+			if got := w.status(); !proto.Equal(got, tt.want) {
+				t.Errorf("status = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultExplorerPath is where WithExplorer mounts the API explorer by
+// default.
+const DefaultExplorerPath = "/explorer/"
+
+//go:embed explorer
+var explorerFiles embed.FS
+
+// gatewayPaths are the paths the gateway serves besides the schema, which
+// the explorer must not shadow.
+var gatewayPaths = []string{
+	LivenessPath,
+	ReadinessPath,
+	MetricsPath,
+	OpenAPIJSONPath,
+	OpenAPIYAMLPath,
+	"/" + reflectionV1Service + "/",
+	"/" + reflectionV1AlphaService + "/",
+	"/" + healthpb.Health_ServiceDesc.ServiceName + "/",
+}
+
+// ValidateExplorerPath returns an error when the API explorer cannot be
+// mounted below path: the explorer would shadow the root or a path the
+// gateway serves besides the schema.
+func ValidateExplorerPath(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("invalid path %q, expected an absolute path", path)
+	}
+
+	prefix := explorerPrefix(path)
+	if prefix == "/" {
+		return errors.New("the explorer cannot be mounted at the root, it would shadow every route")
+	}
+
+	for _, p := range gatewayPaths {
+		if strings.HasPrefix(p, prefix) || strings.HasPrefix(prefix, p) && strings.HasSuffix(p, "/") {
+			return fmt.Errorf("path %q collides with %s", path, p)
+		}
+	}
+
+	return nil
+}
+
+// checkExplorerRoutes returns an error when a Connect or REST route of the
+// schema lies below the explorer path, since the explorer would shadow it.
+func checkExplorerRoutes(schema *Schema, path string) error {
+	prefix := explorerPrefix(path)
+	for _, svcDesc := range schema.Services {
+		procedures := "/" + string(svcDesc.FullName()) + "/"
+		if strings.HasPrefix(procedures, prefix) || strings.HasPrefix(prefix, procedures) {
+			return fmt.Errorf("explorer path %q collides with the routes of %s", path, svcDesc.FullName())
+		}
+
+		methods := svcDesc.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			rule, ok := proto.GetExtension(methods.Get(i).Options(), annotations.E_Http).(*annotations.HttpRule)
+			if !ok || rule == nil {
+				continue
+			}
+
+			for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+				if method, template := httpRulePattern(r); overlapsTemplate(template, prefix) {
+					return fmt.Errorf("explorer path %q collides with the route %s %s of %s",
+						path, method, template, methods.Get(i).FullName())
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// explorerPrefix returns the prefix of the paths the explorer serves.
+func explorerPrefix(path string) string {
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	return path
+}
+
+// mountExplorer mounts the API explorer below path. The explorer only loads
+// the OpenAPI document, which it polls to follow reloads, so its files do
+// not depend on the schema.
+func mountExplorer(mux *http.ServeMux, path string) {
+	path = explorerPrefix(path)
+
+	files, _ := fs.Sub(explorerFiles, "explorer")
+	mux.Handle("GET "+path, http.StripPrefix(path, http.FileServerFS(files)))
+}
@@ -0,0 +1,425 @@
+// The explorer renders the OpenAPI document of the gateway and sends REST
+// and Connect requests through it. The document is polled so that the
+// explorer follows schema reloads.
+(function () {
+  'use strict';
+
+  const specURL = document.documentElement.dataset.spec;
+  const pollInterval = 3000;
+  const methods = ['get', 'put', 'post', 'delete', 'options', 'head', 'patch', 'trace'];
+  const refPrefix = '#/components/schemas/';
+
+  let spec = null;
+  let etag = null;
+  // selected is the displayed operation, identified by path and method.
+  let selected = null;
+  let rendered = null;
+
+  function el(tag, props, ...children) {
+    const node = document.createElement(tag);
+    Object.assign(node, props);
+    for (const child of children) {
+      if (child != null) {
+        node.append(child);
+      }
+    }
+
+    return node;
+  }
+
+  async function load() {
+    const headers = etag ? { 'If-None-Match': etag } : {};
+
+    let res;
+    try {
+      res = await fetch(specURL, { headers, cache: 'no-cache' });
+    } catch (err) {
+      return;
+    }
+
+    if (res.status === 304 || !res.ok) {
+      return;
+    }
+
+    const reloaded = spec !== null;
+    spec = await res.json();
+    etag = res.headers.get('ETag');
+
+    document.getElementById('title').textContent = spec.info.title;
+    document.getElementById('version').textContent = spec.info.version;
+    if (reloaded) {
+      notify('Schema reloaded');
+    }
+
+    renderNav();
+    renderOperation();
+  }
+
+  function notify(text) {
+    const notice = document.getElementById('notice');
+    notice.textContent = text;
+    notice.hidden = false;
+    clearTimeout(notify.timer);
+    notify.timer = setTimeout(() => { notice.hidden = true; }, 4000);
+  }
+
+  // operations returns the operations of the document grouped by tag.
+  function operations() {
+    const groups = new Map();
+    for (const tag of spec.tags || []) {
+      groups.set(tag.name, { tag, entries: [] });
+    }
+
+    for (const [path, item] of Object.entries(spec.paths)) {
+      for (const method of methods) {
+        const op = item[method];
+        if (!op) {
+          continue;
+        }
+
+        const name = (op.tags && op.tags[0]) || '';
+        if (!groups.has(name)) {
+          groups.set(name, { tag: { name }, entries: [] });
+        }
+
+        groups.get(name).entries.push({ path, method, op });
+      }
+    }
+
+    for (const group of groups.values()) {
+      group.entries.sort((a, b) => a.op.operationId.localeCompare(b.op.operationId));
+    }
+
+    return [...groups.values()];
+  }
+
+  function find(path, method) {
+    const item = spec.paths[path];
+    return item && item[method] ? { path, method, op: item[method] } : null;
+  }
+
+  function renderNav() {
+    const filter = document.getElementById('filter').value.toLowerCase();
+    const services = document.getElementById('services');
+    services.replaceChildren();
+
+    for (const { tag, entries } of operations()) {
+      const matching = entries.filter((e) => !filter ||
+        e.op.operationId.toLowerCase().includes(filter) ||
+        e.path.toLowerCase().includes(filter) ||
+        (e.op.summary || '').toLowerCase().includes(filter));
+      if (matching.length === 0) {
+        continue;
+      }
+
+      services.append(el('h2', { textContent: tag.name }));
+      if (tag.description) {
+        services.append(el('p', { textContent: tag.description }));
+      }
+
+      for (const entry of matching) {
+        const link = el('a', { href: '#', title: entry.op.summary || entry.op.operationId },
+          el('span', { className: 'method ' + entry.method, textContent: entry.method }),
+          el('code', { textContent: entry.path }));
+        if (selected && selected.path === entry.path && selected.method === entry.method) {
+          link.className = 'selected';
+        }
+
+        link.addEventListener('click', (event) => {
+          event.preventDefault();
+          selected = { path: entry.path, method: entry.method, mode: 'rest' };
+          renderNav();
+          renderOperation();
+        });
+
+        services.append(link);
+      }
+    }
+  }
+
+  function renderOperation() {
+    const section = document.getElementById('operation');
+    const entry = selected && find(selected.path, selected.method);
+    if (!entry) {
+      rendered = null;
+      section.replaceChildren(el('p', {
+        className: 'empty',
+        textContent: selected ? 'The method is no longer served.' : 'Select a method to send a request.',
+      }));
+      return;
+    }
+
+    // Keep the values typed so far unless the operation itself changed.
+    const key = JSON.stringify([entry, selected.mode]);
+    if (key === rendered) {
+      return;
+    }
+
+    rendered = key;
+
+    const { op } = entry;
+    const connect = op['x-connect'];
+    if (selected.mode === 'connect' && !connect) {
+      selected.mode = 'rest';
+    }
+
+    section.replaceChildren(
+      el('h2', {},
+        el('span', { className: 'method ' + entry.method, textContent: entry.method + ' ' }),
+        entry.path),
+      el('p', { className: 'hint', textContent: op.operationId }),
+      op.deprecated ? el('p', { className: 'deprecated', textContent: 'Deprecated' }) : null,
+      op.summary ? el('p', { textContent: op.summary }) : null,
+      op.description ? el('p', { className: 'description', textContent: op.description }) : null);
+
+    const tabs = el('div', { className: 'tabs' });
+    for (const [mode, label] of [['rest', 'REST'], ['connect', 'Connect']]) {
+      if (mode === 'connect' && !connect) {
+        continue;
+      }
+
+      const button = el('button', { textContent: label, className: selected.mode === mode ? 'active' : '' });
+      button.addEventListener('click', () => {
+        selected.mode = mode;
+        renderOperation();
+      });
+      tabs.append(button);
+    }
+
+    section.append(tabs);
+
+    const form = selected.mode === 'connect' ? connectForm(connect) : restForm(entry);
+    const headers = el('textarea', { placeholder: 'Authorization: Bearer ...', rows: 2 });
+    headers.style.minHeight = '48px';
+    const output = el('div');
+    const send = el('button', { className: 'send', textContent: 'Send' });
+    send.addEventListener('click', async () => {
+      const started = performance.now();
+      output.replaceChildren(el('p', { className: 'hint', textContent: 'Sending...' }));
+      try {
+        const { url, init } = form.request();
+        Object.assign(init.headers, parseHeaders(headers.value));
+        const res = await fetch(url, init);
+        await renderResponse(output, res, performance.now() - started);
+      } catch (err) {
+        output.replaceChildren(el('pre', { className: 'status-error', textContent: String(err) }));
+      }
+    });
+
+    section.append(form.node, el('h3', { textContent: 'Headers' }), headers, send, output);
+  }
+
+  function restForm(entry) {
+    const { op } = entry;
+    const node = el('div');
+    const inputs = [];
+
+    if (op.parameters && op.parameters.length > 0) {
+      const table = el('table');
+      for (const param of op.parameters) {
+        const input = el('input', { placeholder: typeLabel(param.schema) });
+        const values = param.schema && param.schema.enum;
+        if (param.in === 'header' && values && values.length === 1) {
+          input.value = values[0];
+        }
+
+        inputs.push({ param, input });
+        table.append(el('tr', {},
+          el('td', {}, el('code', { textContent: param.name + (param.required ? ' *' : '') }),
+            el('div', { className: 'hint', textContent: param.in })),
+          el('td', {}, input, param.description ? el('div', { className: 'hint', textContent: param.description }) : null)));
+      }
+
+      node.append(el('h3', { textContent: 'Parameters' }), table);
+    }
+
+    let body = null;
+    let contentType = null;
+    const content = op.requestBody && op.requestBody.content;
+    if (content && content['application/json']) {
+      body = el('textarea', { value: JSON.stringify(example(content['application/json'].schema), null, 2) });
+      contentType = 'application/json';
+    } else if (content) {
+      // google.api.HttpBody accepts any content, typed by the caller.
+      contentType = el('input', { value: 'text/plain' });
+      body = el('textarea');
+      node.append(el('h3', { textContent: 'Content type' }), contentType);
+    }
+
+    if (body) {
+      node.append(el('h3', { textContent: 'Body' }), body);
+    }
+
+    function request() {
+      let path = entry.path.replace(/\{([^}]+)\}/g, (_, name) => {
+        const found = inputs.find((i) => i.param.in === 'path' && i.param.name === name);
+        const value = found ? found.input.value : '';
+        // Variables such as {name=shelves/*} span several segments.
+        return value.split('/').map(encodeURIComponent).join('/');
+      });
+
+      const query = new URLSearchParams();
+      for (const { param, input } of inputs) {
+        if (param.in !== 'query' || input.value === '') {
+          continue;
+        }
+
+        const values = param.schema && param.schema.type === 'array' ? input.value.split(',') : [input.value];
+        for (const value of values) {
+          query.append(param.name, value.trim());
+        }
+      }
+
+      if ([...query].length > 0) {
+        path += '?' + query;
+      }
+
+      const init = { method: entry.method.toUpperCase(), headers: {} };
+      for (const { param, input } of inputs) {
+        if (param.in === 'header' && input.value !== '') {
+          init.headers[param.name] = input.value;
+        }
+      }
+
+      if (body) {
+        init.body = body.value;
+        init.headers['Content-Type'] = typeof contentType === 'string' ? contentType : contentType.value;
+      }
+
+      return { url: path, init };
+    }
+
+    return { node, request };
+  }
+
+  function connectForm(connect) {
+    const body = el('textarea', { value: JSON.stringify(example(connect.request), null, 2) });
+    const node = el('div', {},
+      el('p', { className: 'hint' }, 'POST ', el('code', { textContent: connect.procedure })),
+      el('h3', { textContent: 'Request' }), body);
+
+    function request() {
+      return {
+        url: connect.procedure,
+        init: {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json', 'Connect-Protocol-Version': '1' },
+          body: body.value || '{}',
+        },
+      };
+    }
+
+    return { node, request };
+  }
+
+  function parseHeaders(text) {
+    const headers = {};
+    for (const line of text.split('\n')) {
+      const index = line.indexOf(':');
+      if (index > 0) {
+        headers[line.slice(0, index).trim()] = line.slice(index + 1).trim();
+      }
+    }
+
+    return headers;
+  }
+
+  async function renderResponse(output, res, elapsed) {
+    let text = await res.text();
+    const type = res.headers.get('Content-Type') || '';
+    if (type.includes('json')) {
+      try {
+        text = JSON.stringify(JSON.parse(text), null, 2);
+      } catch (err) {
+        // Shown as received.
+      }
+    }
+
+    output.replaceChildren(
+      el('h3', {},
+        el('span', { className: res.ok ? 'status-ok' : 'status-error', textContent: res.status + ' ' + res.statusText }),
+        el('span', { className: 'hint', textContent: ` ${Math.round(elapsed)} ms ${type}` })),
+      el('pre', { textContent: text }));
+  }
+
+  function resolve(schema) {
+    if (schema && schema.$ref && schema.$ref.startsWith(refPrefix)) {
+      return spec.components.schemas[schema.$ref.slice(refPrefix.length)];
+    }
+
+    return schema;
+  }
+
+  function typeLabel(schema) {
+    schema = resolve(schema) || {};
+    if (schema.enum) {
+      return schema.enum.join(' | ');
+    }
+
+    if (schema.type === 'array') {
+      return typeLabel(schema.items) + ', ...';
+    }
+
+    const type = Array.isArray(schema.type) ? schema.type.join(' | ') : schema.type || 'any';
+    return schema.format ? `${type} (${schema.format})` : type;
+  }
+
+  // example returns a value matching the schema, used to prefill bodies.
+  // seen holds the messages being expanded so that recursion stops.
+  function example(schema, seen = new Set()) {
+    if (!schema) {
+      return null;
+    }
+
+    if (schema.$ref) {
+      const name = schema.$ref.slice(refPrefix.length);
+      if (seen.has(name)) {
+        return {};
+      }
+
+      return example(resolve(schema), new Set(seen).add(name));
+    }
+
+    if (schema.enum) {
+      return schema.enum[0];
+    }
+
+    const type = Array.isArray(schema.type) ? schema.type.find((t) => t !== 'null') : schema.type;
+    switch (type) {
+      case 'object': {
+        const value = {};
+        for (const [name, prop] of Object.entries(schema.properties || {})) {
+          if (!prop.readOnly) {
+            value[name] = example(prop, seen);
+          }
+        }
+
+        return value;
+      }
+      case 'array':
+        return [];
+      case 'string':
+        if (schema.format === 'date-time') {
+          return new Date().toISOString();
+        }
+
+        if (schema.format === 'int64' || schema.format === 'uint64') {
+          return '0';
+        }
+
+        return schema.pattern ? '0s' : '';
+      case 'integer':
+      case 'number':
+        return 0;
+      case 'boolean':
+        return false;
+      default:
+        return null;
+    }
+  }
+
+  document.getElementById('filter').addEventListener('input', renderNav);
+
+  load();
+  setInterval(load, pollInterval);
+})();
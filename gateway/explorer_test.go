@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExplorer(t *testing.T) {
+	tests := []struct {
+		path string
+		root string
+	}{
+		{path: "", root: DefaultExplorerPath},
+		{path: "/ui", root: "/ui/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.root, func(t *testing.T) {
+			g, _ := newUserGateway(t, WithExplorer(tt.path))
+
+			w := serve(g, tt.root, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d", w.Code)
+			}
+
+			// The page loads the document WithExplorer serves along with it.
+			if !strings.Contains(w.Body.String(), `data-spec="`+OpenAPIJSONPath+`"`) {
+				t.Errorf("page does not load %s:\n%s", OpenAPIJSONPath, w.Body)
+			}
+
+			for _, path := range []string{tt.root + "explorer.js", tt.root + "explorer.css", OpenAPIJSONPath} {
+				if w := serve(g, path, nil); w.Code != http.StatusOK {
+					t.Errorf("status of %s = %d", path, w.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestExplorerPathCollisions(t *testing.T) {
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{path: "/", err: "cannot be mounted at the root"},
+		{path: "/v1", err: "the route GET /v1/users/{page=*} of user.v1.UserService.List"},
+		{path: "/v1/users/", err: "the route GET /v1/users/{page=*}"},
+		{path: "/user.v1.UserService/", err: "the routes of user.v1.UserService"},
+		{path: "/user.v1.UserService/List/", err: "the routes of user.v1.UserService"},
+		{path: "/grpc.health.v1.Health/", err: "collides with /grpc.health.v1.Health/"},
+		{path: "/v1/users/1/"},
+		{path: "/v2/"},
+		{path: "/user/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := New(context.Background(),
+				WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+				WithUpstream(&url.URL{Scheme: "http", Host: "localhost"}),
+				WithExplorer(tt.path),
+			)
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("New = %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("New = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
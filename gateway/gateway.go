@@ -0,0 +1,351 @@
+// Package gateway serves gRPC, gRPC-Web, Connect and REST clients in front of
+// a gRPC backend using protobuf descriptors loaded at runtime, so no
+// generated code is required.
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"connectrpc.com/grpcreflect"
+	"connectrpc.com/vanguard"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var (
+	// ErrNoSchemaSource is returned by New when no SchemaSource is configured.
+	ErrNoSchemaSource = errors.New("gateway: no schema source configured")
+	// ErrNoUpstream is returned by New when no upstream is configured.
+	ErrNoUpstream = errors.New("gateway: no upstream configured")
+)
+
+// Gateway transcodes incoming requests for the services of a Schema and
+// proxies them to the upstream.
+type Gateway struct {
+	opts *options
+	// metrics is nil unless WithMetrics is set.
+	metrics *gatewayMetrics
+
+	// reloadMu serializes reloads, requests only read state.
+	reloadMu sync.Mutex
+	state    atomic.Pointer[state]
+	// reaching holds the upstreams probed until one of their endpoints is
+	// reached, see reach.
+	reaching sync.Map
+
+	// drain tracks the requests in flight. closing is canceled when the
+	// gateway starts shutting down, abort when the requests still in flight
+	// must be canceled.
+	drain         drain
+	closing       context.Context
+	closeLocal    context.CancelFunc
+	abort         context.Context
+	abortRequests context.CancelFunc
+}
+
+// state is the schema served by the gateway and the handler built from it.
+// It is replaced as a whole on reload so in-flight requests keep using the
+// handler they started with.
+type state struct {
+	schema  *Schema
+	hash    string
+	handler http.Handler
+	// upstreams lists the services proxied to every upstream.
+	upstreams map[*Upstream][]string
+	// replaced is closed once the state is no longer served.
+	replaced chan struct{}
+}
+
+// New loads the schema from the configured source and builds the gateway.
+func New(ctx context.Context, opts ...Option) (*Gateway, error) {
+	o := newOptions(opts...)
+	if o.source == nil {
+		return nil, ErrNoSchemaSource
+	}
+
+	if o.upstream == nil && o.routes.empty() {
+		return nil, ErrNoUpstream
+	}
+
+	g := &Gateway{
+		opts: o,
+	}
+
+	if o.metrics {
+		var err error
+		if g.metrics, err = newMetrics(o.registerer); err != nil {
+			return nil, err
+		}
+	}
+
+	g.closing, g.closeLocal = context.WithCancel(context.Background())
+	g.abort, g.abortRequests = context.WithCancel(context.Background())
+
+	schema, err := o.source.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not load schema: %w", err)
+	}
+
+	st, err := g.newState(schema, schema.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	g.state.Store(st)
+
+	return g, nil
+}
+
+// Schema returns the schema currently served by the gateway.
+func (g *Gateway) Schema() *Schema {
+	return g.state.Load().schema
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.track(w, r, g.state.Load().handler)
+}
+
+// Reload loads the schema from the source again and, when its content hash
+// differs from the served one, atomically swaps the handler. Requests already
+// in flight complete with the previous handler. The gateway keeps serving the
+// previous schema when reloading fails.
+func (g *Gateway) Reload(ctx context.Context) error {
+	result, err := g.reload(ctx)
+	g.metrics.schemaReloaded(result)
+
+	return err
+}
+
+// reload implements Reload, returning its result as recorded in metrics.
+func (g *Gateway) reload(ctx context.Context) (string, error) {
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+
+	schema, err := g.opts.source.Load(ctx)
+	if err != nil {
+		return "failure", fmt.Errorf("could not load schema: %w", err)
+	}
+
+	hash := schema.Hash()
+	if hash == g.state.Load().hash {
+		log.Debug().Str("hash", hash).Msg("schema unchanged")
+		return "unchanged", nil
+	}
+
+	st, err := g.newState(schema, hash)
+	if err != nil {
+		return "failure", err
+	}
+
+	prev := g.state.Swap(st)
+	close(prev.replaced)
+
+	added, removed := diffMethods(prev.schema, schema)
+	log.Info().
+		Strs("added", added).
+		Strs("removed", removed).
+		Str("hash", hash).
+		Msg("schema reloaded")
+
+	return "success", nil
+}
+
+// ListenAndServe serves the gateway on addr, accepting HTTP/1.1 and h2c. The
+// address is either a TCP host:port or a unix:// socket URL, see Listen.
+func (g *Gateway) ListenAndServe(addr string) error {
+	ln, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+
+	return g.NewServer(addr).Serve(ln)
+}
+
+// NewServer returns an HTTP server for the gateway on addr, accepting
+// HTTP/1.1 and h2c.
+func (g *Gateway) NewServer(addr string) *http.Server {
+	h2s := &http2.Server{}
+	srv := &http.Server{
+		Addr: addr,
+		// We use the h2c package in order to support HTTP/2 without TLS,
+		// so we can handle gRPC requests, which requires HTTP/2, in
+		// addition to Connect and gRPC-Web (which work with HTTP 1.1).
+		Handler: h2c.NewHandler(
+			g,
+			h2s,
+		),
+	}
+
+	// Configuring the HTTP/2 server registers the h2c connections with the
+	// server, so that Shutdown sends them a GOAWAY frame. It also sets a TLS
+	// configuration, which a cleartext server does not need.
+	_ = http2.ConfigureServer(srv, h2s)
+	srv.TLSConfig = nil
+
+	return srv
+}
+
+// NewTLSServer returns an HTTPS server for the gateway on addr, negotiating
+// HTTP/2 or HTTP/1.1 with ALPN. It is started with ListenAndServeTLS("", "")
+// since the certificates come from config.
+func (g *Gateway) NewTLSServer(addr string, config *tls.Config) *http.Server {
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   g,
+		TLSConfig: config,
+	}
+
+	// ConfigureServer only fails when the TLS configuration forbids the
+	// ciphers HTTP/2 requires, which NewServerTLSConfig never does.
+	_ = http2.ConfigureServer(srv, &http2.Server{})
+
+	return srv
+}
+
+func (g *Gateway) newState(schema *Schema, hash string) (*state, error) {
+	upstreams := make(map[*Upstream][]string)
+	for _, svcDesc := range schema.Services {
+		upstream, err := g.upstreamOf(schema, svcDesc.FullName())
+		if err != nil {
+			return nil, err
+		}
+
+		upstreams[upstream] = append(upstreams[upstream], string(svcDesc.FullName()))
+	}
+
+	handler, err := g.newHandler(schema, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state{
+		schema:    schema,
+		hash:      hash,
+		handler:   handler,
+		upstreams: upstreams,
+		replaced:  make(chan struct{}),
+	}, nil
+}
+
+// upstreamOf returns the upstream a service is proxied to: the one of the
+// first matching route, the one the service was discovered on, or the default
+// upstream.
+func (g *Gateway) upstreamOf(schema *Schema, name protoreflect.FullName) (*Upstream, error) {
+	upstream, ok := g.opts.routes.lookup(name)
+	if !ok {
+		upstream, ok = schema.Upstreams[name]
+	}
+
+	if !ok {
+		upstream = g.opts.upstream
+	}
+
+	if upstream == nil {
+		return nil, fmt.Errorf("no upstream for service %q", name)
+	}
+
+	return upstream, nil
+}
+
+func (g *Gateway) newHandler(schema *Schema, hash string) (http.Handler, error) {
+	handler, err := g.newTranscoder(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.opts.reflection || g.opts.health || g.opts.openAPI || g.opts.metrics {
+		mux := http.NewServeMux()
+		if g.opts.reflection {
+			reflector := g.newReflector()
+
+			mux.Handle(g.localHandler(grpcreflect.NewHandlerV1(reflector)))
+			// Many tools still expect the older version of the server reflection API, so
+			// most servers should mount both handlers.
+			mux.Handle(g.localHandler(grpcreflect.NewHandlerV1Alpha(reflector)))
+		}
+
+		if g.opts.health {
+			g.mountHealth(mux)
+		}
+
+		if g.opts.openAPI {
+			if err = mountOpenAPI(mux, schema, hash); err != nil {
+				return nil, err
+			}
+		}
+
+		if g.opts.explorerPath != "" {
+			if err = ValidateExplorerPath(g.opts.explorerPath); err != nil {
+				return nil, fmt.Errorf("invalid explorer path: %w", err)
+			}
+
+			if err = checkExplorerRoutes(schema, g.opts.explorerPath); err != nil {
+				return nil, err
+			}
+
+			mountExplorer(mux, g.opts.explorerPath)
+		}
+
+		if g.opts.metrics {
+			mux.Handle("GET "+MetricsPath, metricsHandler(g.opts.registerer))
+		}
+
+		mux.Handle("/", handler)
+		handler = mux
+	}
+
+	return chain(handler, g.opts.middleware), nil
+}
+
+func (g *Gateway) newTranscoder(schema *Schema) (http.Handler, error) {
+	// Proxies are shared by every service routed to the same upstream.
+	proxies := make(map[*Upstream]http.Handler)
+
+	types := dynamicpb.NewTypes(schema.Files)
+	svcOpts := append([]vanguard.ServiceOption{
+		vanguard.WithTypeResolver(types),
+	}, g.opts.serviceOptions...)
+
+	services := make([]*vanguard.Service, 0, len(schema.Services))
+	for _, svcDesc := range schema.Services {
+		upstream, err := g.upstreamOf(schema, svcDesc.FullName())
+		if err != nil {
+			return nil, err
+		}
+
+		proxy, ok := proxies[upstream]
+		if !ok {
+			proxy = upstream.newProxy(g.opts.transport, g.metrics)
+			proxies[upstream] = proxy
+		}
+
+		svc := vanguard.NewServiceWithSchema(
+			svcDesc,
+			withMethods(proxy, svcDesc, types),
+			svcOpts...,
+		)
+
+		services = append(services, svc)
+	}
+
+	transcoder, err := vanguard.NewTranscoder(services)
+	if err != nil {
+		return nil, fmt.Errorf("could not create transcoder: %w", err)
+	}
+
+	if g.opts.errorFormat != "" {
+		return renderErrors(transcoder, g.opts.errorFormat, types), nil
+	}
+
+	return transcoder, nil
+}
@@ -0,0 +1,214 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpcreflect"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	userv1 "github.com/anhnmt/gprc-dynamic-proto/proto/gengo/user/v1"
+	"github.com/anhnmt/gprc-dynamic-proto/proto/gengo/user/v1/userv1connect"
+)
+
+// testImportPaths resolve the user.v1 fixture and the googleapis it imports.
+var testImportPaths = []string{"../proto", "../googleapis"}
+
+// userService implements user.v1.UserService for the tests, listing a
+// single user whose ID is the requested page.
+type userService struct {
+	userv1connect.UnimplementedUserServiceHandler
+}
+
+func (userService) List(_ context.Context, req *connect.Request[userv1.ListRequest]) (*connect.Response[userv1.ListResponse], error) {
+	if req.Msg.GetPage() < 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("negative page"))
+	}
+
+	return connect.NewResponse(&userv1.ListResponse{
+		Data: []*userv1.User{{
+			Id:   strconv.Itoa(int(req.Msg.GetPage())),
+			Name: "Alice",
+		}},
+	}), nil
+}
+
+// newUpstream serves handler over h2c and returns its URL.
+func newUpstream(t *testing.T, handler http.Handler) *url.URL {
+	t.Helper()
+
+	srv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	t.Cleanup(srv.Close)
+
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return target
+}
+
+// userUpstream serves userService along with the server reflection of its
+// generated descriptors.
+func userUpstream() http.Handler {
+	reflector := grpcreflect.NewStaticReflector(userv1connect.UserServiceName)
+
+	mux := http.NewServeMux()
+	mux.Handle(userv1connect.NewUserServiceHandler(userService{}))
+	mux.Handle(grpcreflect.NewHandlerV1(reflector))
+	mux.Handle(grpcreflect.NewHandlerV1Alpha(reflector))
+
+	return mux
+}
+
+// newUserUpstream serves userUpstream over h2c.
+func newUserUpstream(t *testing.T) *url.URL {
+	t.Helper()
+
+	return newUpstream(t, userUpstream())
+}
+
+// newTestGateway builds a gateway with opts, serves it over HTTP/1.1 and
+// h2c and returns its URL.
+func newTestGateway(t *testing.T, opts ...Option) (*Gateway, string) {
+	t.Helper()
+
+	g, err := New(context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("could not create gateway: %v", err)
+	}
+
+	srv := httptest.NewServer(g.NewServer("").Handler)
+	t.Cleanup(srv.Close)
+
+	return g, srv.URL
+}
+
+// newUserGateway serves the user.v1 fixture in front of userService.
+func newUserGateway(t *testing.T, opts ...Option) (*Gateway, string) {
+	t.Helper()
+
+	return newTestGateway(t, append([]Option{
+		WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+		WithUpstream(newUserUpstream(t)),
+	}, opts...)...)
+}
+
+// h2cClient reaches the test servers over h2c, which every protocol
+// accepts.
+func h2cClient() *http.Client {
+	return &http.Client{Transport: NewH2CTransport()}
+}
+
+func TestNewRequiresSourceAndUpstream(t *testing.T) {
+	source := NewParserSource(testImportPaths, "user/v1/user.proto")
+
+	if _, err := New(context.Background(), WithUpstream(&url.URL{Host: "localhost"})); !errors.Is(err, ErrNoSchemaSource) {
+		t.Errorf("New without a source = %v, want %v", err, ErrNoSchemaSource)
+	}
+
+	if _, err := New(context.Background(), WithSchemaSource(source)); !errors.Is(err, ErrNoUpstream) {
+		t.Errorf("New without an upstream = %v, want %v", err, ErrNoUpstream)
+	}
+}
+
+func TestNewFailsOnSchemaError(t *testing.T) {
+	_, err := New(context.Background(),
+		WithSchemaSource(NewParserSource(testImportPaths, "user/v1/missing.proto")),
+		WithUpstream(&url.URL{Host: "localhost"}),
+	)
+	if err == nil {
+		t.Fatal("New succeeded with a missing proto file")
+	}
+}
+
+func TestServeHTTPProtocols(t *testing.T) {
+	_, addr := newUserGateway(t)
+
+	tests := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpc-web", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+		{name: "connect"},
+		{name: "connect json", opts: []connect.ClientOption{connect.WithProtoJSON()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := userv1connect.NewUserServiceClient(h2cClient(), addr, tt.opts...)
+
+			res, err := client.List(context.Background(), connect.NewRequest(&userv1.ListRequest{Page: 2}))
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+
+			if data := res.Msg.GetData(); len(data) != 1 || data[0].GetId() != "2" || data[0].GetName() != "Alice" {
+				t.Errorf("List returned %v", data)
+			}
+
+			_, err = client.List(context.Background(), connect.NewRequest(&userv1.ListRequest{Page: -1}))
+			if code := connect.CodeOf(err); code != connect.CodeInvalidArgument {
+				t.Errorf("List of a negative page returned %v, want %v", code, connect.CodeInvalidArgument)
+			}
+		})
+	}
+}
+
+func TestServeHTTPREST(t *testing.T) {
+	_, addr := newUserGateway(t)
+
+	res, err := http.Get(addr + "/v1/users/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+
+	var body struct {
+		Data []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Data) != 1 || body.Data[0].ID != "3" || body.Data[0].Name != "Alice" {
+		t.Errorf("body = %+v", body)
+	}
+
+	res, err = http.Get(addr + "/v1/users/-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("status of an invalid argument = %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+
+	res, err = http.Get(addr + "/v1/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("status of an unknown route = %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,353 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/rs/zerolog/log"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Defaults of HealthCheck.
+const (
+	DefaultHealthCheckTimeout = time.Second
+	DefaultUnhealthyThreshold = 3
+	DefaultHealthyThreshold   = 2
+	DefaultEjectionTime       = 30 * time.Second
+)
+
+const healthCheckProcedure = "/grpc.health.v1.Health/Check"
+
+// HealthCheck configures the health checking of the endpoints of an
+// upstream. Endpoints are ejected from balancing after UnhealthyThreshold
+// consecutive failures, either failed requests (passive checks) or failed
+// probes (active checks), and re-admitted after HealthyThreshold consecutive
+// successes. When every endpoint is ejected, all of them are used so that
+// a failing check cannot take the whole upstream down.
+type HealthCheck struct {
+	// Interval is the period of the active probes, which call the
+	// grpc.health.v1.Health/Check method of every endpoint for each service
+	// proxied to the upstream. Zero disables active checks.
+	Interval time.Duration
+	// Timeout bounds every probe, DefaultHealthCheckTimeout when zero.
+	Timeout time.Duration
+	// UnhealthyThreshold is DefaultUnhealthyThreshold when zero.
+	UnhealthyThreshold int
+	// HealthyThreshold is DefaultHealthyThreshold when zero.
+	HealthyThreshold int
+	// EjectionTime is how long an endpoint ejected by passive checks stays
+	// ejected when active checks are disabled, DefaultEjectionTime when zero.
+	EjectionTime time.Duration
+}
+
+func (h *HealthCheck) timeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+
+	return DefaultHealthCheckTimeout
+}
+
+func (h *HealthCheck) unhealthyThreshold() int {
+	if h.UnhealthyThreshold > 0 {
+		return h.UnhealthyThreshold
+	}
+
+	return DefaultUnhealthyThreshold
+}
+
+func (h *HealthCheck) healthyThreshold() int {
+	if h.HealthyThreshold > 0 {
+		return h.HealthyThreshold
+	}
+
+	return DefaultHealthyThreshold
+}
+
+func (h *HealthCheck) ejectionTime() time.Duration {
+	if h.EjectionTime > 0 {
+		return h.EjectionTime
+	}
+
+	return DefaultEjectionTime
+}
+
+// endpointHealth is the health checking state of an endpoint.
+type endpointHealth struct {
+	mu        sync.Mutex
+	ejected   bool
+	ejectedAt time.Time
+	failures  int
+	successes int
+}
+
+// Healthy reports whether the endpoint takes part in load balancing.
+func (e *Endpoint) Healthy() bool {
+	e.health.mu.Lock()
+	defer e.health.mu.Unlock()
+
+	return !e.health.ejected
+}
+
+// reportFailure records a failed request or probe, ejecting the endpoint
+// once the upstream threshold is reached.
+func (e *Endpoint) reportFailure(u *Upstream, m *gatewayMetrics, reason error) {
+	if u.HealthCheck == nil {
+		return
+	}
+
+	e.health.mu.Lock()
+	defer e.health.mu.Unlock()
+
+	e.health.successes = 0
+	e.health.failures++
+	if e.health.ejected || e.health.failures < u.HealthCheck.unhealthyThreshold() {
+		return
+	}
+
+	e.health.ejected = true
+	e.health.ejectedAt = time.Now()
+	m.endpointEjected(u, e)
+	m.endpointHealth(u, e, false)
+
+	log.Warn().
+		Err(reason).
+		Str("upstream", u.Name).
+		Str("endpoint", e.String()).
+		Int("failures", e.health.failures).
+		Msg("upstream endpoint ejected")
+}
+
+// reportSuccess records a successful request or probe, re-admitting an
+// ejected endpoint once the upstream threshold is reached.
+func (e *Endpoint) reportSuccess(u *Upstream, m *gatewayMetrics) {
+	e.reached.Store(true)
+	if u.HealthCheck == nil {
+		return
+	}
+
+	e.health.mu.Lock()
+	defer e.health.mu.Unlock()
+
+	e.health.failures = 0
+	if !e.health.ejected {
+		return
+	}
+
+	e.health.successes++
+	if e.health.successes < u.HealthCheck.healthyThreshold() {
+		return
+	}
+
+	e.readmit(u, m)
+}
+
+// expire re-admits an endpoint ejected for longer than the ejection time,
+// which only applies when the upstream is not actively checked.
+func (e *Endpoint) expire(u *Upstream, m *gatewayMetrics, now time.Time) {
+	if u.HealthCheck == nil || u.HealthCheck.Interval > 0 {
+		return
+	}
+
+	e.health.mu.Lock()
+	defer e.health.mu.Unlock()
+
+	if e.health.ejected && now.Sub(e.health.ejectedAt) >= u.HealthCheck.ejectionTime() {
+		e.readmit(u, m)
+	}
+}
+
+// readmit must be called with the health lock held.
+func (e *Endpoint) readmit(u *Upstream, m *gatewayMetrics) {
+	e.health.ejected = false
+	e.health.failures = 0
+	e.health.successes = 0
+	m.endpointHealth(u, e, true)
+
+	log.Info().
+		Str("upstream", u.Name).
+		Str("endpoint", e.String()).
+		Msg("upstream endpoint re-admitted")
+}
+
+// available returns the endpoints taking part in load balancing, every
+// endpoint when all of them are ejected.
+func (u *Upstream) available(m *gatewayMetrics) []*Endpoint {
+	endpoints := u.cluster()
+	if u.HealthCheck == nil {
+		return endpoints
+	}
+
+	now := time.Now()
+	healthy := make([]*Endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		e.expire(u, m, now)
+		if e.Healthy() {
+			healthy = append(healthy, e)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return endpoints
+	}
+
+	return healthy
+}
+
+// CheckHealth actively probes the endpoints of every upstream with a
+// HealthCheck interval until ctx is done, following the upstreams and
+// services of the served schema across reloads. It always returns nil.
+func (g *Gateway) CheckHealth(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	probing := make(map[*Upstream]struct{})
+	for {
+		st := g.state.Load()
+		for upstream := range st.upstreams {
+			if _, ok := probing[upstream]; ok || upstream.HealthCheck == nil || upstream.HealthCheck.Interval <= 0 {
+				continue
+			}
+
+			probing[upstream] = struct{}{}
+			wg.Add(1)
+			go func(upstream *Upstream) {
+				defer wg.Done()
+				g.probeUpstream(ctx, upstream)
+			}(upstream)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-st.replaced:
+		}
+	}
+}
+
+func (g *Gateway) probeUpstream(ctx context.Context, u *Upstream) {
+	clients := g.healthClients(u)
+
+	ticker := time.NewTicker(u.HealthCheck.Interval)
+	defer ticker.Stop()
+
+	for {
+		// The services are read on every round so that reloads are followed.
+		services := g.state.Load().upstreams[u]
+		for _, e := range u.cluster() {
+			if !probe(ctx, u, g.metrics, e, clients[e], u.HealthCheck.timeout(), services) {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthClients returns the health checking clients of the endpoints of the
+// upstream.
+func (g *Gateway) healthClients(u *Upstream) map[*Endpoint]*connect.Client[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse] {
+	transport := u.Transport
+	if transport == nil {
+		transport = g.opts.transport
+	}
+
+	clients := make(map[*Endpoint]*connect.Client[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse])
+	for _, e := range u.cluster() {
+		httpClient := &http.Client{
+			Transport: e.roundTripper(transport),
+		}
+
+		clients[e] = connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+			httpClient,
+			e.target.JoinPath(healthCheckProcedure).String(),
+			connect.WithGRPC(),
+		)
+	}
+
+	return clients
+}
+
+// probe probes an endpoint and records the result. It reports false when ctx
+// is done.
+func probe(
+	ctx context.Context,
+	u *Upstream,
+	m *gatewayMetrics,
+	e *Endpoint,
+	client *connect.Client[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse],
+	timeout time.Duration,
+	services []string,
+) bool {
+	if err := probeEndpoint(ctx, client, timeout, services); err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		m.healthChecked(u, e, "failure")
+		e.reportFailure(u, m, err)
+
+		return true
+	}
+
+	m.healthChecked(u, e, "success")
+	e.reportSuccess(u, m)
+
+	return true
+}
+
+// probeEndpoint checks every service, or the server as a whole when there
+// is none. Servers that do not implement the health checking protocol are
+// considered healthy as long as they answer.
+func probeEndpoint(
+	ctx context.Context,
+	client *connect.Client[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse],
+	timeout time.Duration,
+	services []string,
+) error {
+	if len(services) == 0 {
+		services = []string{""}
+	}
+
+	for _, service := range services {
+		err := func() error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			res, err := client.CallUnary(ctx, connect.NewRequest(&healthpb.HealthCheckRequest{
+				Service: service,
+			}))
+			if connect.CodeOf(err) == connect.CodeUnimplemented {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if status := res.Msg.GetStatus(); status != healthpb.HealthCheckResponse_SERVING {
+				return fmt.Errorf("service %q is %s", service, status)
+			}
+
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errUpstreamStatus reports a response whose status shows the upstream could
+// not handle the request.
+var errUpstreamStatus = errors.New("upstream unavailable")
@@ -0,0 +1,207 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"connectrpc.com/connect"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Paths of the HTTP health endpoints mounted by WithHealth.
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// healthWatchInterval is how often Watch streams look for status changes.
+const healthWatchInterval = time.Second
+
+const healthWatchProcedure = "/grpc.health.v1.Health/Watch"
+
+// reachInterval is how often the upstreams none of whose endpoints has been
+// reached yet are probed in the background.
+const reachInterval = time.Second
+
+// Ready reports whether the gateway can serve requests: it is not shutting
+// down, its schema exposes at least one service and at least one of the
+// upstreams they are proxied to has a healthy endpoint. An endpoint is only
+// healthy once it has been reached, by a proxied request, a health check or
+// the background probes started for the upstreams none of whose endpoints
+// has been reached yet, see reach. Ready itself never blocks on a probe.
+func (g *Gateway) Ready(context.Context) bool {
+	st := g.state.Load()
+	if g.closing.Err() != nil || st == nil || len(st.schema.Services) == 0 {
+		return false
+	}
+
+	for upstream := range st.upstreams {
+		if g.upstreamHealthy(upstream) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// upstreamHealthy reports whether some endpoint of the upstream is healthy,
+// starting to probe it in the background when none has been reached yet.
+func (g *Gateway) upstreamHealthy(u *Upstream) bool {
+	if !u.reached() {
+		g.reach(u)
+	}
+
+	return u.healthy(g.metrics)
+}
+
+// reach probes the endpoints of the upstream in the background every
+// reachInterval until one of them answers or the gateway shuts down, unless
+// they are already being probed. Unlike health checks, these probes are not
+// recorded in the metrics and do not eject endpoints, they only mark the
+// endpoints that answered as reached.
+func (g *Gateway) reach(u *Upstream) {
+	if _, probing := g.reaching.LoadOrStore(u, struct{}{}); probing {
+		return
+	}
+
+	timeout := DefaultHealthCheckTimeout
+	if u.HealthCheck != nil {
+		timeout = u.HealthCheck.timeout()
+	}
+
+	go func() {
+		clients := g.healthClients(u)
+
+		ticker := time.NewTicker(reachInterval)
+		defer ticker.Stop()
+
+		for !u.reached() {
+			// The services are read on every round so that reloads are
+			// followed.
+			services := g.state.Load().upstreams[u]
+			for _, e := range u.cluster() {
+				if probeEndpoint(g.closing, clients[e], timeout, services) == nil {
+					e.reached.Store(true)
+				}
+			}
+
+			select {
+			case <-g.closing.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// reached reports whether some endpoint of the upstream has been reached.
+func (u *Upstream) reached() bool {
+	for _, e := range u.cluster() {
+		if e.reached.Load() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// healthy reports whether some endpoint of the upstream has been reached and
+// is not ejected.
+func (u *Upstream) healthy(m *gatewayMetrics) bool {
+	now := time.Now()
+	for _, e := range u.cluster() {
+		e.expire(u, m, now)
+		if e.reached.Load() && e.Healthy() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// servingStatus returns the status of a proxied service, which follows the
+// health of its upstream, or of the gateway as a whole for the empty name.
+// It reports false for services the gateway does not know about.
+func (g *Gateway) servingStatus(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, bool) {
+	serving := func(ok bool) healthpb.HealthCheckResponse_ServingStatus {
+		if ok {
+			return healthpb.HealthCheckResponse_SERVING
+		}
+
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	if service == "" {
+		return serving(g.Ready(ctx)), true
+	}
+
+	for upstream, services := range g.state.Load().upstreams {
+		for _, name := range services {
+			if name == service {
+				return serving(g.upstreamHealthy(upstream)), true
+			}
+		}
+	}
+
+	return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, false
+}
+
+// mountHealth mounts grpc.health.v1.Health and the HTTP health endpoints.
+func (g *Gateway) mountHealth(mux *http.ServeMux) {
+	mux.Handle(healthCheckProcedure, g.local(connect.NewUnaryHandler(
+		healthCheckProcedure,
+		func(ctx context.Context, req *connect.Request[healthpb.HealthCheckRequest]) (*connect.Response[healthpb.HealthCheckResponse], error) {
+			status, ok := g.servingStatus(ctx, req.Msg.GetService())
+			if !ok {
+				return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("unknown service %q", req.Msg.GetService()))
+			}
+
+			return connect.NewResponse(&healthpb.HealthCheckResponse{
+				Status: status,
+			}), nil
+		},
+	)))
+
+	mux.Handle(healthWatchProcedure, g.local(connect.NewServerStreamHandler(
+		healthWatchProcedure,
+		func(ctx context.Context, req *connect.Request[healthpb.HealthCheckRequest], stream *connect.ServerStream[healthpb.HealthCheckResponse]) error {
+			ticker := time.NewTicker(healthWatchInterval)
+			defer ticker.Stop()
+
+			// Unknown services are reported as SERVICE_UNKNOWN rather than
+			// failing the stream, they may show up after a reload.
+			last := healthpb.HealthCheckResponse_ServingStatus(-1)
+			for {
+				status, _ := g.servingStatus(ctx, req.Msg.GetService())
+				if status != last {
+					if err := stream.Send(&healthpb.HealthCheckResponse{Status: status}); err != nil {
+						return err
+					}
+
+					last = status
+				}
+
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
+		},
+	)))
+
+	mux.HandleFunc(LivenessPath, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc(ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		if !g.Ready(r.Context()) {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
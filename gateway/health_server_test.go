@@ -0,0 +1,220 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthClient returns a client of the grpc.health.v1 service of a gateway.
+func healthClient(addr, procedure string) *connect.Client[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse] {
+	return connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+		h2cClient(),
+		addr+procedure,
+		connect.WithGRPC(),
+	)
+}
+
+// getStatus returns the HTTP status of a GET request to url.
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestReady(t *testing.T) {
+	failing := newHealthService(healthpb.HealthCheckResponse_NOT_SERVING)
+	mux := http.NewServeMux()
+	mux.Handle(failing.handler())
+
+	tests := []struct {
+		name string
+		opts []Option
+		// probed holds once the background probes answered.
+		probed func() bool
+		ready  bool
+	}{
+		{
+			name:   "unreachable",
+			opts:   []Option{WithUpstream(closedURL(t))},
+			probed: func() bool { return true },
+		},
+		{
+			name:   "not serving",
+			opts:   []Option{WithUpstream(newUpstream(t, mux))},
+			probed: func() bool { return failing.checked("user.v1.UserService") },
+		},
+		{
+			// The user upstream does not implement health checks, answering
+			// is enough.
+			name:  "reachable",
+			opts:  []Option{WithUpstream(newUserUpstream(t))},
+			ready: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, addr := newTestGateway(t, append([]Option{
+				WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+				WithHealth(),
+			}, tt.opts...)...)
+
+			// Upstreams are probed in the background until they are
+			// reached.
+			if tt.ready {
+				eventually(t, "gateway not ready", func() bool { return g.Ready(context.Background()) })
+			} else {
+				g.Ready(context.Background())
+				eventually(t, "upstream not probed", tt.probed)
+
+				if g.Ready(context.Background()) {
+					t.Error("Ready = true")
+				}
+			}
+
+			status, want := getStatus(t, addr+ReadinessPath), http.StatusServiceUnavailable
+			if tt.ready {
+				want = http.StatusOK
+			}
+
+			if status != want {
+				t.Errorf("%s status = %d, want %d", ReadinessPath, status, want)
+			}
+
+			if status := getStatus(t, addr+LivenessPath); status != http.StatusOK {
+				t.Errorf("%s status = %d", LivenessPath, status)
+			}
+
+			serving := healthpb.HealthCheckResponse_NOT_SERVING
+			if tt.ready {
+				serving = healthpb.HealthCheckResponse_SERVING
+			}
+
+			client := healthClient(addr, healthCheckProcedure)
+			for _, service := range []string{"", "user.v1.UserService"} {
+				res, err := client.CallUnary(context.Background(), connect.NewRequest(&healthpb.HealthCheckRequest{Service: service}))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got := res.Msg.GetStatus(); got != serving {
+					t.Errorf("status of %q = %s, want %s", service, got, serving)
+				}
+			}
+
+			_, err := client.CallUnary(context.Background(), connect.NewRequest(&healthpb.HealthCheckRequest{Service: "unknown.Service"}))
+			if code := connect.CodeOf(err); code != connect.CodeNotFound {
+				t.Errorf("check of an unknown service = %v, want %v", code, connect.CodeNotFound)
+			}
+		})
+	}
+}
+
+func TestReadyProbesInBackground(t *testing.T) {
+	// The upstream answers health checks once released.
+	release := make(chan struct{})
+	checks := make(chan struct{}, 16)
+	mux := http.NewServeMux()
+	mux.Handle(healthCheckProcedure, connect.NewUnaryHandler(healthCheckProcedure,
+		func(ctx context.Context, _ *connect.Request[healthpb.HealthCheckRequest]) (*connect.Response[healthpb.HealthCheckResponse], error) {
+			checks <- struct{}{}
+
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+
+			return connect.NewResponse(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}), nil
+		},
+	))
+
+	u := &Upstream{
+		Name:        "users",
+		Target:      newUpstream(t, mux),
+		HealthCheck: &HealthCheck{UnhealthyThreshold: 1, Timeout: time.Minute},
+	}
+
+	g, _ := newTestGateway(t,
+		WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+		WithDefaultUpstream(u),
+		WithHealth(),
+	)
+
+	// Ready answers from the state while the probe hangs, and concurrent
+	// calls do not start more probes.
+	for i := 0; i < 3; i++ {
+		if g.Ready(context.Background()) {
+			t.Fatal("Ready = true")
+		}
+	}
+
+	<-checks
+	select {
+	case <-checks:
+		t.Error("upstream probed twice at once")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	// Failed background probes neither count as health checks nor eject
+	// the endpoint.
+	eventually(t, "upstream not probed again", func() bool {
+		select {
+		case <-checks:
+			return true
+		default:
+			return false
+		}
+	})
+
+	if e := u.cluster()[0]; !e.Healthy() || e.reached.Load() {
+		t.Errorf("endpoint healthy %v, reached %v", e.Healthy(), e.reached.Load())
+	}
+
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadyWhileShuttingDown(t *testing.T) {
+	g, addr := newUserGateway(t, WithHealth())
+
+	stream, err := healthClient(addr, healthWatchProcedure).CallServerStream(context.Background(), connect.NewRequest(&healthpb.HealthCheckRequest{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	// The first status is sent before the upstream has been reached.
+	for stream.Receive() && stream.Msg().GetStatus() != healthpb.HealthCheckResponse_SERVING {
+	}
+
+	if stream.Msg().GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("watched status = %v, %v", stream.Msg(), stream.Err())
+	}
+
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.Ready(context.Background()) {
+		t.Error("gateway ready while shutting down")
+	}
+
+	// Watch streams end rather than being drained.
+	for stream.Receive() {
+	}
+}
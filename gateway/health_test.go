@@ -0,0 +1,238 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthService serves grpc.health.v1.Health/Check with a settable status
+// and records the services checked.
+type healthService struct {
+	status atomic.Int32
+
+	mu       sync.Mutex
+	services map[string]bool
+}
+
+func newHealthService(status healthpb.HealthCheckResponse_ServingStatus) *healthService {
+	s := &healthService{services: make(map[string]bool)}
+	s.status.Store(int32(status))
+
+	return s
+}
+
+func (s *healthService) handler() (string, http.Handler) {
+	return healthCheckProcedure, connect.NewUnaryHandler(healthCheckProcedure,
+		func(_ context.Context, req *connect.Request[healthpb.HealthCheckRequest]) (*connect.Response[healthpb.HealthCheckResponse], error) {
+			s.mu.Lock()
+			s.services[req.Msg.GetService()] = true
+			s.mu.Unlock()
+
+			return connect.NewResponse(&healthpb.HealthCheckResponse{
+				Status: healthpb.HealthCheckResponse_ServingStatus(s.status.Load()),
+			}), nil
+		},
+	)
+}
+
+func (s *healthService) checked(service string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.services[service]
+}
+
+// closedURL returns the address of a server that is no longer listening.
+func closedURL(t *testing.T) *url.URL {
+	t.Helper()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return target
+}
+
+// eventually fails the test unless cond holds within a few seconds.
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPassiveHealthCheck(t *testing.T) {
+	u := &Upstream{
+		Name:      "users",
+		Endpoints: []*url.URL{{Host: "backend-0"}, {Host: "backend-1"}},
+		HealthCheck: &HealthCheck{
+			UnhealthyThreshold: 2,
+			HealthyThreshold:   2,
+			EjectionTime:       time.Minute,
+		},
+	}
+
+	endpoints := u.cluster()
+	failure := errors.New("connection refused")
+
+	endpoints[0].reportFailure(u, nil, failure)
+	if !endpoints[0].Healthy() {
+		t.Fatal("endpoint ejected before the threshold")
+	}
+
+	// A success resets the consecutive failures.
+	endpoints[0].reportSuccess(u, nil)
+	endpoints[0].reportFailure(u, nil, failure)
+	if !endpoints[0].Healthy() {
+		t.Fatal("endpoint ejected after non-consecutive failures")
+	}
+
+	endpoints[0].reportFailure(u, nil, failure)
+	if endpoints[0].Healthy() {
+		t.Fatal("endpoint not ejected at the threshold")
+	}
+
+	if got := u.available(nil); len(got) != 1 || got[0] != endpoints[1] {
+		t.Errorf("available = %v", got)
+	}
+
+	// Every endpoint is used when all of them are ejected.
+	endpoints[1].reportFailure(u, nil, failure)
+	endpoints[1].reportFailure(u, nil, failure)
+
+	if got := u.available(nil); len(got) != 2 {
+		t.Errorf("available = %v", got)
+	}
+
+	// Ejected endpoints come back after enough successes, or once the
+	// ejection time has elapsed.
+	endpoints[0].reportSuccess(u, nil)
+	if endpoints[0].Healthy() {
+		t.Fatal("endpoint re-admitted before the threshold")
+	}
+
+	endpoints[0].reportSuccess(u, nil)
+	if !endpoints[0].Healthy() {
+		t.Error("endpoint not re-admitted at the threshold")
+	}
+
+	endpoints[1].expire(u, nil, time.Now().Add(time.Minute))
+	if !endpoints[1].Healthy() {
+		t.Error("endpoint not re-admitted after the ejection time")
+	}
+}
+
+func TestHealthEjectsUnreachableEndpoint(t *testing.T) {
+	_, addr := newTestGateway(t,
+		WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+		WithDefaultUpstream(&Upstream{
+			Name:        "users",
+			Endpoints:   []*url.URL{closedURL(t), newUserUpstream(t)},
+			HealthCheck: &HealthCheck{UnhealthyThreshold: 1},
+		}),
+	)
+
+	var failures int
+	for i := 0; i < 6; i++ {
+		res, err := http.Get(addr + "/v1/users/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			failures++
+		}
+	}
+
+	// Only the request reaching the closed endpoint first fails.
+	if failures != 1 {
+		t.Errorf("%d requests failed, want 1", failures)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	health := newHealthService(healthpb.HealthCheckResponse_SERVING)
+
+	mux := http.NewServeMux()
+	mux.Handle(health.handler())
+
+	upstream := &Upstream{
+		Name:      "users",
+		Endpoints: []*url.URL{newUpstream(t, mux)},
+		HealthCheck: &HealthCheck{
+			Interval:           10 * time.Millisecond,
+			UnhealthyThreshold: 1,
+			HealthyThreshold:   1,
+		},
+	}
+
+	g, _ := newTestGateway(t,
+		WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+		WithDefaultUpstream(upstream),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- g.CheckHealth(ctx) }()
+
+	e := upstream.cluster()[0]
+	eventually(t, "endpoint never probed", func() bool {
+		return health.checked("user.v1.UserService")
+	})
+
+	health.status.Store(int32(healthpb.HealthCheckResponse_NOT_SERVING))
+	eventually(t, "endpoint not ejected", func() bool { return !e.Healthy() })
+
+	health.status.Store(int32(healthpb.HealthCheckResponse_SERVING))
+	eventually(t, "endpoint not re-admitted", e.Healthy)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("CheckHealth = %v", err)
+	}
+}
+
+func TestProbeEndpoint(t *testing.T) {
+	// Servers without the health checking protocol are healthy as long as
+	// they answer.
+	client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+		h2cClient(),
+		newUpstream(t, http.NotFoundHandler()).JoinPath(healthCheckProcedure).String(),
+		connect.WithGRPC(),
+	)
+
+	if err := probeEndpoint(context.Background(), client, time.Second, nil); err != nil {
+		t.Errorf("probe of a server without health checks = %v", err)
+	}
+
+	client = connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+		h2cClient(),
+		closedURL(t).JoinPath(healthCheckProcedure).String(),
+		connect.WithGRPC(),
+	)
+
+	if err := probeEndpoint(context.Background(), client, time.Second, nil); err == nil {
+		t.Error("probe of an unreachable server succeeded")
+	}
+}
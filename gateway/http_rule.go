@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// httpRoute returns the path template of the google.api.http rule of md,
+// additional bindings included, matching a REST request.
+func httpRoute(md protoreflect.MethodDescriptor, method, path string) (string, bool) {
+	rule, ok := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return "", false
+	}
+
+	for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+		ruleMethod, template := httpRulePattern(r)
+		if ruleMethod == method && matchTemplate(template, path) {
+			return template, true
+		}
+	}
+
+	return "", false
+}
+
+// httpRulePattern returns the HTTP method and path template of a rule.
+func httpRulePattern(rule *annotations.HttpRule) (string, string) {
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "GET", p.Get
+	case *annotations.HttpRule_Put:
+		return "PUT", p.Put
+	case *annotations.HttpRule_Post:
+		return "POST", p.Post
+	case *annotations.HttpRule_Delete:
+		return "DELETE", p.Delete
+	case *annotations.HttpRule_Patch:
+		return "PATCH", p.Patch
+	case *annotations.HttpRule_Custom:
+		return p.Custom.GetKind(), p.Custom.GetPath()
+	default:
+		return "", ""
+	}
+}
+
+// matchTemplate reports whether path matches a google.api.http path
+// template, such as /v1/{name=shelves/*}/books/**:publish.
+func matchTemplate(template, path string) bool {
+	template, verb := cutVerb(template)
+	if verb != "" {
+		var ok bool
+		if path, ok = strings.CutSuffix(path, verb); !ok {
+			return false
+		}
+	}
+
+	want := templateSegments(template)
+	got := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, segment := range want {
+		if segment == "**" {
+			return true
+		}
+
+		if i >= len(got) || segment != "*" && segment != got[i] {
+			return false
+		}
+	}
+
+	return len(got) == len(want)
+}
+
+// overlapsTemplate reports whether a path below prefix, which ends with a
+// slash, matches a google.api.http path template.
+func overlapsTemplate(template, prefix string) bool {
+	template, _ = cutVerb(template)
+	want := templateSegments(template)
+	got := strings.Split(strings.Trim(prefix, "/"), "/")
+	for i, segment := range got {
+		if i >= len(want) {
+			return false
+		}
+
+		if want[i] == "**" {
+			return true
+		}
+
+		if want[i] != "*" && want[i] != segment {
+			return false
+		}
+	}
+
+	// The prefix itself is not below the prefix.
+	return len(want) > len(got)
+}
+
+// cutVerb splits the verb, such as :publish, from a path template. The verb
+// follows the last segment, outside of any variable.
+func cutVerb(template string) (string, string) {
+	last := template[strings.LastIndex(template, "/")+1:]
+	if i := strings.LastIndex(last, ":"); i >= 0 && !strings.Contains(last[i:], "}") {
+		return strings.TrimSuffix(template, last[i:]), last[i:]
+	}
+
+	return template, ""
+}
+
+// templateSegments returns the segments of a path template whose variables
+// are replaced with the segments they match.
+func templateSegments(template string) []string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(template, '{')
+		end := strings.IndexByte(template, '}')
+		if start < 0 || end < start {
+			b.WriteString(template)
+			break
+		}
+
+		b.WriteString(template[:start])
+
+		_, pattern, ok := strings.Cut(template[start+1:end], "=")
+		if !ok {
+			pattern = "*"
+		}
+
+		b.WriteString(pattern)
+		template = template[end+1:]
+	}
+
+	return strings.Split(strings.TrimPrefix(b.String(), "/"), "/")
+}
@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// standardImports resolves the google/protobuf files linked into the
+// gateway, and nothing else.
+//
+// They take precedence over copies found in the import paths: the
+// transcoder encodes the well-known types with the linked Go types, whose
+// descriptors must match, and vendored copies of descriptor.proto may predate
+// options of current protoc releases such as debug_redact.
+var standardImports = protocompile.WithStandardImports(protocompile.ResolverFunc(
+	func(string) (protocompile.SearchResult, error) {
+		return protocompile.SearchResult{}, protoregistry.NotFound
+	},
+))
+
+// isStandardImport reports whether name is resolved by standardImports.
+func isStandardImport(name string) bool {
+	_, err := standardImports.FindFileByPath(filepath.ToSlash(name))
+	return err == nil
+}
+
+// sourceAccessor opens the files of importPaths, except the standard
+// imports, left to the built-in copies of the parser.
+func sourceAccessor(importPaths []string) func(string) (io.ReadCloser, error) {
+	return func(filename string) (io.ReadCloser, error) {
+		if isStandardImport(filename) {
+			return nil, fs.ErrNotExist
+		}
+
+		for _, dir := range importPaths {
+			if rel, err := filepath.Rel(dir, filename); err == nil && isStandardImport(rel) {
+				return nil, fs.ErrNotExist
+			}
+		}
+
+		return os.Open(filename)
+	}
+}
@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestStandardImportsTakePrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		source func(importPaths []string) SchemaSource
+	}{
+		{
+			name: "parser",
+			source: func(importPaths []string) SchemaSource {
+				return NewParserSource(importPaths, "account/v1/account.proto")
+			},
+		},
+		{
+			name: "compiler",
+			source: func(importPaths []string) SchemaSource {
+				return NewCompilerSource(importPaths, "account/v1/account.proto")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The googleapis import path vendors a descriptor.proto without
+			// debug_redact.
+			schema, err := tt.source(writeProto(t, "account/v1/account.proto", accountProto)).Load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d, err := schema.Files.FindDescriptorByName("google.protobuf.FieldOptions")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if d.(protoreflect.MessageDescriptor).Fields().ByName("debug_redact") == nil {
+				t.Error("descriptor.proto resolved from the import paths")
+			}
+
+			// Other files of the import paths are still resolved.
+			if _, err := schema.Files.FindFileByPath("google/api/annotations.proto"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestIsStandardImport(t *testing.T) {
+	for name, want := range map[string]bool{
+		"google/protobuf/descriptor.proto":       true,
+		"google/protobuf/compiler/plugin.proto":  true,
+		"google/protobuf/timestamp.proto":        true,
+		"google/protobuf/unknown.proto":          false,
+		"google/api/annotations.proto":           false,
+		"account/v1/google/protobuf/empty.proto": false,
+	} {
+		if got := isStandardImport(name); got != want {
+			t.Errorf("isStandardImport(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
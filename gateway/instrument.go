@@ -0,0 +1,372 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Inbound protocols, as used in metric labels.
+const (
+	ProtocolREST    = "rest"
+	ProtocolConnect = "connect"
+	ProtocolGRPC    = "grpc"
+	ProtocolGRPCWeb = "grpc-web"
+)
+
+// protocolOf returns the protocol of a request received by the gateway.
+func protocolOf(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc-web"):
+		return ProtocolGRPCWeb
+	case strings.HasPrefix(contentType, "application/grpc"):
+		return ProtocolGRPC
+	case strings.HasPrefix(contentType, "application/connect+"),
+		r.Header.Get("Connect-Protocol-Version") != "",
+		r.Method == http.MethodGet && r.URL.Query().Get("connect") == "v1":
+		return ProtocolConnect
+	default:
+		return ProtocolREST
+	}
+}
+
+type callKey struct{}
+
+// call describes a request while it is served, from the outermost handler
+// down to the proxy.
+type call struct {
+	protocol string
+	start    time.Time
+	// httpMethod and path are those of the request as received, before
+	// the transcoder rewrites them.
+	httpMethod string
+	path       string
+	// method is set by match once the transcoder routed the request, it
+	// stays nil for the requests served by the gateway itself.
+	method protoreflect.MethodDescriptor
+	// upstreamDuration is the time the proxy took to complete the upstream
+	// request.
+	upstreamDuration time.Duration
+	// requestID is set by the RequestID middleware.
+	requestID string
+	// recorder observes the response, nil unless metrics or tracing are
+	// enabled.
+	recorder *responseRecorder
+	// metrics is nil unless metrics are enabled.
+	metrics *gatewayMetrics
+	// tracer is nil unless tracing is enabled, span is the server span
+	// started by match, requestSpan and responseSpan time the transcoding
+	// of its messages.
+	tracer       trace.Tracer
+	span         trace.Span
+	requestSpan  trace.Span
+	responseSpan trace.Span
+	// payloadLogger is set by AccessLog when it logs messages, payloads
+	// holds those of the call once sampled.
+	payloadLogger *payloadLogger
+	payloads      *payloads
+	// captureStatus is set by the error renderer, upstreamStatus holds the
+	// error of the upstream response once completed.
+	captureStatus  bool
+	upstreamStatus *spb.Status
+}
+
+func callFromContext(ctx context.Context) (*call, bool) {
+	c, ok := ctx.Value(callKey{}).(*call)
+	return c, ok
+}
+
+func (g *Gateway) newCall(r *http.Request) *call {
+	return &call{
+		protocol:   protocolOf(r),
+		start:      time.Now(),
+		httpMethod: r.Method,
+		path:       r.URL.Path,
+		metrics:    g.metrics,
+		tracer:     g.opts.tracer,
+	}
+}
+
+// match records the method the transcoder routed the call to. It returns
+// the context of the upstream request and a function to call once it
+// completed.
+func (c *call) match(ctx context.Context, md protoreflect.MethodDescriptor) (context.Context, func()) {
+	c.method = md
+	proxied := time.Now()
+
+	var inFlight prometheus.Gauge
+	if c.metrics != nil {
+		inFlight = c.metrics.rpcInFlight.WithLabelValues(rpcLabels(c)...)
+		inFlight.Inc()
+	}
+
+	if c.tracer != nil {
+		ctx = c.startSpans(ctx)
+	}
+
+	return ctx, func() {
+		c.upstreamDuration = time.Since(proxied)
+		if inFlight != nil {
+			inFlight.Dec()
+		}
+	}
+}
+
+// observe serves the request while recording the metrics and the server span
+// of the call once the transcoder matched it to a method.
+func observe(w http.ResponseWriter, r *http.Request, handler http.Handler) {
+	c, ok := callFromContext(r.Context())
+	if !ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	c.recorder = &responseRecorder{ResponseWriter: w}
+
+	body := &countingReader{ReadCloser: r.Body}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = body
+	}
+
+	// The proxy panics with http.ErrAbortHandler when it cannot copy the
+	// response, such calls are recorded too.
+	defer c.record(r, body)
+
+	handler.ServeHTTP(c.recorder, r)
+}
+
+// record records the metrics and the server span of the call once it
+// completed. r is the request as received by the gateway.
+func (c *call) record(r *http.Request, body *countingReader) {
+	if c.method == nil {
+		return
+	}
+
+	code := c.recorder.code(c.protocol, r.Context().Err() != nil)
+
+	if c.metrics != nil {
+		labels := rpcLabels(c)
+		c.metrics.rpcHandled.WithLabelValues(append(labels, code.String())...).Inc()
+		c.metrics.rpcDuration.WithLabelValues(labels...).Observe(time.Since(c.start).Seconds())
+		c.metrics.rpcRequestSize.WithLabelValues(labels...).Observe(float64(body.n.Load()))
+		c.metrics.rpcResponseSize.WithLabelValues(labels...).Observe(float64(c.recorder.written))
+	}
+
+	if c.span != nil {
+		c.endSpan(code)
+	}
+}
+
+// rpcLabels returns the service, method and protocol labels of the call.
+func rpcLabels(c *call) []string {
+	return []string{string(c.method.Parent().FullName()), string(c.method.Name()), c.protocol}
+}
+
+// countingReader counts the bytes read from a request body. The proxy
+// transport reads the body on its own goroutine, which may still be running
+// when the call is recorded.
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+
+	return n, err
+}
+
+const (
+	// maxRecordedHead bounds the beginning of error bodies kept to read
+	// their status code.
+	maxRecordedHead = 4 << 10
+	// maxRecordedTail bounds the end of response bodies kept to read the
+	// status code of gRPC-Web and Connect streams from their last message.
+	maxRecordedTail = 256
+)
+
+// responseRecorder observes the response written to the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+	head    []byte
+	tail    []byte
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+
+	if w.status != http.StatusOK && len(w.head) < maxRecordedHead {
+		w.head = append(w.head, p[:min(n, maxRecordedHead-len(w.head))]...)
+	}
+
+	w.tail = append(w.tail, p[:n]...)
+	if len(w.tail) > maxRecordedTail {
+		w.tail = append(w.tail[:0], w.tail[len(w.tail)-maxRecordedTail:]...)
+	}
+
+	return n, err
+}
+
+// Flush implements http.Flusher, which streaming responses rely on.
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// code returns the gRPC status of the call, read from the response as the
+// inbound protocol carries it.
+func (w *responseRecorder) code(protocol string, canceled bool) codes.Code {
+	header := w.Header()
+	switch protocol {
+	case ProtocolGRPC, ProtocolGRPCWeb:
+		status := header.Get("Grpc-Status")
+		if status == "" {
+			status = header.Get(http.TrailerPrefix + "Grpc-Status")
+		}
+
+		// gRPC-Web sends the trailers in the last message of the body.
+		if status == "" && protocol == ProtocolGRPCWeb {
+			tail := bytes.ToLower(w.tail)
+			if i := bytes.LastIndex(tail, []byte("grpc-status:")); i >= 0 {
+				status = string(bytes.TrimSpace(tail[i+len("grpc-status:"):]))
+				status, _, _ = strings.Cut(status, "\r")
+			}
+		}
+
+		if code, err := strconv.Atoi(strings.TrimSpace(status)); err == nil {
+			return codes.Code(code)
+		}
+	case ProtocolConnect:
+		// Connect streams end with a message holding the error, if any.
+		if strings.HasPrefix(header.Get("Content-Type"), "application/connect+") {
+			if i := bytes.LastIndex(w.tail, []byte(`"code":"`)); i >= 0 {
+				name, _, _ := strings.Cut(string(w.tail[i+len(`"code":"`):]), `"`)
+				return connectCode(name)
+			}
+
+			if w.status == http.StatusOK {
+				return codes.OK
+			}
+		}
+
+		if w.status == http.StatusOK {
+			return codes.OK
+		}
+
+		var body struct {
+			Code string `json:"code"`
+		}
+
+		if json.Unmarshal(w.head, &body) == nil && body.Code != "" {
+			return connectCode(body.Code)
+		}
+	default:
+		if w.status < http.StatusMultipleChoices {
+			return codes.OK
+		}
+
+		// Errors are rendered as google.rpc.Status, with a numeric code,
+		// as problem details, with the name of the code, or in the shape of
+		// Google APIs, see ErrorFormat.
+		var body struct {
+			Code  json.RawMessage `json:"code"`
+			Error struct {
+				Status json.RawMessage `json:"status"`
+			} `json:"error"`
+		}
+
+		if json.Unmarshal(w.head, &body) == nil {
+			var code codes.Code
+			if body.Error.Status != nil && code.UnmarshalJSON(body.Error.Status) == nil {
+				return code
+			}
+
+			if body.Code != nil && code.UnmarshalJSON(body.Code) == nil && code != codes.OK {
+				return code
+			}
+		}
+	}
+
+	if canceled {
+		return codes.Canceled
+	}
+
+	return httpStatusCode(w.status)
+}
+
+// connectCode returns the code of a Connect error code name.
+func connectCode(name string) codes.Code {
+	var code connect.Code
+	if err := code.UnmarshalText([]byte(name)); err != nil {
+		return codes.Unknown
+	}
+
+	return codes.Code(code)
+}
+
+// httpStatusCode maps an HTTP status to the closest gRPC code, following
+// google.rpc.Code.
+func httpStatusCode(status int) codes.Code {
+	switch status {
+	case 0, http.StatusOK:
+		return codes.Unknown
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
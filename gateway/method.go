@@ -0,0 +1,69 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type methodKey struct{}
+
+// withMethods records the descriptor of the called method in the context of
+// the requests reaching the proxy of svc, whose path is always
+// /package.Service/Method once transcoded, and in the call tracked by the
+// gateway. The messages of the sampled calls are captured for AccessLog and
+// decoded with types, the upstream status for the error renderer.
+func withMethods(handler http.Handler, svc protoreflect.ServiceDescriptor, types *dynamicpb.Types) http.Handler {
+	methods := make(map[string]protoreflect.MethodDescriptor)
+	mds := svc.Methods()
+	for i := 0; i < mds.Len(); i++ {
+		md := mds.Get(i)
+		methods["/"+string(svc.FullName())+"/"+string(md.Name())] = md
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md, ok := methods[r.URL.Path]
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), methodKey{}, md)
+		c, ok := callFromContext(ctx)
+		if !ok {
+			handler.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		var done func()
+		ctx, done = c.match(ctx, md)
+		defer done()
+
+		if c.captureStatus {
+			sw := &statusWriter{ResponseWriter: w}
+			w = sw
+
+			defer func() { c.upstreamStatus = sw.status() }()
+		}
+
+		r = r.WithContext(ctx)
+		if c.span != nil {
+			w = c.traceTranscoding(ctx, w, r)
+		}
+
+		if c.payloadLogger != nil && c.payloadLogger.sampled(md) {
+			c.payloads = &payloads{logger: c.payloadLogger, types: types}
+			w = c.payloads.capture(w, r)
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// methodFromContext returns the method recorded by withMethods.
+func methodFromContext(ctx context.Context) (protoreflect.MethodDescriptor, bool) {
+	md, ok := ctx.Value(methodKey{}).(protoreflect.MethodDescriptor)
+	return md, ok
+}
@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsPath is where WithMetrics serves the metrics.
+const MetricsPath = "/metrics"
+
+// sizeBuckets spans message sizes from 64B to 16MiB.
+var sizeBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+
+// gatewayMetrics are the collectors of a gateway created with WithMetrics. A
+// nil *gatewayMetrics records nothing.
+type gatewayMetrics struct {
+	endpointHealthy     *prometheus.GaugeVec
+	endpointEjections   *prometheus.CounterVec
+	healthChecks        *prometheus.CounterVec
+	upstreamConnections *prometheus.CounterVec
+	upstreamErrors      *prometheus.CounterVec
+	rpcHandled          *prometheus.CounterVec
+	rpcDuration         *prometheus.HistogramVec
+	rpcInFlight         *prometheus.GaugeVec
+	rpcRequestSize      *prometheus.HistogramVec
+	rpcResponseSize     *prometheus.HistogramVec
+	schemaReloads       *prometheus.CounterVec
+}
+
+// newMetrics creates the collectors and registers them with reg. The
+// collectors another gateway already registered with reg are shared.
+func newMetrics(reg prometheus.Registerer) (*gatewayMetrics, error) {
+	r := &registrar{reg: reg}
+	m := &gatewayMetrics{
+		endpointHealthy: registerOn(r, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "gateway",
+			Subsystem: "upstream",
+			Name:      "endpoint_healthy",
+			Help:      "Whether an upstream endpoint takes part in load balancing (1) or is ejected (0).",
+		}, []string{"upstream", "endpoint"})),
+		endpointEjections: registerOn(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "upstream",
+			Name:      "endpoint_ejections_total",
+			Help:      "Number of times an upstream endpoint was ejected by health checking.",
+		}, []string{"upstream", "endpoint"})),
+		healthChecks: registerOn(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "upstream",
+			Name:      "health_checks_total",
+			Help:      "Number of active health check probes by result.",
+		}, []string{"upstream", "endpoint", "result"})),
+		upstreamConnections: registerOn(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "upstream",
+			Name:      "connections_total",
+			Help:      "Number of connections opened to upstream endpoints by the proxy.",
+		}, []string{"upstream", "endpoint"})),
+		upstreamErrors: registerOn(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "upstream",
+			Name:      "errors_total",
+			Help:      "Number of proxied requests that got no response from an upstream endpoint.",
+		}, []string{"upstream", "endpoint"})),
+		rpcHandled: registerOn(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "rpc",
+			Name:      "handled_total",
+			Help:      "Number of completed calls by method, inbound protocol and gRPC status code.",
+		}, []string{"service", "method", "protocol", "code"})),
+		rpcDuration: registerOn(r, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "gateway",
+			Subsystem: "rpc",
+			Name:      "duration_seconds",
+			Help:      "Time taken to complete calls, streams included.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service", "method", "protocol"})),
+		rpcInFlight: registerOn(r, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "gateway",
+			Subsystem: "rpc",
+			Name:      "in_flight",
+			Help:      "Number of calls being proxied.",
+		}, []string{"service", "method", "protocol"})),
+		rpcRequestSize: registerOn(r, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "gateway",
+			Subsystem: "rpc",
+			Name:      "request_size_bytes",
+			Help:      "Size of the request bodies received from clients.",
+			Buckets:   sizeBuckets,
+		}, []string{"service", "method", "protocol"})),
+		rpcResponseSize: registerOn(r, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "gateway",
+			Subsystem: "rpc",
+			Name:      "response_size_bytes",
+			Help:      "Size of the response bodies sent to clients.",
+			Buckets:   sizeBuckets,
+		}, []string{"service", "method", "protocol"})),
+		schemaReloads: registerOn(r, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "schema",
+			Name:      "reloads_total",
+			Help:      "Number of schema reloads by result: success, unchanged or failure.",
+		}, []string{"result"})),
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("could not register metrics: %w", r.err)
+	}
+
+	return m, nil
+}
+
+// metricsHandler serves the metrics gathered from reg, or from the Prometheus
+// default registry when reg cannot gather them.
+func metricsHandler(reg prometheus.Registerer) http.Handler {
+	if gatherer, ok := reg.(prometheus.Gatherer); ok && reg != prometheus.DefaultRegisterer {
+		return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{Registry: reg})
+	}
+
+	return promhttp.Handler()
+}
+
+// registrar registers collectors, keeping the first error.
+type registrar struct {
+	reg prometheus.Registerer
+	err error
+}
+
+// registerOn registers c and returns it, or the identical collector already
+// registered.
+func registerOn[C prometheus.Collector](r *registrar, c C) C {
+	err := r.reg.Register(c)
+
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(C); ok {
+			return existing
+		}
+	}
+
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+
+	return c
+}
+
+// endpointLabels returns the upstream and endpoint labels of e.
+func endpointLabels(u *Upstream, e *Endpoint) []string {
+	return []string{u.Name, e.String()}
+}
+
+func (m *gatewayMetrics) schemaReloaded(result string) {
+	if m != nil {
+		m.schemaReloads.WithLabelValues(result).Inc()
+	}
+}
+
+// endpointHealth records whether e takes part in load balancing.
+func (m *gatewayMetrics) endpointHealth(u *Upstream, e *Endpoint, healthy bool) {
+	if m == nil {
+		return
+	}
+
+	v := 0.0
+	if healthy {
+		v = 1
+	}
+
+	m.endpointHealthy.WithLabelValues(endpointLabels(u, e)...).Set(v)
+}
+
+func (m *gatewayMetrics) endpointEjected(u *Upstream, e *Endpoint) {
+	if m != nil {
+		m.endpointEjections.WithLabelValues(endpointLabels(u, e)...).Inc()
+	}
+}
+
+func (m *gatewayMetrics) healthChecked(u *Upstream, e *Endpoint, result string) {
+	if m != nil {
+		m.healthChecks.WithLabelValues(u.Name, e.String(), result).Inc()
+	}
+}
+
+func (m *gatewayMetrics) upstreamConnected(u *Upstream, e *Endpoint) {
+	if m != nil {
+		m.upstreamConnections.WithLabelValues(endpointLabels(u, e)...).Inc()
+	}
+}
+
+func (m *gatewayMetrics) upstreamFailed(u *Upstream, e *Endpoint) {
+	if m != nil {
+		m.upstreamErrors.WithLabelValues(endpointLabels(u, e)...).Inc()
+	}
+}
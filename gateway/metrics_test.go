@@ -0,0 +1,197 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	userv1 "github.com/anhnmt/gprc-dynamic-proto/proto/gengo/user/v1"
+	"github.com/anhnmt/gprc-dynamic-proto/proto/gengo/user/v1/userv1connect"
+)
+
+// metricValue returns the value of the counter or gauge name whose labels
+// include labels, or the sample count of a histogram.
+func metricValue(t *testing.T, g prometheus.Gatherer, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var total float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			if !hasLabels(m, labels) {
+				continue
+			}
+
+			switch {
+			case m.Counter != nil:
+				total += m.GetCounter().GetValue()
+			case m.Gauge != nil:
+				total += m.GetGauge().GetValue()
+			case m.Histogram != nil:
+				total += float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	return total
+}
+
+func hasLabels(m *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, pair := range m.GetLabel() {
+		if v, ok := labels[pair.GetName()]; ok && v == pair.GetValue() {
+			matched++
+		}
+	}
+
+	return matched == len(labels)
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	_, addr := newUserGateway(t, WithMetrics(reg))
+
+	client := userv1connect.NewUserServiceClient(h2cClient(), addr, connect.WithGRPC())
+	if _, err := client.List(context.Background(), connect.NewRequest(&userv1.ListRequest{Page: 1})); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = client.List(context.Background(), connect.NewRequest(&userv1.ListRequest{Page: -1}))
+
+	res, err := http.Get(addr + "/v1/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	method := map[string]string{"service": "user.v1.UserService", "method": "List"}
+	with := func(labels map[string]string) map[string]string {
+		for k, v := range method {
+			labels[k] = v
+		}
+
+		return labels
+	}
+
+	// Calls are recorded once their handler returns, which may be after the
+	// client got the response.
+	eventually(t, "calls not recorded", func() bool {
+		return metricValue(t, reg, "gateway_rpc_handled_total", method) == 3
+	})
+
+	for _, tt := range []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{name: "gateway_rpc_handled_total", labels: with(map[string]string{"protocol": ProtocolGRPC, "code": "OK"}), want: 1},
+		{name: "gateway_rpc_handled_total", labels: with(map[string]string{"protocol": ProtocolGRPC, "code": "InvalidArgument"}), want: 1},
+		{name: "gateway_rpc_handled_total", labels: with(map[string]string{"protocol": ProtocolREST, "code": "OK"}), want: 1},
+		{name: "gateway_rpc_duration_seconds", labels: method, want: 3},
+		{name: "gateway_rpc_in_flight", labels: method, want: 0},
+		{name: "gateway_rpc_request_size_bytes", labels: method, want: 3},
+	} {
+		if got := metricValue(t, reg, tt.name, tt.labels); got != tt.want {
+			t.Errorf("%s%v = %v, want %v", tt.name, tt.labels, got, tt.want)
+		}
+	}
+
+	// The metrics are served from the registry they are recorded on.
+	res, err = http.Get(addr + MetricsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), "gateway_rpc_handled_total") {
+		t.Errorf("%s: status %d\n%s", MetricsPath, res.StatusCode, body)
+	}
+}
+
+func TestMetricsUpstreamHealth(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	_, addr := newTestGateway(t,
+		WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+		WithDefaultUpstream(&Upstream{
+			Name:        "users",
+			Endpoints:   []*url.URL{closedURL(t)},
+			HealthCheck: &HealthCheck{UnhealthyThreshold: 1},
+		}),
+		WithMetrics(reg),
+	)
+
+	res, err := http.Get(addr + "/v1/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	upstream := map[string]string{"upstream": "users"}
+	for name, want := range map[string]float64{
+		"gateway_upstream_errors_total":             1,
+		"gateway_upstream_endpoint_ejections_total": 1,
+		"gateway_upstream_endpoint_healthy":         0,
+	} {
+		if got := metricValue(t, reg, name, upstream); got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestMetricsSharedRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	// Gateways registering with the same registry share the collectors.
+	newUserGateway(t, WithMetrics(reg))
+	newUserGateway(t, WithMetrics(reg))
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	g, addr := newUserGateway(t)
+
+	res, err := http.Get(addr + "/v1/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if g.metrics != nil {
+		t.Error("metrics recorded without WithMetrics")
+	}
+
+	// Nothing is registered globally by importing the package.
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), "gateway_") {
+			t.Errorf("%s registered on the default registry", family.GetName())
+		}
+	}
+
+	if w := serve(g, MetricsPath, nil); w.Code == http.StatusOK {
+		t.Errorf("%s served without WithMetrics", MetricsPath)
+	}
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Middleware wraps the gateway handler.
+type Middleware func(http.Handler) http.Handler
+
+// DefaultRequestIDHeader is the header used by RequestID when none is given.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// chain wraps h so that the first middleware is the outermost one.
+func chain(h http.Handler, middleware []Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+
+	return h
+}
+
+// Recover returns a middleware that turns panics into 500 responses instead
+// of dropping the connection.
+func Recover() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				log.Error().
+					Interface("panic", rec).
+					Str("path", r.URL.Path).
+					Msg("recovered from panic")
+
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestID returns a middleware that ensures every request carries an ID in
+// the given header, generating one when the client did not send it. The ID
+// is echoed in the response, available through RequestIDFromContext and
+// logged by AccessLog.
+func RequestID(header string) Middleware {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if id == "" {
+				id = newRequestID()
+				r.Header.Set(header, id)
+			}
+
+			w.Header().Set(header, id)
+			if c, ok := callFromContext(r.Context()); ok {
+				c.requestID = id
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+// RequestIDFromContext returns the ID assigned by the RequestID middleware.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/anhnmt/gprc-dynamic-proto/gateway/openapi"
+)
+
+// Paths of the OpenAPI documents mounted by WithOpenAPI.
+const (
+	OpenAPIJSONPath = "/openapi.json"
+	OpenAPIYAMLPath = "/openapi.yaml"
+)
+
+// mountOpenAPI mounts the OpenAPI document of the schema, rendered once per
+// schema so that it follows reloads. Its version is the schema hash.
+func mountOpenAPI(mux *http.ServeMux, schema *Schema, hash string) error {
+	doc := openapi.New(schema.Services, openapi.Info{
+		Title:       "gRPC dynamic gateway",
+		Description: "Services served over REST, Connect, gRPC and gRPC-Web.",
+		Version:     hash[:12],
+	})
+
+	jsonDoc, err := doc.JSON()
+	if err != nil {
+		return fmt.Errorf("could not encode OpenAPI document: %w", err)
+	}
+
+	yamlDoc, err := doc.YAML()
+	if err != nil {
+		return fmt.Errorf("could not encode OpenAPI document: %w", err)
+	}
+
+	serve := func(contentType string, data []byte) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("ETag", `"`+hash+`"`)
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		}
+	}
+
+	mux.Handle("GET "+OpenAPIJSONPath, serve("application/json", jsonDoc))
+	mux.Handle("GET "+OpenAPIYAMLPath, serve("application/yaml", yamlDoc))
+
+	return nil
+}
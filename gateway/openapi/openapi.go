@@ -0,0 +1,407 @@
+package openapi
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// New returns the document describing the given services.
+//
+// Every google.api.http rule, additional bindings included, becomes an
+// operation whose path parameters are the template variables and whose query
+// parameters are the request fields bound to neither the path nor the body.
+// Unary methods without rules are described as Connect calls, a POST to
+// /package.Service/Method with the JSON request as body.
+func New(services []protoreflect.ServiceDescriptor, info Info) *Document {
+	g := &generator{
+		schemas: newSchemas(),
+		doc: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   make(map[string]*PathItem),
+		},
+	}
+
+	for _, svcDesc := range services {
+		g.addService(svcDesc)
+	}
+
+	g.doc.Components.Schemas = g.schemas.components
+
+	return g.doc
+}
+
+type generator struct {
+	doc     *Document
+	schemas *schemas
+}
+
+func (g *generator) addService(svcDesc protoreflect.ServiceDescriptor) {
+	g.doc.Tags = append(g.doc.Tags, &Tag{
+		Name:        string(svcDesc.FullName()),
+		Description: comments(svcDesc),
+	})
+
+	methods := svcDesc.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		if md.IsStreamingClient() {
+			// Neither REST nor Connect over plain HTTP can carry a stream of
+			// requests.
+			continue
+		}
+
+		rule, ok := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if !ok || rule == nil || rule.GetPattern() == nil {
+			if !md.IsStreamingServer() {
+				g.addConnect(md)
+			}
+
+			continue
+		}
+
+		rules := append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+		for j, rule := range rules {
+			id := string(md.FullName())
+			if j > 0 {
+				id = fmt.Sprintf("%s_%d", id, j)
+			}
+
+			g.addRule(md, rule, id)
+		}
+	}
+}
+
+// add sets the operation of a path, keeping the first operation when
+// several methods are bound to the same route.
+func (g *generator) add(path, method string, op *Operation) {
+	item, ok := g.doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		g.doc.Paths[path] = item
+	}
+
+	slot := item.operation(method)
+	if slot == nil || *slot != nil {
+		return
+	}
+
+	*slot = op
+}
+
+func (g *generator) newOperation(md protoreflect.MethodDescriptor, id string) *Operation {
+	op := &Operation{
+		Tags:        []string{string(md.Parent().FullName())},
+		Description: comments(md),
+		OperationID: id,
+		Responses: map[string]*Response{
+			"default": {
+				Description: "An error response.",
+				Content: map[string]*MediaType{
+					"application/json": {Schema: ref(statusName)},
+				},
+			},
+		},
+	}
+
+	// The first line of the comments summarizes the operation.
+	summary, description, _ := strings.Cut(op.Description, "\n")
+	op.Summary, op.Description = summary, strings.TrimSpace(description)
+
+	if opts, ok := md.Options().(*descriptorpb.MethodOptions); ok && opts.GetDeprecated() {
+		op.Deprecated = true
+	}
+
+	if !md.IsStreamingClient() && !md.IsStreamingServer() {
+		op.Connect = &ConnectCall{
+			Procedure: fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name()),
+			Request:   g.schemas.message(md.Input()),
+		}
+	}
+
+	return op
+}
+
+func (g *generator) addConnect(md protoreflect.MethodDescriptor) {
+	op := g.newOperation(md, string(md.FullName()))
+	// The header tells Connect calls apart from REST requests.
+	op.Parameters = []*Parameter{{
+		Name:     "Connect-Protocol-Version",
+		In:       "header",
+		Required: true,
+		Schema:   &Schema{Type: "string", Enum: []any{"1"}},
+	}}
+
+	op.RequestBody = &RequestBody{
+		Required: true,
+		Content: map[string]*MediaType{
+			"application/json": {Schema: g.schemas.message(md.Input())},
+		},
+	}
+
+	op.Responses["200"] = &Response{
+		Description: "A successful response.",
+		Content: map[string]*MediaType{
+			"application/json": {Schema: g.schemas.message(md.Output())},
+		},
+	}
+
+	g.add(op.Connect.Procedure, "post", op)
+}
+
+func (g *generator) addRule(md protoreflect.MethodDescriptor, rule *annotations.HttpRule, id string) {
+	method, template := httpPattern(rule)
+	path, vars := parseTemplate(template)
+
+	op := g.newOperation(md, id)
+	input := md.Input()
+
+	// bound holds the fields carried by the path, which are left out of the
+	// query parameters and the body.
+	bound := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		bound[v.field] = true
+
+		param := &Parameter{
+			Name:     v.field,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		}
+
+		if fd := findField(input, v.field); fd != nil {
+			param.Schema = g.schemas.singular(fd)
+			param.Description = comments(fd)
+		}
+
+		if v.pattern != "" && v.pattern != "*" {
+			// OpenAPI path parameters cannot span segments, the pattern is
+			// documented instead.
+			if param.Description != "" {
+				param.Description += "\n\n"
+			}
+
+			param.Description += fmt.Sprintf("Must match `%s`.", v.pattern)
+		}
+
+		op.Parameters = append(op.Parameters, param)
+	}
+
+	switch body := rule.GetBody(); body {
+	case "":
+		op.Parameters = append(op.Parameters, g.queryParams(input, "", bound, nil)...)
+	case "*":
+		// The fields bound to the path, nested ones included, are left out of
+		// an inline schema of the request.
+		var schema *Schema
+		switch {
+		case input.FullName() == httpBodyName:
+			op.RequestBody = binaryBody()
+		case len(bound) == 0:
+			schema = g.schemas.message(input)
+		default:
+			schema = g.schemas.object(input, bound)
+		}
+
+		if schema != nil {
+			op.RequestBody = jsonBody(schema)
+		}
+	default:
+		bound[body] = true
+		op.Parameters = append(op.Parameters, g.queryParams(input, "", bound, nil)...)
+
+		fd := input.Fields().ByName(protoreflect.Name(body))
+		switch {
+		case fd == nil:
+		case fd.Message() != nil && fd.Message().FullName() == httpBodyName && !fd.IsList():
+			op.RequestBody = binaryBody()
+			op.RequestBody.Description = comments(fd)
+		default:
+			op.RequestBody = jsonBody(g.schemas.field(fd))
+		}
+	}
+
+	output := md.Output()
+	var outputField protoreflect.FieldDescriptor
+	if name := rule.GetResponseBody(); name != "" {
+		outputField = output.Fields().ByName(protoreflect.Name(name))
+	}
+
+	response := &Response{
+		Description: "A successful response.",
+	}
+
+	switch {
+	case outputField != nil && outputField.Message() != nil && outputField.Message().FullName() == httpBodyName:
+		response.Content = binaryBody().Content
+	case outputField != nil:
+		response.Content = jsonBody(g.schemas.field(outputField)).Content
+	case output.FullName() == httpBodyName:
+		response.Content = binaryBody().Content
+	default:
+		response.Content = jsonBody(g.schemas.message(output)).Content
+	}
+
+	op.Responses["200"] = response
+
+	g.add(path, method, op)
+}
+
+// queryParams returns the query parameters of the fields of a message that
+// are not bound elsewhere, named after the dotted path of their proto names
+// since the transcoder does not accept JSON names in queries. Nested messages
+// are flattened, repeated messages and maps cannot be carried by query
+// parameters. seen guards against recursive messages.
+func (g *generator) queryParams(md protoreflect.MessageDescriptor, prefix string, bound map[string]bool, seen map[protoreflect.FullName]bool) []*Parameter {
+	if seen[md.FullName()] {
+		return nil
+	}
+
+	seen = copySeen(seen)
+	seen[md.FullName()] = true
+
+	var params []*Parameter
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := prefix + string(fd.Name())
+		if bound[name] {
+			continue
+		}
+
+		switch {
+		case fd.IsMap():
+		case isScalar(fd):
+			schema := g.schemas.field(fd)
+			param := &Parameter{
+				Name:        name,
+				In:          "query",
+				Description: schema.Description,
+				Required:    isRequired(fd),
+				Deprecated:  schema.Deprecated,
+				Schema:      schema,
+			}
+
+			schema.Description, schema.Deprecated = "", false
+			params = append(params, param)
+		case !fd.IsList():
+			params = append(params, g.queryParams(fd.Message(), name+".", bound, seen)...)
+		}
+	}
+
+	return params
+}
+
+func copySeen(seen map[protoreflect.FullName]bool) map[protoreflect.FullName]bool {
+	copied := make(map[protoreflect.FullName]bool, len(seen)+1)
+	for name := range seen {
+		copied[name] = true
+	}
+
+	return copied
+}
+
+func jsonBody(schema *Schema) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content: map[string]*MediaType{
+			"application/json": {Schema: schema},
+		},
+	}
+}
+
+// binaryBody is the body of a google.api.HttpBody, whose content type is
+// chosen by the caller.
+func binaryBody() *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content: map[string]*MediaType{
+			"*/*": {Schema: &Schema{Type: "string", Format: "binary"}},
+		},
+	}
+}
+
+// httpPattern returns the HTTP method, in lower case, and the path template
+// of a rule.
+func httpPattern(rule *annotations.HttpRule) (string, string) {
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "get", pattern.Get
+	case *annotations.HttpRule_Put:
+		return "put", pattern.Put
+	case *annotations.HttpRule_Post:
+		return "post", pattern.Post
+	case *annotations.HttpRule_Delete:
+		return "delete", pattern.Delete
+	case *annotations.HttpRule_Patch:
+		return "patch", pattern.Patch
+	case *annotations.HttpRule_Custom:
+		return strings.ToLower(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		return "", ""
+	}
+}
+
+// pathVar is a variable of a path template, such as {name=shelves/*}.
+type pathVar struct {
+	field   string
+	pattern string
+}
+
+// parseTemplate converts a path template to an OpenAPI path, replacing every
+// variable by its field path: /v1/{name=shelves/*}:get becomes
+// /v1/{name}:get.
+func parseTemplate(template string) (string, []pathVar) {
+	var (
+		path strings.Builder
+		vars []pathVar
+	)
+
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+
+		end += start
+		field, pattern, _ := strings.Cut(template[start+1:end], "=")
+		vars = append(vars, pathVar{field: field, pattern: pattern})
+
+		path.WriteString(template[:start])
+		path.WriteString("{" + field + "}")
+		template = template[end+1:]
+	}
+
+	path.WriteString(template)
+
+	return path.String(), vars
+}
+
+// findField resolves a dotted field path of the request message.
+func findField(md protoreflect.MessageDescriptor, fieldPath string) protoreflect.FieldDescriptor {
+	var fd protoreflect.FieldDescriptor
+	for _, name := range strings.Split(fieldPath, ".") {
+		if md == nil {
+			return nil
+		}
+
+		fd = md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return nil
+		}
+
+		md = fd.Message()
+	}
+
+	return fd
+}
@@ -0,0 +1,286 @@
+package openapi_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/anhnmt/gprc-dynamic-proto/gateway"
+	"github.com/anhnmt/gprc-dynamic-proto/gateway/openapi"
+)
+
+const libraryProto = `
+syntax = "proto3";
+
+package library.v1;
+
+import "google/api/annotations.proto";
+import "google/api/field_behavior.proto";
+
+// Manages books.
+service LibraryService {
+  // Gets a book.
+  //
+  // The book must exist.
+  rpc GetBook(GetBookRequest) returns (Book) {
+    option (google.api.http) = {get: "/v1/{name=shelves/*/books/*}"};
+  }
+
+  rpc CreateBook(CreateBookRequest) returns (Book) {
+    option (google.api.http) = {
+      post: "/v1/{parent=shelves/*}/books"
+      body: "book"
+    };
+  }
+
+  rpc UpdateBook(UpdateBookRequest) returns (Book) {
+    option (google.api.http) = {
+      patch: "/v1/{book.name=shelves/*/books/*}"
+      body: "*"
+      additional_bindings {put: "/v1/books/{book.author.id}" body: "*"}
+    };
+  }
+
+  rpc DeleteBook(GetBookRequest) returns (Book) {
+    option deprecated = true;
+  }
+
+  rpc WatchBooks(GetBookRequest) returns (stream Book);
+
+  rpc ImportBooks(stream Book) returns (Book);
+}
+
+message Book {
+  // Resource name of the book.
+  string name = 1;
+  string title = 2 [(google.api.field_behavior) = REQUIRED];
+  Author author = 3;
+  int64 pages = 4;
+}
+
+message Author {
+  string id = 1;
+  string display_name = 2;
+}
+
+message GetBookRequest {
+  string name = 1;
+  int64 revision = 2;
+  Filter filter = 3;
+  repeated Filter filters = 4;
+  map<string, string> labels = 5;
+}
+
+message Filter {
+  string author = 1;
+}
+
+message CreateBookRequest {
+  string parent = 1;
+  Book book = 2;
+}
+
+message UpdateBookRequest {
+  Book book = 1;
+  bool validate_only = 2;
+}
+`
+
+func newDocument(t *testing.T) *openapi.Document {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "library", "v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "library", "v1", "library.proto"), []byte(libraryProto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := gateway.NewCompilerSource([]string{dir, "../../googleapis"}, "library/v1/library.proto")
+	schema, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatalf("could not load schema: %v", err)
+	}
+
+	return openapi.New(schema.Services, openapi.Info{
+		Title:   "Library",
+		Version: "test",
+	})
+}
+
+func operation(t *testing.T, doc *openapi.Document, path, method string) *openapi.Operation {
+	t.Helper()
+
+	item, ok := doc.Paths[path]
+	if !ok {
+		t.Fatalf("path %s not documented, got %v", path, keys(doc.Paths))
+	}
+
+	op := map[string]*openapi.Operation{
+		"get":    item.Get,
+		"post":   item.Post,
+		"put":    item.Put,
+		"patch":  item.Patch,
+		"delete": item.Delete,
+	}[method]
+	if op == nil {
+		t.Fatalf("%s %s not documented", method, path)
+	}
+
+	return op
+}
+
+func keys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func property(t *testing.T, schema *openapi.Schema, name string) *openapi.Schema {
+	t.Helper()
+
+	for _, prop := range schema.Properties {
+		if prop.Name == name {
+			return prop.Schema
+		}
+	}
+
+	return nil
+}
+
+func propertyNames(schema *openapi.Schema) []string {
+	names := make([]string, 0, len(schema.Properties))
+	for _, prop := range schema.Properties {
+		names = append(names, prop.Name)
+	}
+
+	return names
+}
+
+func parameterNames(op *openapi.Operation, in string) []string {
+	var names []string
+	for _, param := range op.Parameters {
+		if param.In == in {
+			names = append(names, param.Name)
+		}
+	}
+
+	return names
+}
+
+func TestQueryParameters(t *testing.T) {
+	op := operation(t, newDocument(t), "/v1/{name}", "get")
+
+	if got := parameterNames(op, "path"); !slices.Equal(got, []string{"name"}) {
+		t.Errorf("path parameters = %v", got)
+	}
+
+	// Repeated messages and maps cannot be carried by the query.
+	if got := parameterNames(op, "query"); !slices.Equal(got, []string{"revision", "filter.author"}) {
+		t.Errorf("query parameters = %v", got)
+	}
+
+	if op.RequestBody != nil {
+		t.Errorf("GET operation has a request body")
+	}
+
+	if op.Summary != "Gets a book." || op.Description != "The book must exist." {
+		t.Errorf("summary = %q, description = %q", op.Summary, op.Description)
+	}
+
+	if got := op.Parameters[0].Description; got != "Must match `shelves/*/books/*`." {
+		t.Errorf("path parameter description = %q", got)
+	}
+
+	if got := op.Parameters[1].Schema; got.Type != "string" || got.Format != "int64" {
+		t.Errorf("int64 query parameter schema = %+v", got)
+	}
+}
+
+func TestFieldBody(t *testing.T) {
+	op := operation(t, newDocument(t), "/v1/{parent}/books", "post")
+
+	if got := parameterNames(op, "query"); len(got) != 0 {
+		t.Errorf("query parameters = %v", got)
+	}
+
+	schema := op.RequestBody.Content["application/json"].Schema
+	if schema.Ref != "#/components/schemas/library.v1.Book" {
+		t.Errorf("request body schema = %+v", schema)
+	}
+}
+
+func TestWholeBodyExcludesNestedPathFields(t *testing.T) {
+	doc := newDocument(t)
+	op := operation(t, doc, "/v1/{book.name}", "patch")
+
+	if got := parameterNames(op, "path"); !slices.Equal(got, []string{"book.name"}) {
+		t.Errorf("path parameters = %v", got)
+	}
+
+	body := op.RequestBody.Content["application/json"].Schema
+	if got := propertyNames(body); !slices.Equal(got, []string{"book", "validateOnly"}) {
+		t.Fatalf("request body properties = %v", got)
+	}
+
+	book := property(t, body, "book")
+	if book.Ref != "" {
+		t.Fatalf("book is referenced, the component still holds name: %+v", book)
+	}
+
+	if got := propertyNames(book); !slices.Equal(got, []string{"title", "author", "pages"}) {
+		t.Errorf("book properties = %v", got)
+	}
+
+	if !slices.Equal(book.Required, []string{"title"}) {
+		t.Errorf("book required = %v", book.Required)
+	}
+
+	// The bound field is only left out where it is bound.
+	if got := propertyNames(doc.Components.Schemas["library.v1.Book"]); !slices.Equal(got, []string{"name", "title", "author", "pages"}) {
+		t.Errorf("Book component properties = %v", got)
+	}
+
+	// Only the messages on the path to the bound field are inlined.
+	op = operation(t, doc, "/v1/books/{book.author.id}", "put")
+	body = op.RequestBody.Content["application/json"].Schema
+	book = property(t, body, "book")
+	if got := propertyNames(book); !slices.Equal(got, []string{"name", "title", "author", "pages"}) {
+		t.Errorf("book properties = %v", got)
+	}
+
+	if got := propertyNames(property(t, book, "author")); !slices.Equal(got, []string{"displayName"}) {
+		t.Errorf("author properties = %v", got)
+	}
+}
+
+func TestConnectOperations(t *testing.T) {
+	doc := newDocument(t)
+
+	op := operation(t, doc, "/library.v1.LibraryService/DeleteBook", "post")
+	if !op.Deprecated {
+		t.Errorf("deprecated method not marked deprecated")
+	}
+
+	if got := parameterNames(op, "header"); !slices.Equal(got, []string{"Connect-Protocol-Version"}) {
+		t.Errorf("header parameters = %v", got)
+	}
+
+	// Streams have no Connect operation, unless bound to a route.
+	for _, path := range []string{"/library.v1.LibraryService/WatchBooks", "/library.v1.LibraryService/ImportBooks"} {
+		if _, ok := doc.Paths[path]; ok {
+			t.Errorf("stream %s documented", path)
+		}
+	}
+
+	if op := operation(t, doc, "/v1/{name}", "get"); op.Connect == nil || op.Connect.Procedure != "/library.v1.LibraryService/GetBook" {
+		t.Errorf("REST operation Connect call = %+v", op.Connect)
+	}
+}
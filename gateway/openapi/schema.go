@@ -0,0 +1,352 @@
+package openapi
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	httpBodyName = "google.api.HttpBody"
+	statusName   = "google.rpc.Status"
+)
+
+// ref returns a reference to the component schema of a message or enum.
+func ref(name protoreflect.FullName) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + string(name)}
+}
+
+// schemas builds the component schemas of the messages and enums referenced
+// by the operations, following the JSON mapping of protojson.
+type schemas struct {
+	components map[string]*Schema
+}
+
+func newSchemas() *schemas {
+	return &schemas{
+		components: map[string]*Schema{
+			statusName: statusSchema(),
+		},
+	}
+}
+
+// statusSchema describes the google.rpc.Status errors returned to REST and
+// Connect clients, whose proto may not be part of the schema.
+func statusSchema() *Schema {
+	return &Schema{
+		Type:        "object",
+		Description: "The error returned when a call fails.",
+		Properties: Properties{
+			{Name: "code", Schema: &Schema{Type: "integer", Format: "int32", Description: "The status code, a value of google.rpc.Code."}},
+			{Name: "message", Schema: &Schema{Type: "string", Description: "A developer-facing error message."}},
+			{Name: "details", Schema: &Schema{Type: "array", Items: anySchema(), Description: "Messages carrying the error details."}},
+		},
+	}
+}
+
+func anySchema() *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: Properties{
+			{Name: "@type", Schema: &Schema{Type: "string", Description: "The type URL of the message."}},
+		},
+		Required:             []string{"@type"},
+		AdditionalProperties: &Schema{},
+	}
+}
+
+// wellKnown returns the schema of the messages protojson encodes in a
+// special form.
+func wellKnown(md protoreflect.MessageDescriptor) (*Schema, bool) {
+	nullable := func(typ, format string) *Schema {
+		return &Schema{Type: []string{typ, "null"}, Format: format}
+	}
+
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return &Schema{Type: "string", Format: "date-time"}, true
+	case "google.protobuf.Duration":
+		return &Schema{Type: "string", Pattern: `^-?[0-9]+(\.[0-9]+)?s$`}, true
+	case "google.protobuf.FieldMask":
+		return &Schema{Type: "string", Description: "Comma-separated field paths in lowerCamelCase."}, true
+	case "google.protobuf.Empty":
+		return &Schema{Type: "object"}, true
+	case "google.protobuf.Any":
+		return anySchema(), true
+	case "google.protobuf.Struct":
+		return &Schema{Type: "object", AdditionalProperties: &Schema{}}, true
+	case "google.protobuf.Value":
+		return &Schema{}, true
+	case "google.protobuf.ListValue":
+		return &Schema{Type: "array", Items: &Schema{}}, true
+	case "google.protobuf.DoubleValue":
+		return nullable("number", "double"), true
+	case "google.protobuf.FloatValue":
+		return nullable("number", "float"), true
+	case "google.protobuf.Int64Value":
+		return nullable("string", "int64"), true
+	case "google.protobuf.UInt64Value":
+		return nullable("string", "uint64"), true
+	case "google.protobuf.Int32Value":
+		return nullable("integer", "int32"), true
+	case "google.protobuf.UInt32Value":
+		return nullable("integer", "int64"), true
+	case "google.protobuf.BoolValue":
+		return nullable("boolean", ""), true
+	case "google.protobuf.StringValue":
+		return nullable("string", ""), true
+	case "google.protobuf.BytesValue":
+		s := nullable("string", "")
+		s.ContentEncoding = "base64"
+		return s, true
+	default:
+		return nil, false
+	}
+}
+
+// isScalar reports whether a field is encoded as a single JSON value, which
+// query and path parameters can carry.
+func isScalar(fd protoreflect.FieldDescriptor) bool {
+	if fd.Message() == nil {
+		return true
+	}
+
+	switch fd.Message().FullName() {
+	case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.FieldMask",
+		"google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return true
+	default:
+		return false
+	}
+}
+
+// field returns the schema of a field value, described by its comments.
+func (s *schemas) field(fd protoreflect.FieldDescriptor) *Schema {
+	var schema *Schema
+	switch {
+	case fd.IsMap():
+		schema = &Schema{
+			Type:                 "object",
+			AdditionalProperties: s.singular(fd.MapValue()),
+		}
+	case fd.IsList():
+		schema = &Schema{
+			Type:  "array",
+			Items: s.singular(fd),
+		}
+	default:
+		schema = s.singular(fd)
+	}
+
+	return describeField(fd, schema)
+}
+
+// describeField sets the description, deprecation and access of a field on
+// the schema of its value.
+func describeField(fd protoreflect.FieldDescriptor, schema *Schema) *Schema {
+	schema.Description = comments(fd)
+
+	if opts, ok := fd.Options().(*descriptorpb.FieldOptions); ok && opts.GetDeprecated() {
+		schema.Deprecated = true
+	}
+
+	for _, behavior := range fieldBehaviors(fd) {
+		switch behavior {
+		case annotations.FieldBehavior_OUTPUT_ONLY:
+			schema.ReadOnly = true
+		case annotations.FieldBehavior_INPUT_ONLY:
+			schema.WriteOnly = true
+		}
+	}
+
+	return schema
+}
+
+// singular returns the schema of a single value of the field type.
+func (s *schemas) singular(fd protoreflect.FieldDescriptor) *Schema {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return &Schema{Type: "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return &Schema{Type: "integer", Format: "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return &Schema{Type: "integer", Format: "int64"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		// protojson encodes 64-bit integers as strings, which JavaScript
+		// numbers cannot represent.
+		return &Schema{Type: "string", Format: "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return &Schema{Type: "string", Format: "uint64"}
+	case protoreflect.FloatKind:
+		return &Schema{Type: "number", Format: "float"}
+	case protoreflect.DoubleKind:
+		return &Schema{Type: "number", Format: "double"}
+	case protoreflect.StringKind:
+		return &Schema{Type: "string"}
+	case protoreflect.BytesKind:
+		return &Schema{Type: "string", ContentEncoding: "base64"}
+	case protoreflect.EnumKind:
+		return s.enum(fd.Enum())
+	default:
+		return s.message(fd.Message())
+	}
+}
+
+// message returns the schema of a message, a reference to its component
+// unless it is a well-known type.
+func (s *schemas) message(md protoreflect.MessageDescriptor) *Schema {
+	if schema, ok := wellKnown(md); ok {
+		return schema
+	}
+
+	name := string(md.FullName())
+	if _, ok := s.components[name]; !ok {
+		// Registered before its fields so that recursive messages end.
+		schema := &Schema{}
+		s.components[name] = schema
+		*schema = *s.object(md, nil)
+	}
+
+	return ref(md.FullName())
+}
+
+// object returns the inline schema of a message without the excluded fields,
+// which are bound elsewhere in the request. exclude holds dotted field paths,
+// the messages holding a nested excluded field are inlined without it.
+func (s *schemas) object(md protoreflect.MessageDescriptor, exclude map[string]bool) *Schema {
+	schema := &Schema{
+		Type:        "object",
+		Title:       string(md.Name()),
+		Description: comments(md),
+	}
+
+	if opts, ok := md.Options().(*descriptorpb.MessageOptions); ok && opts.GetDeprecated() {
+		schema.Deprecated = true
+	}
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if exclude[string(fd.Name())] {
+			continue
+		}
+
+		var field *Schema
+		if nested := excludedBelow(exclude, fd); len(nested) > 0 {
+			field = describeField(fd, s.object(fd.Message(), nested))
+		} else {
+			field = s.field(fd)
+		}
+
+		schema.Properties = append(schema.Properties, &Property{
+			Name:   fd.JSONName(),
+			Schema: field,
+		})
+
+		if isRequired(fd) {
+			schema.Required = append(schema.Required, fd.JSONName())
+		}
+	}
+
+	return schema
+}
+
+// excludedBelow returns the excluded paths below a singular message field,
+// relative to its message.
+func excludedBelow(exclude map[string]bool, fd protoreflect.FieldDescriptor) map[string]bool {
+	if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+		return nil
+	}
+
+	var nested map[string]bool
+	for path := range exclude {
+		if rest, ok := strings.CutPrefix(path, string(fd.Name())+"."); ok {
+			if nested == nil {
+				nested = make(map[string]bool)
+			}
+
+			nested[rest] = true
+		}
+	}
+
+	return nested
+}
+
+// enum returns a reference to the component schema of an enum, whose values
+// are encoded by name.
+func (s *schemas) enum(ed protoreflect.EnumDescriptor) *Schema {
+	if ed.FullName() == "google.protobuf.NullValue" {
+		return &Schema{Type: "null"}
+	}
+
+	name := string(ed.FullName())
+	if _, ok := s.components[name]; ok {
+		return ref(ed.FullName())
+	}
+
+	schema := &Schema{
+		Type:  "string",
+		Title: string(ed.Name()),
+	}
+
+	var lines []string
+	if desc := comments(ed); desc != "" {
+		lines = append(lines, desc, "")
+	}
+
+	values := ed.Values()
+	for i := 0; i < values.Len(); i++ {
+		value := values.Get(i)
+		schema.Enum = append(schema.Enum, string(value.Name()))
+		if desc := comments(value); desc != "" {
+			lines = append(lines, fmt.Sprintf("- `%s`: %s", value.Name(), strings.ReplaceAll(desc, "\n", " ")))
+		}
+	}
+
+	schema.Description = strings.TrimSpace(strings.Join(lines, "\n"))
+	s.components[name] = schema
+
+	return ref(ed.FullName())
+}
+
+func fieldBehaviors(fd protoreflect.FieldDescriptor) []annotations.FieldBehavior {
+	behaviors, _ := proto.GetExtension(fd.Options(), annotations.E_FieldBehavior).([]annotations.FieldBehavior)
+	return behaviors
+}
+
+// isRequired reports whether the field is annotated as required with
+// google.api.field_behavior.
+func isRequired(fd protoreflect.FieldDescriptor) bool {
+	for _, behavior := range fieldBehaviors(fd) {
+		if behavior == annotations.FieldBehavior_REQUIRED {
+			return true
+		}
+	}
+
+	return false
+}
+
+// comments returns the comments attached to a descriptor in its source,
+// which is empty when the source info was stripped.
+func comments(d protoreflect.Descriptor) string {
+	loc := d.ParentFile().SourceLocations().ByDescriptor(d)
+
+	text := loc.LeadingComments
+	if strings.TrimSpace(text) == "" {
+		text = loc.TrailingComments
+	}
+
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
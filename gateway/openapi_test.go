@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serve returns the response of the gateway to a GET request to path.
+func serve(g *Gateway, path string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestOpenAPI(t *testing.T) {
+	g, _ := newUserGateway(t, WithOpenAPI())
+
+	for path, contentType := range map[string]string{
+		OpenAPIJSONPath: "application/json",
+		OpenAPIYAMLPath: "application/yaml",
+	} {
+		w := serve(g, path, nil)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != contentType {
+			t.Fatalf("%s: status %d, content type %q", path, w.Code, w.Header().Get("Content-Type"))
+		}
+
+		if body := w.Body.String(); !strings.Contains(body, "/v1/users/{page}") {
+			t.Errorf("%s does not describe the REST route:\n%s", path, body)
+		}
+
+		etag := w.Header().Get("ETag")
+		if etag != `"`+g.state.Load().hash+`"` {
+			t.Errorf("%s: ETag %q is not the schema hash", path, etag)
+		}
+
+		if w := serve(g, path, http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+			t.Errorf("%s: status of a conditional request = %d", path, w.Code)
+		}
+	}
+}
+
+func TestOpenAPIFollowsReloads(t *testing.T) {
+	g, dir := newEchoGateway(t, WithOpenAPI())
+	etag := serve(g, OpenAPIJSONPath, nil).Header().Get("ETag")
+
+	writeFile(t, filepath.Join(dir, "echo", "v1", "echo.proto"), []byte(withMethod("Shout")))
+	if err := g.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(g, OpenAPIJSONPath, http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/echo.v1.EchoService/Shout") {
+		t.Errorf("document after reload: status %d\n%s", w.Code, w.Body)
+	}
+}
+
+func TestOpenAPIDisabled(t *testing.T) {
+	g, _ := newUserGateway(t)
+
+	if w := serve(g, OpenAPIJSONPath, nil); w.Code != http.StatusNotFound {
+		t.Errorf("status without WithOpenAPI = %d", w.Code)
+	}
+}
@@ -0,0 +1,182 @@
+package gateway
+
+import (
+	"net/http"
+	"net/url"
+
+	"connectrpc.com/vanguard"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures a Gateway.
+type Option func(*options)
+
+type options struct {
+	source         SchemaSource
+	upstream       *Upstream
+	routes         routeTable
+	transport      http.RoundTripper
+	reflection     bool
+	health         bool
+	openAPI        bool
+	metrics        bool
+	registerer     prometheus.Registerer
+	tracer         trace.Tracer
+	errorFormat    ErrorFormat
+	explorerPath   string
+	serviceOptions []vanguard.ServiceOption
+	middleware     []Middleware
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.transport == nil {
+		o.transport = NewH2CTransport()
+	}
+
+	return o
+}
+
+// WithSchemaSource sets the source the gateway loads its services from.
+func WithSchemaSource(source SchemaSource) Option {
+	return func(o *options) {
+		o.source = source
+	}
+}
+
+// WithUpstream sets the backend requests are proxied to unless a service is
+// routed elsewhere.
+func WithUpstream(target *url.URL) Option {
+	return WithDefaultUpstream(&Upstream{
+		Name:   "default",
+		Target: target,
+	})
+}
+
+// WithDefaultUpstream sets the upstream of services without a route.
+func WithDefaultUpstream(upstream *Upstream) Option {
+	return func(o *options) {
+		o.upstream = upstream
+	}
+}
+
+// WithServiceUpstream routes the services matching pattern to upstream. The
+// pattern is either a fully-qualified service name or a package glob such as
+// "billing.*" or "billing.**", see MatchService. A service routed by name
+// ignores the globs, otherwise the first matching glob wins.
+func WithServiceUpstream(pattern string, upstream *Upstream) Option {
+	return func(o *options) {
+		o.routes.add(pattern, upstream)
+	}
+}
+
+// WithTransport overrides the transport used to reach the upstream. It
+// defaults to NewH2CTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithReflection mounts the gRPC server reflection v1 and v1alpha handlers
+// for the loaded services.
+func WithReflection() Option {
+	return func(o *options) {
+		o.reflection = true
+	}
+}
+
+// WithHealth serves grpc.health.v1.Health, whose per service status follows
+// the health of the upstream the service is proxied to, along with the
+// LivenessPath and ReadinessPath HTTP endpoints, see Gateway.Ready.
+func WithHealth() Option {
+	return func(o *options) {
+		o.health = true
+	}
+}
+
+// WithOpenAPI serves an OpenAPI 3.1 document describing the loaded services
+// at OpenAPIJSONPath and OpenAPIYAMLPath. It is generated again whenever the
+// schema is reloaded.
+func WithOpenAPI() Option {
+	return func(o *options) {
+		o.openAPI = true
+	}
+}
+
+// WithExplorer serves a web UI below path, DefaultExplorerPath when empty,
+// to browse the loaded services and send them REST and Connect requests. It
+// implies WithOpenAPI, whose document the explorer renders. Loading a schema
+// fails when the explorer would shadow one of its routes, see
+// ValidateExplorerPath for the other paths it must not shadow.
+func WithExplorer(path string) Option {
+	return func(o *options) {
+		if path == "" {
+			path = DefaultExplorerPath
+		}
+
+		o.openAPI = true
+		o.explorerPath = path
+	}
+}
+
+// WithMetrics records the metrics of every transcoded call: counts by gRPC
+// status code, latencies, calls in flight and message sizes, labelled with
+// the service, method and inbound protocol, along with those of the
+// upstreams and schema reloads. They are registered with reg, the Prometheus
+// default registerer when nil, and served at MetricsPath from reg when it is
+// a prometheus.Gatherer, such as a *prometheus.Registry. Nothing is
+// registered or recorded without WithMetrics.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(o *options) {
+		if reg == nil {
+			reg = prometheus.DefaultRegisterer
+		}
+
+		o.metrics = true
+		o.registerer = reg
+	}
+}
+
+// WithTracerProvider traces every transcoded call with a server span named
+// after its method, whose children cover the routing of the call to the
+// proxy and the upstream request. The trace context of the call, W3C trace
+// context or grpc-trace-bin, is propagated to the upstream in both formats.
+// See NewTracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithErrorFormat renders the errors returned to REST clients in format.
+// The status of the upstream response is decoded from its
+// grpc-status-details-bin metadata, or its body for Connect, and its details
+// are resolved with the types of the schema, along with the standard
+// details of google/rpc/error_details.proto. Errors are left as written by
+// vanguard otherwise.
+func WithErrorFormat(format ErrorFormat) Option {
+	return func(o *options) {
+		o.errorFormat = format
+	}
+}
+
+// WithServiceOptions appends options applied to every vanguard.Service.
+func WithServiceOptions(opts ...vanguard.ServiceOption) Option {
+	return func(o *options) {
+		o.serviceOptions = append(o.serviceOptions, opts...)
+	}
+}
+
+// WithMiddleware appends middleware wrapping the gateway handler. The first
+// middleware is the outermost one.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, middleware...)
+	}
+}
@@ -0,0 +1,460 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DefaultMaxPayloadSize bounds the bytes of the request and of the response
+// captured by PayloadLog when no limit is given.
+const DefaultMaxPayloadSize = 64 << 10
+
+// Redacted replaces the value of the redacted string fields.
+const Redacted = "[REDACTED]"
+
+// PayloadLog configures the logging of the messages of the calls by
+// AccessLog. Messages are decoded with the types of the schema and logged as
+// protojson, a single object for unary calls and an array for streams.
+type PayloadLog struct {
+	// SampleRatio is the ratio of the calls whose messages are logged.
+	SampleRatio float64
+	// MethodSampleRatios overrides SampleRatio for the methods or services
+	// it names, as package.Service/Method or package.Service.
+	MethodSampleRatios map[string]float64
+	// Redact lists the fields masked in every message, as fully-qualified
+	// names such as user.v1.User.name, in addition to the fields with the
+	// debug_redact option. Redacted strings are replaced with Redacted, other
+	// fields are cleared.
+	Redact []string
+	// MaxSize bounds the bytes captured in each direction,
+	// DefaultMaxPayloadSize when zero. The messages beyond are not logged.
+	MaxSize int
+}
+
+// payloadLogger decides which calls have their messages logged.
+type payloadLogger struct {
+	conf   PayloadLog
+	redact map[protoreflect.FullName]bool
+}
+
+func newPayloadLogger(conf PayloadLog) *payloadLogger {
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = DefaultMaxPayloadSize
+	}
+
+	redact := make(map[protoreflect.FullName]bool, len(conf.Redact))
+	for _, name := range conf.Redact {
+		redact[protoreflect.FullName(name)] = true
+	}
+
+	return &payloadLogger{
+		conf:   conf,
+		redact: redact,
+	}
+}
+
+// sampled reports whether the messages of a call to md are logged.
+func (l *payloadLogger) sampled(md protoreflect.MethodDescriptor) bool {
+	service := string(md.Parent().FullName())
+
+	ratio, ok := l.conf.MethodSampleRatios[service+"/"+string(md.Name())]
+	if !ok {
+		ratio, ok = l.conf.MethodSampleRatios[service]
+	}
+
+	if !ok {
+		ratio = l.conf.SampleRatio
+	}
+
+	return ratio >= 1 || ratio > 0 && rand.Float64() < ratio
+}
+
+// payloads captures the bodies of the upstream request of a call, whose
+// messages are always enveloped or bare gRPC, gRPC-Web or Connect messages
+// whatever the inbound protocol.
+type payloads struct {
+	logger *payloadLogger
+	types  *dynamicpb.Types
+
+	requestHeader  http.Header
+	request        capturedBody
+	responseHeader http.Header
+	response       capturedBody
+	status         int
+}
+
+// capture wraps the body of the upstream request, which must be a copy owned
+// by the caller, and returns the response writer to serve it with.
+func (p *payloads) capture(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	max := p.logger.conf.MaxSize
+
+	p.requestHeader = r.Header
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &captureReader{ReadCloser: r.Body, body: &p.request, max: max}
+	}
+
+	p.responseHeader = w.Header()
+
+	return &captureWriter{ResponseWriter: w, payloads: p, max: max}
+}
+
+// log adds the messages of the call to e, redacted.
+func (p *payloads) log(e *zerolog.Event, md protoreflect.MethodDescriptor) *zerolog.Event {
+	var errs []error
+
+	requestBody, requestTruncated := p.request.snapshot()
+	responseBody, responseTruncated := p.response.snapshot()
+
+	request, err := p.json(requestBody, p.requestHeader, md.Input(), md.IsStreamingClient())
+	if err != nil {
+		errs = append(errs, fmt.Errorf("request: %w", err))
+	}
+
+	if request != nil {
+		e = e.RawJSON("request", request)
+	}
+
+	// Errors are not messages, their code is already logged.
+	if p.status == 0 || p.status == http.StatusOK {
+		response, err := p.json(responseBody, p.responseHeader, md.Output(), md.IsStreamingServer())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("response: %w", err))
+		}
+
+		if response != nil {
+			e = e.RawJSON("response", response)
+		}
+	}
+
+	if requestTruncated {
+		e = e.Bool("request_truncated", true)
+	}
+
+	if responseTruncated {
+		e = e.Bool("response_truncated", true)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		e = e.Str("payload_error", err.Error())
+	}
+
+	return e
+}
+
+// json returns the redacted messages of a body as protojson, nil when it
+// holds none.
+func (p *payloads) json(body []byte, header http.Header, md protoreflect.MessageDescriptor, stream bool) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+
+	msgs, err := p.decode(body, header, md)
+	if len(msgs) == 0 {
+		return nil, err
+	}
+
+	opts := protojson.MarshalOptions{Resolver: p.types}
+
+	var out []byte
+	for i, msg := range msgs {
+		p.redact(msg.ProtoReflect())
+
+		data, merr := opts.Marshal(msg)
+		if merr != nil {
+			return nil, merr
+		}
+
+		if !stream {
+			return data, err
+		}
+
+		if i == 0 {
+			out = append(out, '[')
+		} else {
+			out = append(out, ',')
+		}
+
+		out = append(out, data...)
+	}
+
+	return append(out, ']'), err
+}
+
+// decode decodes the messages of a body in the framing given by its headers.
+// A truncated body yields the messages it holds entirely.
+func (p *payloads) decode(data []byte, header http.Header, md protoreflect.MessageDescriptor) ([]proto.Message, error) {
+	codec, enveloped, ok := messageFraming(header)
+	if !ok {
+		return nil, fmt.Errorf("unsupported content type %q", header.Get("Content-Type"))
+	}
+
+	unmarshal := func(data []byte) (proto.Message, error) {
+		msg := dynamicpb.NewMessage(md)
+		if codec == "json" {
+			return msg, protojson.UnmarshalOptions{Resolver: p.types, DiscardUnknown: true}.Unmarshal(data, msg)
+		}
+
+		return msg, proto.UnmarshalOptions{Resolver: p.types}.Unmarshal(data, msg)
+	}
+
+	if !enveloped {
+		data, err := decompress(data, header.Get("Content-Encoding"))
+		if err != nil {
+			return nil, err
+		}
+
+		msg, err := unmarshal(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return []proto.Message{msg}, nil
+	}
+
+	encoding := header.Get("Grpc-Encoding")
+	if encoding == "" {
+		encoding = header.Get("Connect-Content-Encoding")
+	}
+
+	var msgs []proto.Message
+	for len(data) >= 5 {
+		flags, size := data[0], binary.BigEndian.Uint32(data[1:5])
+		if uint64(len(data)-5) < uint64(size) {
+			break
+		}
+
+		frame := data[5 : 5+size]
+		data = data[5+size:]
+
+		// gRPC-Web trailers and the end of Connect streams.
+		if flags&0x80 != 0 || flags&0x02 != 0 {
+			continue
+		}
+
+		if flags&1 != 0 {
+			var err error
+			if frame, err = decompress(frame, encoding); err != nil {
+				return msgs, err
+			}
+		}
+
+		msg, err := unmarshal(frame)
+		if err != nil {
+			return msgs, err
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
+
+func decompress(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", "identity":
+		return data, nil
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		return io.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+// redact masks the fields of m listed in PayloadLog.Redact or carrying the
+// debug_redact option, in nested and Any messages too.
+func (p *payloads) redact(m protoreflect.Message) {
+	var masked []protoreflect.FieldDescriptor
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case p.isRedacted(fd):
+			masked = append(masked, fd)
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					p.redact(v.Message())
+					return true
+				})
+			}
+		case fd.Message() == nil:
+		case fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				p.redact(v.List().Get(i).Message())
+			}
+		default:
+			p.redact(v.Message())
+		}
+
+		return true
+	})
+
+	for _, fd := range masked {
+		mask(m, fd)
+	}
+
+	if m.Descriptor().FullName() == "google.protobuf.Any" {
+		p.redactAny(m)
+	}
+}
+
+func (p *payloads) isRedacted(fd protoreflect.FieldDescriptor) bool {
+	if p.logger.redact[fd.FullName()] {
+		return true
+	}
+
+	opts, ok := fd.Options().(*descriptorpb.FieldOptions)
+	return ok && opts.GetDebugRedact()
+}
+
+// redactAny redacts the message packed in an Any, when its type is known.
+func (p *payloads) redactAny(m protoreflect.Message) {
+	fields := m.Descriptor().Fields()
+	typeURL, value := fields.ByName("type_url"), fields.ByName("value")
+	if typeURL == nil || value == nil || !m.Has(value) {
+		return
+	}
+
+	mt, err := p.types.FindMessageByURL(m.Get(typeURL).String())
+	if err != nil {
+		return
+	}
+
+	packed := mt.New()
+	if err = (proto.UnmarshalOptions{Resolver: p.types}).Unmarshal(m.Get(value).Bytes(), packed.Interface()); err != nil {
+		return
+	}
+
+	p.redact(packed)
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(packed.Interface())
+	if err == nil {
+		m.Set(value, protoreflect.ValueOfBytes(data))
+	}
+}
+
+// mask replaces the strings of a redacted field with Redacted and clears the
+// fields of other kinds.
+func mask(m protoreflect.Message, fd protoreflect.FieldDescriptor) {
+	redacted := protoreflect.ValueOfString(Redacted)
+
+	switch {
+	case fd.IsMap() && fd.MapValue().Kind() == protoreflect.StringKind:
+		values := m.Mutable(fd).Map()
+
+		var keys []protoreflect.MapKey
+		values.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+			keys = append(keys, k)
+			return true
+		})
+
+		for _, k := range keys {
+			values.Set(k, redacted)
+		}
+	case fd.IsMap() || fd.Kind() != protoreflect.StringKind:
+		m.Clear(fd)
+	case fd.IsList():
+		list := m.Mutable(fd).List()
+		for i := 0; i < list.Len(); i++ {
+			list.Set(i, redacted)
+		}
+	default:
+		m.Set(fd, redacted)
+	}
+}
+
+// capturedBody holds the beginning of a body. The request body is read by
+// the proxy transport on its own goroutine, which may still be running when
+// the call is logged, hence the lock.
+type capturedBody struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *capturedBody) capture(p []byte, max int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if room := max - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		p = p[:room]
+	}
+
+	b.buf.Write(p)
+}
+
+// snapshot returns a copy of the bytes captured so far and whether the body
+// was truncated.
+func (b *capturedBody) snapshot() ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return bytes.Clone(b.buf.Bytes()), b.truncated
+}
+
+// captureReader captures the request body read by the proxy.
+type captureReader struct {
+	io.ReadCloser
+	body *capturedBody
+	max  int
+}
+
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.body.capture(p[:n], r.max)
+
+	return n, err
+}
+
+// captureWriter captures the response written by the proxy.
+type captureWriter struct {
+	http.ResponseWriter
+	payloads *payloads
+	max      int
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if w.payloads.status == 0 {
+		w.payloads.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.payloads.response.capture(p[:n], w.max)
+
+	return n, err
+}
+
+// Flush implements http.Flusher, which streaming responses rely on.
+func (w *captureWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,314 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const accountProto = `
+syntax = "proto3";
+
+package account.v1;
+
+import "google/api/annotations.proto";
+
+service AccountService {
+  rpc Login(LoginRequest) returns (LoginResponse) {
+    option (google.api.http) = {post: "/v1/login" body: "*"};
+  }
+
+  rpc Import(stream LoginRequest) returns (LoginResponse);
+}
+
+message LoginRequest {
+  string user = 1;
+  string password = 2 [debug_redact = true];
+  Profile profile = 3;
+}
+
+message Profile {
+  string email = 1 [debug_redact = true];
+  int64 pin = 2 [debug_redact = true];
+  repeated string tags = 3;
+}
+
+message LoginResponse {
+  string user = 1;
+  string token = 2 [debug_redact = true];
+  Profile profile = 3;
+}
+`
+
+// writeProto writes a proto file named name to a new import path, returned
+// along with the googleapis.
+func writeProto(t *testing.T, name, content string) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, path, []byte(content))
+
+	return []string{dir, "../googleapis"}
+}
+
+// accountService serves account.v1.AccountService with dynamic messages.
+// Login and Import answer with the user of the last request, its profile and
+// a token.
+type accountService struct {
+	svcDesc protoreflect.ServiceDescriptor
+}
+
+func (s *accountService) handler() http.Handler {
+	login := s.svcDesc.Methods().ByName("Login")
+	imp := s.svcDesc.Methods().ByName("Import")
+
+	mux := http.NewServeMux()
+	mux.Handle(procedure(login), connect.NewUnaryHandler(procedure(login),
+		func(_ context.Context, req *connect.Request[dynamicpb.Message]) (*connect.Response[dynamicpb.Message], error) {
+			return connect.NewResponse(s.respond(req.Msg)), nil
+		},
+		connect.WithSchema(login),
+		connect.WithRequestInitializer(initializer(login.Input())),
+	))
+	mux.Handle(procedure(imp), connect.NewClientStreamHandler(procedure(imp),
+		func(_ context.Context, stream *connect.ClientStream[dynamicpb.Message]) (*connect.Response[dynamicpb.Message], error) {
+			last := dynamicpb.NewMessage(imp.Input())
+			for stream.Receive() {
+				last = stream.Msg()
+			}
+
+			if err := stream.Err(); err != nil {
+				return nil, err
+			}
+
+			return connect.NewResponse(s.respond(last)), nil
+		},
+		connect.WithSchema(imp),
+		connect.WithRequestInitializer(initializer(imp.Input())),
+	))
+
+	return mux
+}
+
+func (s *accountService) respond(req *dynamicpb.Message) *dynamicpb.Message {
+	input := req.Descriptor().Fields()
+	output := s.svcDesc.Methods().ByName("Login").Output()
+
+	res := dynamicpb.NewMessage(output)
+	res.Set(output.Fields().ByName("user"), req.Get(input.ByName("user")))
+	res.Set(output.Fields().ByName("token"), protoreflect.ValueOfString("secret-token"))
+	if req.Has(input.ByName("profile")) {
+		res.Set(output.Fields().ByName("profile"), req.Get(input.ByName("profile")))
+	}
+
+	return res
+}
+
+func procedure(md protoreflect.MethodDescriptor) string {
+	return "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+}
+
+// initializer makes connect decode into dynamic messages of md.
+func initializer(md protoreflect.MessageDescriptor) func(connect.Spec, any) error {
+	return func(_ connect.Spec, msg any) error {
+		*msg.(*dynamicpb.Message) = *dynamicpb.NewMessage(md)
+		return nil
+	}
+}
+
+// lineWriter hands every access log line to the test, which is written once
+// the response is already on its way to the client.
+type lineWriter chan map[string]any
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	var line map[string]any
+	if err := json.Unmarshal(p, &line); err != nil {
+		return 0, err
+	}
+
+	w <- line
+
+	return len(p), nil
+}
+
+func (w lineWriter) next(t *testing.T) map[string]any {
+	t.Helper()
+
+	select {
+	case line := <-w:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("no access log line written")
+		return nil
+	}
+}
+
+// newAccountGateway serves the account.v1 schema with its messages logged,
+// along with metrics so the bodies are counted as well as captured.
+func newAccountGateway(t *testing.T, payloads *PayloadLog) (protoreflect.ServiceDescriptor, lineWriter, string) {
+	t.Helper()
+
+	source := NewCompilerSource(writeProto(t, "account/v1/account.proto", accountProto), "account/v1/account.proto")
+	schema, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svcDesc := schema.Services[0]
+	upstream := newUpstream(t, (&accountService{svcDesc: svcDesc}).handler())
+
+	lines := make(lineWriter, 16)
+	_, addr := newTestGateway(t,
+		WithSchemaSource(source),
+		WithUpstream(upstream),
+		WithMetrics(prometheus.NewRegistry()),
+		WithMiddleware(AccessLog(zerolog.New(lines), payloads)),
+	)
+
+	return svcDesc, lines, addr
+}
+
+func newMessage(t *testing.T, md protoreflect.MessageDescriptor, data string) *dynamicpb.Message {
+	t.Helper()
+
+	msg := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal([]byte(data), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	return msg
+}
+
+// field returns the value at a dotted path of a logged JSON object.
+func field(line map[string]any, path string) any {
+	var value any = line
+	for _, name := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+
+		value = obj[name]
+	}
+
+	return value
+}
+
+func TestAccessLogRedactsPayloads(t *testing.T) {
+	_, lines, addr := newAccountGateway(t, &PayloadLog{
+		SampleRatio: 1,
+		Redact:      []string{"account.v1.LoginRequest.user"},
+	})
+
+	body := `{"user":"alice","password":"hunter2","profile":{"email":"alice@example.com","pin":"1234","tags":["admin"]}}`
+	res, err := http.Post(addr+"/v1/login", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+
+	line := lines.next(t)
+
+	want := map[string]any{
+		// Listed in Redact.
+		"request.user": Redacted,
+		// Carrying debug_redact, in nested messages too.
+		"request.password":       Redacted,
+		"request.profile.email":  Redacted,
+		"request.profile.pin":    nil,
+		"response.token":         Redacted,
+		"response.profile.email": Redacted,
+		"response.profile.pin":   nil,
+		"response.user":          "alice",
+	}
+
+	for path, value := range want {
+		if got := field(line, path); got != value {
+			t.Errorf("%s = %v, want %v", path, got, value)
+		}
+	}
+
+	if tags, _ := field(line, "response.profile.tags").([]any); len(tags) != 1 || tags[0] != "admin" {
+		t.Errorf("response.profile.tags = %v", field(line, "response.profile.tags"))
+	}
+}
+
+func TestAccessLogClientStream(t *testing.T) {
+	svcDesc, lines, addr := newAccountGateway(t, &PayloadLog{SampleRatio: 1})
+	md := svcDesc.Methods().ByName("Import")
+
+	client := connect.NewClient[dynamicpb.Message, dynamicpb.Message](h2cClient(), addr+procedure(md),
+		connect.WithGRPC(),
+		connect.WithSchema(md),
+		connect.WithResponseInitializer(initializer(md.Output())),
+	)
+
+	stream := client.CallClientStream(context.Background())
+	for _, user := range []string{"alice", "bob"} {
+		if err := stream.Send(newMessage(t, md.Input(), `{"user":"`+user+`","password":"hunter2"}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := stream.CloseAndReceive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := res.Msg.Get(md.Output().Fields().ByName("user")).String(); got != "bob" {
+		t.Errorf("user = %q", got)
+	}
+
+	line := lines.next(t)
+
+	requests, _ := line["request"].([]any)
+	if len(requests) != 2 {
+		t.Fatalf("request = %v", line["request"])
+	}
+
+	for _, request := range requests {
+		if password := request.(map[string]any)["password"]; password != Redacted {
+			t.Errorf("password = %v", password)
+		}
+	}
+
+	if got := field(line, "response.token"); got != Redacted {
+		t.Errorf("response.token = %v", got)
+	}
+
+	// A stream aborted by the client is logged as well, while the proxy may
+	// still be reading its body.
+	ctx, cancel := context.WithCancel(context.Background())
+	stream = client.CallClientStream(ctx)
+	if err = stream.Send(newMessage(t, md.Input(), `{"user":"carol"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	_, _ = stream.CloseAndReceive()
+
+	if line = lines.next(t); line["method"] != "account.v1.AccountService/Import" {
+		t.Errorf("method = %v", line["method"])
+	}
+}
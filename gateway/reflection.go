@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"errors"
+
+	"connectrpc.com/grpcreflect"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Services implemented by the gateway itself rather than proxied.
+const (
+	reflectionV1Service      = "grpc.reflection.v1.ServerReflection"
+	reflectionV1AlphaService = "grpc.reflection.v1alpha.ServerReflection"
+)
+
+// newReflector returns a reflector describing the services of the gateway.
+func (g *Gateway) newReflector() *grpcreflect.Reflector {
+	src := reflectionSource{g: g}
+
+	return grpcreflect.NewReflector(src,
+		grpcreflect.WithDescriptorResolver(src),
+		grpcreflect.WithExtensionResolver(src),
+	)
+}
+
+// reflectionSource answers reflection requests from the schema currently
+// served rather than the one the handler was built with: clients such as
+// grpcurl keep a single stream for their whole session, which must describe
+// the new schema once it is reloaded. Every lookup reads the registry built
+// by the schema source, never protoregistry.GlobalFiles, except for the
+// services the gateway implements itself.
+type reflectionSource struct {
+	g *Gateway
+}
+
+var (
+	_ grpcreflect.Namer             = reflectionSource{}
+	_ grpcreflect.ExtensionResolver = reflectionSource{}
+)
+
+func (r reflectionSource) files() *protoregistry.Files {
+	return r.g.state.Load().schema.Files
+}
+
+// localServices returns the services the gateway implements itself.
+func (r reflectionSource) localServices() []string {
+	var names []string
+	if r.g.opts.reflection {
+		names = append(names, reflectionV1Service, reflectionV1AlphaService)
+	}
+
+	if r.g.opts.health {
+		names = append(names, healthpb.Health_ServiceDesc.ServiceName)
+	}
+
+	return names
+}
+
+// isLocal reports whether file declares one of the services the gateway
+// implements itself.
+func (r reflectionSource) isLocal(file protoreflect.FileDescriptor) bool {
+	for _, name := range r.localServices() {
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if err == nil && desc.ParentFile().Path() == file.Path() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Names implements grpcreflect.Namer.
+func (r reflectionSource) Names() []string {
+	names := r.g.state.Load().schema.ServiceNames()
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+
+	// A proxied service of the same name is shadowed by the gateway.
+	for _, name := range r.localServices() {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// FindFileByPath implements protodesc.Resolver.
+func (r reflectionSource) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	fd, err := r.files().FindFileByPath(path)
+	if !errors.Is(err, protoregistry.NotFound) {
+		return fd, err
+	}
+
+	fd, err = protoregistry.GlobalFiles.FindFileByPath(path)
+	if err != nil || !r.isLocal(fd) {
+		return nil, protoregistry.NotFound
+	}
+
+	return fd, nil
+}
+
+// FindDescriptorByName implements protodesc.Resolver.
+func (r reflectionSource) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	desc, err := r.files().FindDescriptorByName(name)
+	if !errors.Is(err, protoregistry.NotFound) {
+		return desc, err
+	}
+
+	desc, err = protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil || !r.isLocal(desc.ParentFile()) {
+		return nil, protoregistry.NotFound
+	}
+
+	return desc, nil
+}
+
+// FindExtensionByName implements grpcreflect.ExtensionResolver.
+func (r reflectionSource) FindExtensionByName(name protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	desc, err := r.files().FindDescriptorByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	xd, ok := desc.(protoreflect.ExtensionDescriptor)
+	if !ok {
+		return nil, protoregistry.NotFound
+	}
+
+	return dynamicpb.NewExtensionType(xd), nil
+}
+
+// FindExtensionByNumber implements grpcreflect.ExtensionResolver.
+func (r reflectionSource) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	var found protoreflect.ExtensionType
+	r.RangeExtensionsByMessage(message, func(xt protoreflect.ExtensionType) bool {
+		if xt.TypeDescriptor().Number() == field {
+			found = xt
+			return false
+		}
+
+		return true
+	})
+
+	if found == nil {
+		return nil, protoregistry.NotFound
+	}
+
+	return found, nil
+}
+
+// RangeExtensionsByMessage implements grpcreflect.ExtensionResolver.
+func (r reflectionSource) RangeExtensionsByMessage(message protoreflect.FullName, fn func(protoreflect.ExtensionType) bool) {
+	rangeExtensions(r.files(), func(xd protoreflect.ExtensionDescriptor) bool {
+		if xd.ContainingMessage().FullName() != message {
+			return true
+		}
+
+		return fn(dynamicpb.NewExtensionType(xd))
+	})
+}
+
+// rangeExtensions calls fn for every extension declared in the registry,
+// stopping when fn returns false.
+func rangeExtensions(files *protoregistry.Files, fn func(protoreflect.ExtensionDescriptor) bool) {
+	type container interface {
+		Messages() protoreflect.MessageDescriptors
+		Extensions() protoreflect.ExtensionDescriptors
+	}
+
+	var walk func(c container) bool
+	walk = func(c container) bool {
+		exts := c.Extensions()
+		for i := 0; i < exts.Len(); i++ {
+			if !fn(exts.Get(i)) {
+				return false
+			}
+		}
+
+		msgs := c.Messages()
+		for i := 0; i < msgs.Len(); i++ {
+			if !walk(msgs.Get(i)) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		return walk(fd)
+	})
+}
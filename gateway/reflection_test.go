@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpcreflect"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestReflection(t *testing.T) {
+	g, dir := newEchoGateway(t, WithReflection(), WithHealth())
+
+	srv := httptest.NewServer(g.NewServer("").Handler)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A single stream, as kept by clients such as grpcurl, follows reloads.
+	stream := grpcreflect.NewClient(h2cClient(), srv.URL, connect.WithGRPC()).NewStream(ctx)
+	defer stream.Close()
+
+	names, err := stream.ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []protoreflect.FullName{
+		"echo.v1.EchoService",
+		reflectionV1Service,
+		reflectionV1AlphaService,
+		"grpc.health.v1.Health",
+	} {
+		if !slices.Contains(names, name) {
+			t.Errorf("services %v do not list %s", names, name)
+		}
+	}
+
+	// Files registered globally by the binary are not exposed, except those
+	// of the services implemented by the gateway.
+	if _, err := stream.FileByFilename("user/v1/user.proto"); err == nil {
+		t.Error("file of the binary exposed")
+	}
+
+	if _, err := stream.FileContainingSymbol("grpc.health.v1.Health"); err != nil {
+		t.Errorf("health service not described: %v", err)
+	}
+
+	writeFile(t, filepath.Join(dir, "echo", "v1", "echo.proto"), []byte(withMethod("Shout")))
+	if err := g.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := stream.FileContainingSymbol("echo.v1.EchoService.Shout")
+	if err != nil {
+		t.Fatalf("reloaded method not described: %v", err)
+	}
+
+	if len(files) == 0 || files[0].GetName() != "echo/v1/echo.proto" {
+		t.Errorf("files = %v", files)
+	}
+
+	// The reloaded schema can be loaded back from the gateway.
+	schema, err := NewReflectSource(h2cClient(), srv.URL, connect.WithGRPC()).Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := methodNames(schema); !slices.Equal(got, []string{"Echo", "Shout"}) {
+		t.Errorf("methods = %v", got)
+	}
+}
@@ -0,0 +1,30 @@
+package gateway
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Refresh reloads the gateway every interval until ctx is done, so services
+// added to or removed from an upstream discovered over reflection show up
+// without a restart. The handler is only swapped when the schema changed.
+// Failed reloads are logged and the previous schema keeps being served.
+func (g *Gateway) Refresh(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Info().Dur("interval", interval).Msg("refreshing schema periodically")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := g.Reload(ctx); err != nil {
+				log.Err(err).Msg("could not refresh schema, keeping the previous one")
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingSource counts the loads of a SchemaSource.
+type countingSource struct {
+	SchemaSource
+	loads atomic.Int32
+}
+
+func (s *countingSource) Load(ctx context.Context) (*Schema, error) {
+	s.loads.Add(1)
+	return s.SchemaSource.Load(ctx)
+}
+
+func TestRefresh(t *testing.T) {
+	importPaths := writeProto(t, "echo/v1/echo.proto", echoProto)
+	source := &countingSource{SchemaSource: NewParserSource(importPaths, "echo/v1/echo.proto")}
+
+	g, err := New(context.Background(),
+		WithSchemaSource(source),
+		WithUpstream(&url.URL{Scheme: "http", Host: "localhost"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Refresh(ctx, 10*time.Millisecond)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Refresh = %v", err)
+		}
+	})
+
+	// An unchanged schema is loaded again but not swapped.
+	st := g.state.Load()
+	for source.loads.Load() < 3 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if g.state.Load() != st {
+		t.Fatal("unchanged schema swapped")
+	}
+
+	writeFile(t, filepath.Join(importPaths[0], "echo", "v1", "echo.proto"), []byte(withMethod("Shout")))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(methodNames(g.Schema())) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("changed schema not swapped")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,218 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ConflictError is returned when the same file or fully-qualified name is
+// defined more than once with a different content.
+type ConflictError struct {
+	// Name is the conflicting file path or fully-qualified name.
+	Name string
+	// Files are the paths of the two files defining Name. Both are the same
+	// path when a file is defined twice with a different content.
+	Files [2]string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Files[0] == e.Files[1] {
+		return fmt.Sprintf("file %q is defined twice with a different content", e.Name)
+	}
+
+	return fmt.Sprintf("%q is defined by both %q and %q", e.Name, e.Files[0], e.Files[1])
+}
+
+// registerFile registers the file unless an identical file with the same
+// path is already known to the registry. A ConflictError is returned when a
+// different file with that path, or a file declaring one of the same
+// symbols, was registered before.
+func registerFile(files *protoregistry.Files, file protoreflect.FileDescriptor) error {
+	if existing, err := files.FindFileByPath(file.Path()); err == nil {
+		if sameFile(existing, file) {
+			return nil
+		}
+
+		return &ConflictError{
+			Name:  file.Path(),
+			Files: [2]string{existing.Path(), file.Path()},
+		}
+	}
+
+	if err := files.RegisterFile(file); err != nil {
+		if conflict := findConflict(files, file); conflict != nil {
+			return conflict
+		}
+
+		return fmt.Errorf("could not register file %q: %w", file.Path(), err)
+	}
+
+	return nil
+}
+
+// sameFile reports whether both files have the same content, ignoring
+// source code info which reflection servers usually strip.
+func sameFile(a, b protoreflect.FileDescriptor) bool {
+	return bytes.Equal(fileContent(a), fileContent(b))
+}
+
+func fileContent(fd protoreflect.FileDescriptor) []byte {
+	fdp := protodesc.ToFileDescriptorProto(fd)
+	fdp.SourceCodeInfo = nil
+
+	data, _ := proto.MarshalOptions{Deterministic: true}.Marshal(fdp)
+	return data
+}
+
+// findConflict returns the first declaration of file that is already
+// registered by another file.
+func findConflict(files *protoregistry.Files, file protoreflect.FileDescriptor) *ConflictError {
+	var conflict *ConflictError
+	rangeDeclarations(file, func(name protoreflect.FullName) bool {
+		desc, err := files.FindDescriptorByName(name)
+		if err != nil {
+			return true
+		}
+
+		conflict = &ConflictError{
+			Name:  string(name),
+			Files: [2]string{desc.ParentFile().Path(), file.Path()},
+		}
+
+		return false
+	})
+
+	return conflict
+}
+
+// rangeDeclarations calls fn for every message, enum, enum value, extension
+// and service declared by the file, stopping when fn returns false.
+func rangeDeclarations(file protoreflect.FileDescriptor, fn func(protoreflect.FullName) bool) {
+	type container interface {
+		Messages() protoreflect.MessageDescriptors
+		Enums() protoreflect.EnumDescriptors
+		Extensions() protoreflect.ExtensionDescriptors
+	}
+
+	var walk func(c container) bool
+	walk = func(c container) bool {
+		enums := c.Enums()
+		for i := 0; i < enums.Len(); i++ {
+			if !fn(enums.Get(i).FullName()) {
+				return false
+			}
+
+			values := enums.Get(i).Values()
+			for j := 0; j < values.Len(); j++ {
+				if !fn(values.Get(j).FullName()) {
+					return false
+				}
+			}
+		}
+
+		exts := c.Extensions()
+		for i := 0; i < exts.Len(); i++ {
+			if !fn(exts.Get(i).FullName()) {
+				return false
+			}
+		}
+
+		msgs := c.Messages()
+		for i := 0; i < msgs.Len(); i++ {
+			if !fn(msgs.Get(i).FullName()) || !walk(msgs.Get(i)) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if !walk(file) {
+		return
+	}
+
+	svcs := file.Services()
+	for i := 0; i < svcs.Len(); i++ {
+		if !fn(svcs.Get(i).FullName()) {
+			return
+		}
+	}
+}
+
+// newFiles builds an isolated registry holding the given files and their
+// transitive imports.
+func newFiles(roots []protoreflect.FileDescriptor) (*protoregistry.Files, error) {
+	files := &protoregistry.Files{}
+
+	// originals maps paths to the file they were built from, files in the
+	// registry are rebuilt and lose the identity of the originals.
+	originals := make(map[string]protoreflect.FileDescriptor)
+
+	var add func(fd protoreflect.FileDescriptor) error
+	add = func(fd protoreflect.FileDescriptor) error {
+		if orig, ok := originals[fd.Path()]; ok {
+			if orig == fd || sameFile(orig, fd) {
+				return nil
+			}
+
+			return &ConflictError{
+				Name:  fd.Path(),
+				Files: [2]string{orig.Path(), fd.Path()},
+			}
+		}
+
+		originals[fd.Path()] = fd
+
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if err := add(imports.Get(i).FileDescriptor); err != nil {
+				return err
+			}
+		}
+
+		// Compilers interpret custom options such as google.api.http as
+		// dynamic messages, which vanguard cannot read. Rebuilding the file
+		// from its serialized descriptor resolves them against the known types.
+		fdp, err := resolveOptions(protodesc.ToFileDescriptorProto(fd))
+		if err != nil {
+			return fmt.Errorf("could not resolve options of file %q: %w", fd.Path(), err)
+		}
+
+		file, err := protodesc.NewFile(fdp, files)
+		if err != nil {
+			return fmt.Errorf("could not create file %q: %w", fd.Path(), err)
+		}
+
+		return registerFile(files, file)
+	}
+
+	for _, root := range roots {
+		if err := add(root); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// resolveOptions round-trips the descriptor through the wire format so that
+// options are decoded with the extension types linked into the binary.
+func resolveOptions(fdp *descriptorpb.FileDescriptorProto) (*descriptorpb.FileDescriptorProto, error) {
+	data, err := proto.Marshal(fdp)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := &descriptorpb.FileDescriptorProto{}
+	if err = proto.Unmarshal(data, resolved); err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
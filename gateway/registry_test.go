@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestNewFilesReportsConflicts(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.proto": "syntax = \"proto3\";\npackage dup;\nmessage Thing {}\n",
+		"b.proto": "syntax = \"proto3\";\npackage dup;\nmessage Thing {}\n",
+	} {
+		writeFile(t, filepath.Join(dir, name), []byte(content))
+	}
+
+	// A compiler rejects the duplicate within one load, the files are loaded
+	// separately and then merged into one registry.
+	a, err := NewParserSource([]string{dir}, "a.proto").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewParserSource([]string{dir}, "b.proto").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileA, _ := a.Files.FindFileByPath("a.proto")
+	fileB, _ := b.Files.FindFileByPath("b.proto")
+
+	_, err = newFiles([]protoreflect.FileDescriptor{fileA, fileB})
+
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("newFiles = %v, want a ConflictError", err)
+	}
+
+	if conflict.Name != "dup.Thing" || conflict.Files != [2]string{"a.proto", "b.proto"} {
+		t.Errorf("conflict = %+v", conflict)
+	}
+
+	// The same file given twice is registered once.
+	files, err := newFiles([]protoreflect.FileDescriptor{fileA, fileA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files.NumFiles() != 1 {
+		t.Errorf("%d files registered", files.NumFiles())
+	}
+}
+
+func TestSchemaRegistriesAreIsolated(t *testing.T) {
+	source := NewParserSource(testImportPaths, "user/v1/user.proto")
+
+	first, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Files == second.Files || first.Services[0] == second.Services[0] {
+		t.Error("loads share their descriptors")
+	}
+
+	if first.Hash() != second.Hash() {
+		t.Error("loads of the same files have different hashes")
+	}
+}
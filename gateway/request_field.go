@@ -0,0 +1,196 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// maxPeekedMessageSize bounds the size of a request message read before it
+// is proxied.
+const maxPeekedMessageSize = 4 << 20
+
+// requestField returns the value at path in the first message of the
+// request, leaving the body untouched for the upstream. Client and bidi
+// streams are not peeked: their clients may wait for the response headers
+// before sending a message.
+func requestField(r *http.Request, path string) (string, bool) {
+	md, ok := methodFromContext(r.Context())
+	if !ok || md.IsStreamingClient() || r.Body == nil || r.Method != http.MethodPost {
+		return "", false
+	}
+
+	data, codec, ok := peekMessage(r)
+	if !ok {
+		return "", false
+	}
+
+	msg := dynamicpb.NewMessage(md.Input())
+
+	var err error
+	if codec == "json" {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, msg)
+	} else {
+		err = proto.Unmarshal(data, msg)
+	}
+
+	if err != nil {
+		return "", false
+	}
+
+	return fieldValue(msg, path)
+}
+
+// peekMessage reads the first message of the request body, in the framing
+// given by its content type, and returns it with its codec. The body is
+// replaced with one yielding the same content.
+func peekMessage(r *http.Request) ([]byte, string, bool) {
+	codec, enveloped, ok := messageFraming(r.Header)
+	if !ok {
+		return nil, "", false
+	}
+
+	// Connect unary requests carry the bare message, which is only readable
+	// when not compressed.
+	if enc := r.Header.Get("Content-Encoding"); !enveloped && enc != "" && enc != "identity" {
+		return nil, "", false
+	}
+
+	var buf bytes.Buffer
+	data, err := readMessage(io.TeeReader(r.Body, &buf), enveloped)
+
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.MultiReader(&buf, r.Body),
+		Closer: r.Body,
+	}
+
+	if err != nil {
+		return nil, "", false
+	}
+
+	return data, codec, true
+}
+
+// messageFraming returns the codec of the messages of a request or response
+// body given its headers, proto or json, and whether they are enveloped.
+func messageFraming(header http.Header) (string, bool, bool) {
+	contentType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return "", false, false
+	}
+
+	var (
+		codec     string
+		enveloped bool
+	)
+
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc"):
+		// application/grpc, application/grpc-web and their +codec variants.
+		enveloped = true
+		_, codec, _ = strings.Cut(contentType, "+")
+	case strings.HasPrefix(contentType, "application/connect+"):
+		enveloped = true
+		codec = strings.TrimPrefix(contentType, "application/connect+")
+	default:
+		codec = strings.TrimPrefix(contentType, "application/")
+	}
+
+	if codec == "" {
+		codec = "proto"
+	}
+
+	if codec != "proto" && codec != "json" {
+		return "", false, false
+	}
+
+	return codec, enveloped, true
+}
+
+func readMessage(r io.Reader, enveloped bool) ([]byte, error) {
+	if !enveloped {
+		data, err := io.ReadAll(io.LimitReader(r, maxPeekedMessageSize+1))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) > maxPeekedMessageSize {
+			return nil, fmt.Errorf("message larger than %d bytes", maxPeekedMessageSize)
+		}
+
+		return data, nil
+	}
+
+	// An envelope is a flags byte, whose lowest bit marks compression,
+	// followed by the big-endian message length.
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+
+	if prefix[0]&1 != 0 {
+		return nil, fmt.Errorf("message is compressed")
+	}
+
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxPeekedMessageSize {
+		return nil, fmt.Errorf("message larger than %d bytes", maxPeekedMessageSize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// fieldValue returns the value of the singular field at the dot-separated
+// path of msg, formatted as a string.
+func fieldValue(msg protoreflect.Message, path string) (string, bool) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil || fd.IsList() || fd.IsMap() || !msg.Has(fd) {
+			return "", false
+		}
+
+		v := msg.Get(fd)
+		if i < len(names)-1 {
+			if fd.Message() == nil {
+				return "", false
+			}
+
+			msg = v.Message()
+			continue
+		}
+
+		switch {
+		case fd.Message() != nil:
+			data, err := proto.MarshalOptions{Deterministic: true}.Marshal(v.Message().Interface())
+			if err != nil {
+				return "", false
+			}
+
+			return string(data), true
+		case fd.Enum() != nil:
+			return fmt.Sprint(int32(v.Enum())), true
+		default:
+			return fmt.Sprint(v.Interface()), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// route sends the services matching pattern to an upstream.
+type route struct {
+	pattern  string
+	upstream *Upstream
+}
+
+// routeTable resolves the upstream of a service. Exact service names take
+// precedence over globs, which are tried in the order they were added.
+type routeTable struct {
+	exact map[protoreflect.FullName]*Upstream
+	globs []route
+}
+
+func (t *routeTable) add(pattern string, upstream *Upstream) {
+	if !isServiceGlob(pattern) {
+		if t.exact == nil {
+			t.exact = make(map[protoreflect.FullName]*Upstream)
+		}
+
+		t.exact[protoreflect.FullName(pattern)] = upstream
+		return
+	}
+
+	t.globs = append(t.globs, route{
+		pattern:  pattern,
+		upstream: upstream,
+	})
+}
+
+func (t *routeTable) empty() bool {
+	return len(t.exact) == 0 && len(t.globs) == 0
+}
+
+// lookup returns the upstream the service is routed to.
+func (t *routeTable) lookup(name protoreflect.FullName) (*Upstream, bool) {
+	if upstream, ok := t.exact[name]; ok {
+		return upstream, true
+	}
+
+	for _, r := range t.globs {
+		if MatchService(r.pattern, name) {
+			return r.upstream, true
+		}
+	}
+
+	return nil, false
+}
+
+func isServiceGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?")
+}
+
+// ValidServicePattern reports whether pattern is a fully-qualified service
+// name or a glob accepted by MatchService.
+func ValidServicePattern(pattern string) bool {
+	if !isServiceGlob(pattern) {
+		return protoreflect.FullName(pattern).IsValid()
+	}
+
+	parts := strings.Split(pattern, ".")
+	for i, part := range parts {
+		if part == "**" {
+			if i != len(parts)-1 {
+				return false
+			}
+
+			continue
+		}
+
+		// Wildcards stand for identifier characters, so a component is valid
+		// when it becomes an identifier once they are replaced.
+		if !protoreflect.Name(strings.NewReplacer("*", "x", "?", "x").Replace(part)).IsValid() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MatchService reports whether the fully-qualified service name matches
+// pattern. Patterns are compared component by component: "*" and "?" match
+// within a single component as in path.Match, and a trailing "**" matches one
+// or more components. "billing.*" matches billing.Invoices but not
+// billing.v1.Invoices, which "billing.**" does.
+func MatchService(pattern string, name protoreflect.FullName) bool {
+	parts := strings.Split(pattern, ".")
+	names := strings.Split(string(name), ".")
+
+	for i, part := range parts {
+		if part == "**" && i == len(parts)-1 {
+			return len(names) > i
+		}
+
+		if i >= len(names) {
+			return false
+		}
+
+		if ok, err := path.Match(part, names[i]); err != nil || !ok {
+			return false
+		}
+	}
+
+	return len(parts) == len(names)
+}
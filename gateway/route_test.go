@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestMatchService(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    protoreflect.FullName
+		match   bool
+	}{
+		{pattern: "billing.*", name: "billing.Invoices", match: true},
+		{pattern: "billing.*", name: "billing.v1.Invoices"},
+		{pattern: "billing.**", name: "billing.v1.Invoices", match: true},
+		{pattern: "billing.**", name: "billing.Invoices", match: true},
+		{pattern: "billing.**", name: "billing"},
+		{pattern: "billing.v?.*", name: "billing.v1.Invoices", match: true},
+		{pattern: "*.v1.*", name: "user.v1.UserService", match: true},
+		{pattern: "user.v1.UserService", name: "user.v1.UserService", match: true},
+		{pattern: "user.v1.UserService", name: "user.v1.UserServices"},
+	}
+
+	for _, tt := range tests {
+		if got := MatchService(tt.pattern, tt.name); got != tt.match {
+			t.Errorf("MatchService(%q, %q) = %v", tt.pattern, tt.name, got)
+		}
+	}
+}
+
+func TestValidServicePattern(t *testing.T) {
+	for pattern, valid := range map[string]bool{
+		"user.v1.UserService": true,
+		"billing.*":           true,
+		"billing.**":          true,
+		"billing.v?.*":        true,
+		"billing.**.Invoices": false,
+		"billing..Invoices":   false,
+		"billing.1x":          false,
+		"":                    false,
+	} {
+		if got := ValidServicePattern(pattern); got != valid {
+			t.Errorf("ValidServicePattern(%q) = %v", pattern, got)
+		}
+	}
+}
+
+func TestUpstreamOf(t *testing.T) {
+	var (
+		fallback   = &Upstream{Name: "default"}
+		exact      = &Upstream{Name: "exact"}
+		first      = &Upstream{Name: "first"}
+		second     = &Upstream{Name: "second"}
+		discovered = &Upstream{Name: "discovered"}
+	)
+
+	g := &Gateway{opts: newOptions(
+		WithDefaultUpstream(fallback),
+		WithServiceUpstream("billing.**", first),
+		WithServiceUpstream("billing.v1.*", second),
+		WithServiceUpstream("billing.v1.Invoices", exact),
+	)}
+
+	schema := &Schema{}
+	schema.setUpstream("billing.v1.Payments", discovered)
+	schema.setUpstream("search.v1.Search", discovered)
+
+	for name, want := range map[protoreflect.FullName]*Upstream{
+		// Exact names win over globs, which are tried in order.
+		"billing.v1.Invoices": exact,
+		"billing.v1.Payments": first,
+		// Then the upstream a service was discovered on, then the default.
+		"search.v1.Search":    discovered,
+		"user.v1.UserService": fallback,
+	} {
+		got, err := g.upstreamOf(schema, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Errorf("upstream of %s = %s, want %s", name, got.Name, want.Name)
+		}
+	}
+
+	g.opts.upstream = nil
+	if _, err := g.upstreamOf(schema, "user.v1.UserService"); err == nil {
+		t.Error("service without upstream accepted")
+	}
+}
+
+func TestServiceUpstream(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+
+	echo := newUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "0")
+	}))
+
+	source := NewMultiSource(PrecedenceFirst,
+		NewParserSource(testImportPaths, "user/v1/user.proto"),
+		echoSource(t, ""),
+	)
+
+	_, addr := newTestGateway(t,
+		WithSchemaSource(source),
+		WithUpstream(newUserUpstream(t)),
+		WithServiceUpstream("echo.**", &Upstream{Name: "echo", Target: echo}),
+	)
+
+	res, err := http.Get(addr + "/v1/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status of the default upstream = %d", res.StatusCode)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, addr+"/echo.v1.EchoService/Echo", strings.NewReader(`{"text":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(paths) != 1 || paths[0] != "/echo.v1.EchoService/Echo" {
+		t.Errorf("routed upstream received %v", paths)
+	}
+}
+
+func TestRouteSource(t *testing.T) {
+	upstream := &Upstream{Name: "users", Target: &url.URL{Host: "users"}}
+
+	schema, err := RouteSource(NewParserSource(testImportPaths, "user/v1/user.proto"), upstream).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if schema.Upstreams["user.v1.UserService"] != upstream {
+		t.Errorf("upstreams = %v", schema.Upstreams)
+	}
+}
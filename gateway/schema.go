@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// SchemaSource loads the protobuf descriptors served by a Gateway.
+type SchemaSource interface {
+	// Load resolves the services to expose together with every file they
+	// depend on.
+	Load(ctx context.Context) (*Schema, error)
+}
+
+// Schema is the result of loading a SchemaSource.
+type Schema struct {
+	// Files resolves every descriptor referenced by Services. It is never
+	// protoregistry.GlobalFiles: every load builds its own registry, so
+	// reloads, upstreams sharing packages and the protos compiled into the
+	// gateway binary cannot clash with each other.
+	Files *protoregistry.Files
+	// Services are the services transcoded and proxied by the gateway.
+	Services []protoreflect.ServiceDescriptor
+	// Upstreams optionally holds the upstream a source expects a service to
+	// be proxied to. Routes configured on the gateway take precedence.
+	Upstreams map[protoreflect.FullName]*Upstream
+}
+
+// ServiceNames returns the fully-qualified names of the schema services.
+func (s *Schema) ServiceNames() []string {
+	names := make([]string, 0, len(s.Services))
+	for _, svc := range s.Services {
+		names = append(names, string(svc.FullName()))
+	}
+
+	return names
+}
+
+// Hash returns a digest of the schema content: the exposed services and every
+// file of the registry. Two loads of an unchanged schema have the same hash.
+func (s *Schema) Hash() string {
+	fdps := make([]*descriptorpb.FileDescriptorProto, 0, s.Files.NumFiles())
+	s.Files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		fdps = append(fdps, protodesc.ToFileDescriptorProto(fd))
+		return true
+	})
+
+	sort.Slice(fdps, func(i, j int) bool {
+		return fdps[i].GetName() < fdps[j].GetName()
+	})
+
+	h := sha256.New()
+	for _, name := range s.ServiceNames() {
+		h.Write([]byte(name))
+		if upstream, ok := s.Upstreams[protoreflect.FullName(name)]; ok {
+			h.Write([]byte("=" + upstream.Name))
+		}
+
+		h.Write([]byte{0})
+	}
+
+	marshal := proto.MarshalOptions{Deterministic: true}
+	for _, fdp := range fdps {
+		// Marshaling a descriptor proto only fails for invalid UTF-8, which
+		// a registered file cannot contain.
+		data, _ := marshal.Marshal(fdp)
+		h.Write(data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *Schema) setUpstream(name protoreflect.FullName, upstream *Upstream) {
+	if s.Upstreams == nil {
+		s.Upstreams = make(map[protoreflect.FullName]*Upstream)
+	}
+
+	s.Upstreams[name] = upstream
+}
+
+// addServices appends every service declared in the given file.
+func (s *Schema) addServices(file protoreflect.FileDescriptor) {
+	svcDescs := file.Services()
+	for i := 0; i < svcDescs.Len(); i++ {
+		s.Services = append(s.Services, svcDescs.Get(i))
+	}
+}
+
+// addService adds the service named name, advertised by a reflection
+// server. The other services of its file are left out.
+func (s *Schema) addService(name string) error {
+	d, err := s.Files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return fmt.Errorf("could not find service %q: %w", name, err)
+	}
+
+	svcDesc, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return fmt.Errorf("%q is not a service", name)
+	}
+
+	s.Services = append(s.Services, svcDesc)
+	return nil
+}
+
+// findFiles looks up the given paths in the registry and collects the
+// services they declare.
+func findFiles(files *protoregistry.Files, paths []string) (*Schema, error) {
+	schema := &Schema{
+		Files: files,
+	}
+
+	for _, path := range paths {
+		file, err := files.FindFileByPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not find file %q: %w", path, err)
+		}
+
+		schema.addServices(file)
+	}
+
+	return schema, nil
+}
+
+// dedupeServices drops services that were collected more than once, which
+// happens when a reflection server lists a service twice.
+func dedupeServices(s *Schema) *Schema {
+	seen := make(map[string]struct{}, len(s.Services))
+	services := s.Services[:0]
+	for _, svc := range s.Services {
+		name := string(svc.FullName())
+		if _, ok := seen[name]; ok {
+			continue
+		}
+
+		seen[name] = struct{}{}
+		services = append(services, svc)
+	}
+
+	s.Services = services
+	return s
+}
+
+// methodNames returns the fully-qualified names of every method of the
+// schema services.
+func (s *Schema) methodNames() map[string]struct{} {
+	names := make(map[string]struct{})
+	for _, svc := range s.Services {
+		methods := svc.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			names[string(methods.Get(i).FullName())] = struct{}{}
+		}
+	}
+
+	return names
+}
+
+// diffMethods returns the methods only present in next and those only
+// present in prev, both sorted.
+func diffMethods(prev, next *Schema) (added, removed []string) {
+	prevNames, nextNames := prev.methodNames(), next.methodNames()
+	for name := range nextNames {
+		if _, ok := prevNames[name]; !ok {
+			added = append(added, name)
+		}
+	}
+
+	for name := range prevNames {
+		if _, ok := nextNames[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	return added, removed
+}
@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/rs/zerolog/log"
+)
+
+// drain counts the requests in flight so that shutdown can wait for them.
+type drain struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{}
+}
+
+func (d *drain) add() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.active++
+}
+
+func (d *drain) done() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.active--
+	if d.active == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// wait returns once no request is in flight or ctx is done.
+func (d *drain) wait(ctx context.Context) error {
+	d.mu.Lock()
+	if d.active == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// track counts the request in flight until it completes and cancels it when
+// the gateway aborts its requests. It also records the call in the context,
+// and observes it when metrics or tracing are enabled.
+func (g *Gateway) track(w http.ResponseWriter, r *http.Request, handler http.Handler) {
+	g.drain.add()
+	defer g.drain.done()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stop := context.AfterFunc(g.abort, cancel)
+	defer stop()
+
+	c := g.newCall(r)
+	if c.tracer != nil {
+		ctx = propagator.Extract(ctx, propagation.HeaderCarrier(r.Header))
+	}
+
+	r = r.WithContext(context.WithValue(ctx, callKey{}, c))
+
+	if c.metrics != nil || c.tracer != nil {
+		observe(w, r, handler)
+		return
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// local wraps the handlers served by the gateway itself, such as reflection
+// and health watches, whose streams end as soon as the gateway shuts down
+// rather than being drained.
+func (g *Gateway) local(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		stop := context.AfterFunc(g.closing, cancel)
+		defer stop()
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// localHandler applies local to a handler mounted on a path.
+func (g *Gateway) localHandler(path string, handler http.Handler) (string, http.Handler) {
+	return path, g.local(handler)
+}
+
+// Shutdown drains the gateway: the streams of the reflection and health
+// services end right away, then Shutdown waits for the proxied requests in
+// flight until ctx is done, cancels those that remain and closes the idle
+// upstream connections. Servers should be shut down alongside so that they
+// stop accepting connections and send HTTP/2 GOAWAY frames. Shutdown returns
+// the context error when requests had to be canceled.
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	g.closeLocal()
+
+	err := g.drain.wait(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("drain timeout reached, canceling requests in flight")
+	}
+
+	g.abortRequests()
+
+	transports := map[http.RoundTripper]struct{}{
+		g.opts.transport: {},
+	}
+
+	for upstream := range g.state.Load().upstreams {
+		if upstream.Transport != nil {
+			transports[upstream.Transport] = struct{}{}
+		}
+
+		for _, e := range upstream.cluster() {
+			if e.transport != nil {
+				transports[e.transport] = struct{}{}
+			}
+		}
+	}
+
+	for transport := range transports {
+		if t, ok := transport.(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
+	}
+
+	return err
+}
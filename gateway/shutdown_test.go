@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingUpstream answers echo.v1.EchoService/Echo with an empty message
+// once released, or when the request is canceled.
+type blockingUpstream struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (u *blockingUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.started <- struct{}{}
+
+	select {
+	case <-u.release:
+	case <-r.Context().Done():
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	_, _ = w.Write(envelope(nil))
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+}
+
+// newBlockingGateway serves echoProto in front of a blockingUpstream.
+func newBlockingGateway(t *testing.T) (*Gateway, string, *blockingUpstream) {
+	t.Helper()
+
+	upstream := &blockingUpstream{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+
+	g, addr := newTestGateway(t,
+		WithSchemaSource(echoSource(t, "")),
+		WithUpstream(newUpstream(t, upstream)),
+	)
+
+	return g, addr, upstream
+}
+
+// echo calls Echo with Connect and sends the response status, or 0 when the
+// request failed, to status.
+func echo(addr string, status chan<- int) {
+	req, err := http.NewRequest(http.MethodPost, addr+"/echo.v1.EchoService/Echo", strings.NewReader(`{"text":"hi"}`))
+	if err != nil {
+		status <- 0
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		status <- 0
+		return
+	}
+	res.Body.Close()
+
+	status <- res.StatusCode
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	g, addr, upstream := newBlockingGateway(t)
+
+	status := make(chan int, 1)
+	go echo(addr, status)
+	<-upstream.started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- g.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned with a request in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(upstream.release)
+
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("status of the drained request = %d", got)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+}
+
+func TestShutdownCancelsRemainingRequests(t *testing.T) {
+	g, addr, upstream := newBlockingGateway(t)
+
+	status := make(chan int, 1)
+	go echo(addr, status)
+	<-upstream.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := g.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if got := <-status; got == http.StatusOK {
+		t.Error("canceled request succeeded")
+	}
+}
+
+func TestShutdownWithoutRequests(t *testing.T) {
+	g, _ := newUserGateway(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Nothing is in flight, the canceled context does not matter.
+	if err := g.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+}
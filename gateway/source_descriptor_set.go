@@ -0,0 +1,250 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Descriptor set encodings understood by DescriptorSetSource.
+const (
+	DescriptorSetFormatBinary = "binary"
+	DescriptorSetFormatJSON   = "json"
+)
+
+// bufImageExtensionField is the field number of the buf.alpha.image.v1
+// ImageFileExtension carried by every file of a buf image. Its is_import
+// field (1) marks files that were only included as dependencies.
+const bufImageExtensionField = 8042
+
+var _ SchemaSource = (*DescriptorSetSource)(nil)
+
+// DescriptorSetSource loads services from a serialized
+// google.protobuf.FileDescriptorSet, as produced by `protoc -o` or
+// `buf build -o`, in the binary or JSON encoding. It does not need any
+// .proto file on disk, which makes the image an immutable build artifact.
+//
+// Imports missing from the set, as with `protoc -o` without
+// --include_imports, are taken from the descriptors linked into the gateway
+// binary, such as the well-known types and google/api annotations.
+type DescriptorSetSource struct {
+	// Path is the location of the descriptor set.
+	Path string
+	// Format is DescriptorSetFormatBinary or DescriptorSetFormatJSON. It is
+	// detected from the file extension, then from the content, when empty.
+	Format string
+	// Files optionally restricts the exposed services to those declared in
+	// the given files. Otherwise all services are exposed, except those of
+	// files a buf image marks as imports.
+	Files []string
+}
+
+// NewDescriptorSetSource returns a DescriptorSetSource reading from path.
+func NewDescriptorSetSource(path string, files ...string) *DescriptorSetSource {
+	return &DescriptorSetSource{
+		Path:  path,
+		Files: files,
+	}
+}
+
+// Load implements SchemaSource.
+func (s *DescriptorSetSource) Load(context.Context) (*Schema, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read descriptor set: %w", err)
+	}
+
+	set, imports, err := s.unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal descriptor set %q: %w", s.Path, err)
+	}
+
+	files, err := newFilesFromProtos(set.GetFile(), linkedFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not create files from descriptor set %q: %w", s.Path, err)
+	}
+
+	if len(s.Files) > 0 {
+		return findFiles(files, s.Files)
+	}
+
+	paths := make([]string, 0, len(set.GetFile()))
+	for _, fdp := range set.GetFile() {
+		if _, ok := imports[fdp.GetName()]; !ok {
+			paths = append(paths, fdp.GetName())
+		}
+	}
+
+	return findFiles(files, paths)
+}
+
+// unmarshal decodes the descriptor set and returns the files marked as
+// imports by a buf image.
+func (s *DescriptorSetSource) unmarshal(data []byte) (*descriptorpb.FileDescriptorSet, map[string]struct{}, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+
+	switch format := s.format(data); format {
+	case DescriptorSetFormatBinary:
+		if err := proto.Unmarshal(data, set); err != nil {
+			return nil, nil, err
+		}
+
+		return set, binaryImports(set), nil
+	case DescriptorSetFormatJSON:
+		// buf images add a bufExtension field to every file.
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, set); err != nil {
+			return nil, nil, err
+		}
+
+		imports, err := jsonImports(data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return set, imports, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown format %q, expected %s or %s",
+			format, DescriptorSetFormatBinary, DescriptorSetFormatJSON)
+	}
+}
+
+func (s *DescriptorSetSource) format(data []byte) string {
+	if s.Format != "" {
+		return s.Format
+	}
+
+	switch strings.ToLower(filepath.Ext(s.Path)) {
+	case ".json":
+		return DescriptorSetFormatJSON
+	case ".binpb", ".pb", ".bin", ".protoset", ".desc":
+		return DescriptorSetFormatBinary
+	}
+
+	// A binary set starts with the tag of its first file, never with '{'.
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return DescriptorSetFormatJSON
+	}
+
+	return DescriptorSetFormatBinary
+}
+
+// binaryImports reads the buf image extension kept as unknown fields.
+func binaryImports(set *descriptorpb.FileDescriptorSet) map[string]struct{} {
+	imports := make(map[string]struct{})
+	for _, fdp := range set.GetFile() {
+		b := fdp.ProtoReflect().GetUnknown()
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				break
+			}
+			b = b[n:]
+
+			if num != bufImageExtensionField || typ != protowire.BytesType {
+				n = protowire.ConsumeFieldValue(num, typ, b)
+				if n < 0 {
+					break
+				}
+				b = b[n:]
+
+				continue
+			}
+
+			ext, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				break
+			}
+			b = b[n:]
+
+			if bufImageIsImport(ext) {
+				imports[fdp.GetName()] = struct{}{}
+			}
+		}
+	}
+
+	return imports
+}
+
+func bufImageIsImport(ext []byte) bool {
+	for len(ext) > 0 {
+		num, typ, n := protowire.ConsumeTag(ext)
+		if n < 0 {
+			return false
+		}
+		ext = ext[n:]
+
+		if num == 1 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(ext)
+			return n > 0 && v != 0
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, ext)
+		if n < 0 {
+			return false
+		}
+		ext = ext[n:]
+	}
+
+	return false
+}
+
+// jsonImports reads the bufExtension field of a buf image in JSON.
+func jsonImports(data []byte) (map[string]struct{}, error) {
+	var image struct {
+		File []struct {
+			Name         string `json:"name"`
+			BufExtension struct {
+				IsImport bool `json:"isImport"`
+			} `json:"bufExtension"`
+		} `json:"file"`
+	}
+	if err := json.Unmarshal(data, &image); err != nil {
+		return nil, err
+	}
+
+	imports := make(map[string]struct{})
+	for _, f := range image.File {
+		if f.BufExtension.IsImport {
+			imports[f.Name] = struct{}{}
+		}
+	}
+
+	return imports, nil
+}
+
+// linkedFile returns the descriptor of a file linked into the gateway binary
+// together with its dependencies. The descriptors are copied, the isolated
+// registry never shares them with protoregistry.GlobalFiles.
+func linkedFile(name string) ([]*descriptorpb.FileDescriptorProto, error) {
+	fd, err := protoregistry.GlobalFiles.FindFileByPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fdps := []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(fd),
+	}
+
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		deps, err := linkedFile(imports.Get(i).Path())
+		if err != nil {
+			return nil, err
+		}
+
+		fdps = append(fdps, deps...)
+	}
+
+	return fdps, nil
+}
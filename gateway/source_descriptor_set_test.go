@@ -0,0 +1,171 @@
+package gateway
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// descriptorSet returns the files of a schema, or only those named when
+// paths are given.
+func descriptorSet(schema *Schema, paths ...string) *descriptorpb.FileDescriptorSet {
+	set := &descriptorpb.FileDescriptorSet{}
+	schema.Files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		if len(paths) == 0 || slices.Contains(paths, fd.Path()) {
+			set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+		}
+
+		return true
+	})
+
+	return set
+}
+
+// writeDescriptorSet writes set to a file named name and returns its path.
+func writeDescriptorSet(t *testing.T, name string, set *descriptorpb.FileDescriptorSet, json bool) string {
+	t.Helper()
+
+	marshal := proto.Marshal
+	if json {
+		marshal = protojson.Marshal
+	}
+
+	data, err := marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	writeFile(t, path, data)
+
+	return path
+}
+
+func TestDescriptorSetSource(t *testing.T) {
+	schema, err := NewParserSource(testImportPaths, "user/v1/user.proto").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		json bool
+		// paths restricts the set to these files.
+		paths []string
+	}{
+		{name: "binary", file: "image.binpb"},
+		{name: "json", file: "image.json", json: true},
+		{name: "json detected", file: "image", json: true},
+		{name: "binary detected", file: "image"},
+		// Imports missing from the set are linked into the binary.
+		{name: "without imports", file: "image.pb", paths: []string{"user/v1/user.proto"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeDescriptorSet(t, tt.file, descriptorSet(schema, tt.paths...), tt.json)
+
+			loaded, err := NewDescriptorSetSource(path).Load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkUserSchema(t, loaded)
+
+			if got := loaded.ServiceNames(); len(got) != 1 {
+				t.Errorf("services = %v", got)
+			}
+		})
+	}
+}
+
+// bufImport marks a file as an import the way buf images do.
+func bufImport(fdp *descriptorpb.FileDescriptorProto) {
+	ext := protowire.AppendTag(nil, 1, protowire.VarintType)
+	ext = protowire.AppendVarint(ext, 1)
+
+	unknown := protowire.AppendTag(nil, bufImageExtensionField, protowire.BytesType)
+	unknown = protowire.AppendBytes(unknown, ext)
+
+	fdp.ProtoReflect().SetUnknown(unknown)
+}
+
+func TestDescriptorSetSourceSkipsBufImports(t *testing.T) {
+	importPaths := writeProto(t, "lib/v1/lib.proto", `
+syntax = "proto3";
+package lib.v1;
+message Empty {}
+service LibService {
+  rpc Call(Empty) returns (Empty);
+}
+`)
+	writeFile(t, filepath.Join(importPaths[0], "app.proto"), []byte(`
+syntax = "proto3";
+package app;
+import "lib/v1/lib.proto";
+service AppService {
+  rpc Call(lib.v1.Empty) returns (lib.v1.Empty);
+}
+`))
+
+	schema, err := NewParserSource(importPaths, "app.proto").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := descriptorSet(schema)
+	for _, fdp := range set.GetFile() {
+		if fdp.GetName() == "lib/v1/lib.proto" {
+			bufImport(fdp)
+		}
+	}
+
+	path := writeDescriptorSet(t, "image.binpb", set, false)
+
+	loaded, err := NewDescriptorSetSource(path).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := loaded.ServiceNames(); !slices.Equal(got, []string{"app.AppService"}) {
+		t.Errorf("services = %v", got)
+	}
+
+	// Files named explicitly are exposed even when imported.
+	loaded, err = NewDescriptorSetSource(path, "lib/v1/lib.proto").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := loaded.ServiceNames(); !slices.Equal(got, []string{"lib.v1.LibService"}) {
+		t.Errorf("services = %v", got)
+	}
+}
+
+func TestDescriptorSetSourceJSONBufImports(t *testing.T) {
+	data := []byte(`{"file": [
+  {"name": "a.proto", "package": "a", "syntax": "proto3", "service": [{"name": "A"}], "bufExtension": {"isImport": true}},
+  {"name": "b.proto", "package": "b", "syntax": "proto3", "service": [{"name": "B"}], "bufExtension": {"isImport": false}}
+]}`)
+
+	path := filepath.Join(t.TempDir(), "image.json")
+	writeFile(t, path, data)
+
+	loaded, err := NewDescriptorSetSource(path).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := loaded.ServiceNames(); !slices.Equal(got, []string{"b.B"}) {
+		t.Errorf("services = %v", got)
+	}
+}
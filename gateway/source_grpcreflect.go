@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/grpcreflect"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var _ SchemaSource = (*GRPCReflectSource)(nil)
+
+// GRPCReflectSource discovers services from an upstream server using the
+// github.com/jhump/protoreflect/grpcreflect client over a gRPC connection.
+type GRPCReflectSource struct {
+	conn     grpc.ClientConnInterface
+	target   string
+	dialOpts []grpc.DialOption
+}
+
+// NewGRPCReflectSource returns a GRPCReflectSource using the given connection.
+// The caller remains responsible for closing the connection.
+func NewGRPCReflectSource(conn grpc.ClientConnInterface) *GRPCReflectSource {
+	return &GRPCReflectSource{
+		conn: conn,
+	}
+}
+
+// DialGRPCReflectSource returns a GRPCReflectSource that opens a connection
+// to target for every load and closes it once the schema is loaded.
+func DialGRPCReflectSource(target string, opts ...grpc.DialOption) *GRPCReflectSource {
+	return &GRPCReflectSource{
+		target:   target,
+		dialOpts: opts,
+	}
+}
+
+// Load implements SchemaSource.
+func (s *GRPCReflectSource) Load(ctx context.Context) (*Schema, error) {
+	conn := s.conn
+	if conn == nil {
+		cconn, err := grpc.Dial(s.target, s.dialOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("could not create grpc client: %w", err)
+		}
+		defer func() {
+			_ = cconn.Close()
+		}()
+
+		conn = cconn
+	}
+
+	client := grpcreflect.NewClientAuto(ctx, conn)
+	defer client.Reset()
+
+	listServices, err := client.ListServices()
+	if err != nil {
+		return nil, fmt.Errorf("could not list services: %w", err)
+	}
+
+	fdps := make([]*descriptorpb.FileDescriptorProto, 0)
+	for _, service := range listServices {
+		fd, err := client.FileContainingSymbol(service)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve service %q: %w", service, err)
+		}
+
+		fdps = append(fdps, fileProtos(fd)...)
+	}
+
+	fetch := func(name string) ([]*descriptorpb.FileDescriptorProto, error) {
+		fd, err := client.FileByFilename(name)
+		if err != nil {
+			return nil, err
+		}
+
+		return fileProtos(fd), nil
+	}
+
+	// Every load starts from an empty registry so that descriptors changed
+	// upstream replace the previous ones.
+	files, err := newFilesFromProtos(fdps, fetch)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{
+		Files: files,
+	}
+
+	for _, service := range listServices {
+		if err := schema.addService(service); err != nil {
+			return nil, err
+		}
+	}
+
+	return dedupeServices(schema), nil
+}
+
+// fileProtos returns the descriptor proto of fd followed by those of its
+// transitive dependencies, as resolved by the reflection client.
+func fileProtos(fd *desc.FileDescriptor) []*descriptorpb.FileDescriptorProto {
+	seen := make(map[string]struct{})
+
+	var fdps []*descriptorpb.FileDescriptorProto
+
+	var walk func(fd *desc.FileDescriptor)
+	walk = func(fd *desc.FileDescriptor) {
+		if _, ok := seen[fd.GetName()]; ok {
+			return
+		}
+
+		seen[fd.GetName()] = struct{}{}
+		fdps = append(fdps, fd.AsFileDescriptorProto())
+
+		for _, dep := range fd.GetDependencies() {
+			walk(dep)
+		}
+	}
+	walk(fd)
+
+	return fdps
+}
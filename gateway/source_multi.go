@@ -0,0 +1,179 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Precedence decides which source serves a service found in several sources
+// of a MultiSource.
+type Precedence string
+
+const (
+	// PrecedenceFirst keeps the service of the earliest source.
+	PrecedenceFirst Precedence = "first"
+	// PrecedenceLast keeps the service of the latest source.
+	PrecedenceLast Precedence = "last"
+	// PrecedenceError fails the load.
+	PrecedenceError Precedence = "error"
+)
+
+var _ SchemaSource = (*MultiSource)(nil)
+
+// MultiSource merges the schemas of several sources into a single registry,
+// so that one transcoder serves services compiled from local protos,
+// discovered over reflection and read from descriptor sets side by side.
+//
+// Files shared by several sources must be identical. Only the files needed by
+// the services kept from each source are merged, so the losing copy of a
+// duplicated service does not conflict with the winning one.
+type MultiSource struct {
+	// Sources are loaded in order.
+	Sources []SchemaSource
+	// Precedence applies to services found in several sources, it defaults
+	// to PrecedenceFirst.
+	Precedence Precedence
+}
+
+// NewMultiSource returns a MultiSource over the given sources.
+func NewMultiSource(precedence Precedence, sources ...SchemaSource) *MultiSource {
+	return &MultiSource{
+		Sources:    sources,
+		Precedence: precedence,
+	}
+}
+
+// DuplicateServiceError is returned by a MultiSource using PrecedenceError
+// when a service is found in several sources.
+type DuplicateServiceError struct {
+	// Service is the fully-qualified name of the service.
+	Service string
+	// Sources are the indexes of the two sources defining the service.
+	Sources [2]int
+}
+
+func (e *DuplicateServiceError) Error() string {
+	return fmt.Sprintf("service %q is defined by sources %d and %d", e.Service, e.Sources[0], e.Sources[1])
+}
+
+// Load implements SchemaSource.
+func (s *MultiSource) Load(ctx context.Context) (*Schema, error) {
+	schemas := make([]*Schema, len(s.Sources))
+	for i, source := range s.Sources {
+		schema, err := source.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not load source %d: %w", i, err)
+		}
+
+		schemas[i] = schema
+	}
+
+	// Sources are merged from the highest precedence to the lowest.
+	order := make([]int, len(schemas))
+	for i := range order {
+		order[i] = i
+		if s.Precedence == PrecedenceLast {
+			order[i] = len(schemas) - 1 - i
+		}
+	}
+
+	g := newFileGraph()
+	owners := make(map[protoreflect.FullName]int)
+	kept := make([][]protoreflect.ServiceDescriptor, len(schemas))
+
+	for _, i := range order {
+		var roots []protoreflect.FileDescriptor
+		for _, svc := range schemas[i].Services {
+			owner, ok := owners[svc.FullName()]
+			if !ok {
+				owners[svc.FullName()] = i
+				kept[i] = append(kept[i], svc)
+				roots = append(roots, svc.ParentFile())
+
+				continue
+			}
+
+			if s.Precedence == PrecedenceError {
+				first, second := owner, i
+				if first > second {
+					first, second = second, first
+				}
+
+				return nil, &DuplicateServiceError{
+					Service: string(svc.FullName()),
+					Sources: [2]int{first, second},
+				}
+			}
+
+			log.Warn().
+				Str("service", string(svc.FullName())).
+				Int("source", i).
+				Int("winner", owner).
+				Msg("service shadowed by a source with higher precedence")
+		}
+
+		if err := g.add(closure(roots)...); err != nil {
+			return nil, fmt.Errorf("could not merge source %d: %w", i, err)
+		}
+	}
+
+	files, err := g.build()
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &Schema{
+		Files: files,
+	}
+
+	// Services keep the order of the sources.
+	for i, services := range kept {
+		for _, svc := range services {
+			desc, err := files.FindDescriptorByName(svc.FullName())
+			if err != nil {
+				return nil, fmt.Errorf("could not find service %q: %w", svc.FullName(), err)
+			}
+
+			merged.Services = append(merged.Services, desc.(protoreflect.ServiceDescriptor))
+			if upstream, ok := schemas[i].Upstreams[svc.FullName()]; ok {
+				merged.setUpstream(svc.FullName(), upstream)
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+// closure returns the descriptor protos of the files and of their transitive
+// imports.
+func closure(roots []protoreflect.FileDescriptor) []*descriptorpb.FileDescriptorProto {
+	seen := make(map[string]struct{})
+
+	var fdps []*descriptorpb.FileDescriptorProto
+
+	var walk func(fd protoreflect.FileDescriptor)
+	walk = func(fd protoreflect.FileDescriptor) {
+		if _, ok := seen[fd.Path()]; ok {
+			return
+		}
+
+		seen[fd.Path()] = struct{}{}
+		fdps = append(fdps, protodesc.ToFileDescriptorProto(fd))
+
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			walk(imports.Get(i).FileDescriptor)
+		}
+	}
+
+	for _, root := range roots {
+		walk(root)
+	}
+
+	return fdps
+}
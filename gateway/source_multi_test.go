@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// sourceFunc adapts a function to SchemaSource.
+type sourceFunc func(ctx context.Context) (*Schema, error)
+
+func (f sourceFunc) Load(ctx context.Context) (*Schema, error) {
+	return f(ctx)
+}
+
+// echoSource loads echoProto, with another method when method is not empty.
+func echoSource(t *testing.T, method string) SchemaSource {
+	t.Helper()
+
+	content := echoProto
+	if method != "" {
+		content = withMethod(method)
+	}
+
+	return NewParserSource(writeProto(t, "echo/v1/echo.proto", content), "echo/v1/echo.proto")
+}
+
+func TestMultiSourceMerges(t *testing.T) {
+	users := &Upstream{Name: "users"}
+	routed := sourceFunc(func(ctx context.Context) (*Schema, error) {
+		schema, err := NewParserSource(testImportPaths, "user/v1/user.proto").Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		schema.setUpstream("user.v1.UserService", users)
+
+		return schema, nil
+	})
+
+	schema, err := NewMultiSource(PrecedenceFirst, echoSource(t, ""), routed).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := schema.ServiceNames(); !slices.Equal(got, []string{"echo.v1.EchoService", "user.v1.UserService"}) {
+		t.Errorf("services = %v", got)
+	}
+
+	for _, svc := range schema.Services {
+		if desc, err := schema.Files.FindDescriptorByName(svc.FullName()); err != nil || desc != svc {
+			t.Errorf("service %s not resolved from the merged registry", svc.FullName())
+		}
+	}
+
+	if schema.Upstreams["user.v1.UserService"] != users {
+		t.Errorf("upstreams = %v", schema.Upstreams)
+	}
+}
+
+func TestMultiSourcePrecedence(t *testing.T) {
+	tests := []struct {
+		precedence Precedence
+		methods    []string
+	}{
+		{precedence: PrecedenceFirst, methods: []string{"Echo"}},
+		{precedence: PrecedenceLast, methods: []string{"Echo", "Shout"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.precedence), func(t *testing.T) {
+			// Both sources define echo/v1/echo.proto differently, only the
+			// files of the kept services are merged.
+			schema, err := NewMultiSource(tt.precedence, echoSource(t, ""), echoSource(t, "Shout")).Load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := methodNames(schema); !slices.Equal(got, tt.methods) {
+				t.Errorf("methods = %v, want %v", got, tt.methods)
+			}
+		})
+	}
+
+	_, err := NewMultiSource(PrecedenceError, echoSource(t, ""), echoSource(t, "Shout")).Load(context.Background())
+
+	var duplicate *DuplicateServiceError
+	if !errors.As(err, &duplicate) || duplicate.Service != "echo.v1.EchoService" || duplicate.Sources != [2]int{0, 1} {
+		t.Errorf("Load = %v, want a DuplicateServiceError", err)
+	}
+}
+
+func TestMultiSourceReportsSourceErrors(t *testing.T) {
+	failure := errors.New("unreachable")
+	failing := sourceFunc(func(context.Context) (*Schema, error) {
+		return nil, failure
+	})
+
+	_, err := NewMultiSource(PrecedenceFirst, echoSource(t, ""), failing).Load(context.Background())
+	if !errors.Is(err, failure) {
+		t.Errorf("Load = %v, want %v", err, failure)
+	}
+}
@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var _ SchemaSource = (*ParserSource)(nil)
+
+// ParserSource loads services from .proto sources using protoparse.
+type ParserSource struct {
+	// ImportPaths are the directories searched for imported files.
+	ImportPaths []string
+	// Files are the entry files whose services are exposed.
+	Files []string
+}
+
+// NewParserSource returns a ParserSource for the given entry files.
+func NewParserSource(importPaths []string, files ...string) *ParserSource {
+	return &ParserSource{
+		ImportPaths: importPaths,
+		Files:       files,
+	}
+}
+
+// Load implements SchemaSource.
+func (s *ParserSource) Load(context.Context) (*Schema, error) {
+	p := protoparse.Parser{
+		ImportPaths: s.ImportPaths,
+		Accessor:    sourceAccessor(s.ImportPaths),
+		// Comments document the generated OpenAPI operations.
+		IncludeSourceCodeInfo: true,
+	}
+
+	fds, err := p.ParseFiles(s.Files...)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse given files: %w", err)
+	}
+
+	roots := make([]protoreflect.FileDescriptor, 0, len(fds))
+	for _, fileDesc := range fds {
+		roots = append(roots, fileDesc.UnwrapFile())
+	}
+
+	files, err := newFiles(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	return findFiles(files, s.Files)
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpcreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var _ SchemaSource = (*ReflectSource)(nil)
+
+// ReflectSource discovers services from an upstream server using the
+// connectrpc.com/grpcreflect client.
+type ReflectSource struct {
+	client *grpcreflect.Client
+}
+
+// NewReflectSource returns a ReflectSource that talks to the reflection
+// service at baseURL.
+func NewReflectSource(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) *ReflectSource {
+	return &ReflectSource{
+		client: grpcreflect.NewClient(httpClient, baseURL, opts...),
+	}
+}
+
+// Load implements SchemaSource.
+func (s *ReflectSource) Load(ctx context.Context) (*Schema, error) {
+	// Create a new reflection stream.
+	stream := s.client.NewStream(ctx)
+	defer stream.Close()
+
+	names, err := stream.ListServices()
+	if err != nil {
+		return nil, fmt.Errorf("could not list services: %w", err)
+	}
+
+	fdps := make([]*descriptorpb.FileDescriptorProto, 0)
+	for _, name := range names {
+		fileDescs, err := stream.FileContainingSymbol(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve service %q: %w", name, err)
+		}
+
+		fdps = append(fdps, fileDescs...)
+	}
+
+	// Every load starts from an empty registry so that descriptors changed
+	// upstream replace the previous ones.
+	files, err := newFilesFromProtos(fdps, stream.FileByFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{
+		Files: files,
+	}
+
+	for _, name := range names {
+		if err := schema.addService(string(name)); err != nil {
+			return nil, err
+		}
+	}
+
+	return dedupeServices(schema), nil
+}
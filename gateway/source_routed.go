@@ -0,0 +1,38 @@
+package gateway
+
+import (
+	"context"
+)
+
+var _ SchemaSource = (*routedSource)(nil)
+
+// routedSource routes every service of a source to an upstream.
+type routedSource struct {
+	source   SchemaSource
+	upstream *Upstream
+}
+
+// RouteSource returns a source routing the services loaded from source to
+// upstream, unless a route configured on the gateway says otherwise. It is
+// typically used with a source discovering services over reflection, whose
+// services must reach the backend they were discovered on.
+func RouteSource(source SchemaSource, upstream *Upstream) SchemaSource {
+	return &routedSource{
+		source:   source,
+		upstream: upstream,
+	}
+}
+
+// Load implements SchemaSource.
+func (s *routedSource) Load(ctx context.Context) (*Schema, error) {
+	schema, err := s.source.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, svc := range schema.Services {
+		schema.setUpstream(svc.FullName(), s.upstream)
+	}
+
+	return schema, nil
+}
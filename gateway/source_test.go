@@ -0,0 +1,184 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpcreflect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	userv1 "github.com/anhnmt/gprc-dynamic-proto/proto/gengo/user/v1"
+)
+
+// checkUserSchema checks a schema holds the user.v1 fixture in a registry of
+// its own.
+func checkUserSchema(t *testing.T, schema *Schema) {
+	t.Helper()
+
+	if got := schema.ServiceNames(); !slices.Contains(got, "user.v1.UserService") {
+		t.Fatalf("services = %v", got)
+	}
+
+	if schema.Files == protoregistry.GlobalFiles {
+		t.Fatal("schema resolves from the global registry")
+	}
+
+	desc, err := schema.Files.FindDescriptorByName("user.v1.User")
+	if err != nil {
+		t.Fatalf("user.v1.User not resolved: %v", err)
+	}
+
+	if desc == (&userv1.User{}).ProtoReflect().Descriptor() {
+		t.Error("user.v1.User is the descriptor compiled into the binary")
+	}
+
+	for _, name := range []protoreflect.FullName{"google.api.http", "google.protobuf.Empty"} {
+		if _, err = schema.Files.FindDescriptorByName(name); err != nil {
+			t.Errorf("dependency %s not resolved: %v", name, err)
+		}
+	}
+}
+
+func TestParserSource(t *testing.T) {
+	schema, err := NewParserSource(testImportPaths, "user/v1/user.proto").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkUserSchema(t, schema)
+
+	if _, err = NewParserSource(testImportPaths, "user/v1/missing.proto").Load(context.Background()); err == nil {
+		t.Error("missing file loaded")
+	}
+}
+
+func TestCompilerSource(t *testing.T) {
+	schema, err := NewCompilerSource(testImportPaths, "user/v1/user.proto").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkUserSchema(t, schema)
+
+	parsed, err := NewParserSource(testImportPaths, "user/v1/user.proto").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if schema.Hash() != parsed.Hash() {
+		t.Error("the compiler and parser sources load different schemas")
+	}
+}
+
+func TestReflectSource(t *testing.T) {
+	upstream := newUserUpstream(t)
+
+	schema, err := NewReflectSource(h2cClient(), upstream.String(), connect.WithGRPC()).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkUserSchema(t, schema)
+}
+
+func TestGRPCReflectSource(t *testing.T) {
+	upstream := newUserUpstream(t)
+
+	conn, err := grpc.NewClient(upstream.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	schema, err := NewGRPCReflectSource(conn).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkUserSchema(t, schema)
+
+	schema, err = DialGRPCReflectSource(upstream.Host, grpc.WithTransportCredentials(insecure.NewCredentials())).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkUserSchema(t, schema)
+}
+
+// pairProto declares two services in the same file.
+const pairProto = `
+syntax = "proto3";
+
+package pair.v1;
+
+service PublicService {
+  rpc Get(Message) returns (Message);
+}
+
+service InternalService {
+  rpc Get(Message) returns (Message);
+}
+
+message Message {}
+`
+
+// advertised implements grpcreflect.Namer.
+type advertised []string
+
+func (a advertised) Names() []string {
+	return a
+}
+
+func TestReflectSourcesOnlyAdvertisedServices(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "pair", "v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "pair", "v1", "pair.proto"), []byte(pairProto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := NewParserSource([]string{dir}, "pair/v1/pair.proto").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server only advertises one of the services of the file.
+	reflector := grpcreflect.NewReflector(
+		advertised{"pair.v1.PublicService"},
+		grpcreflect.WithDescriptorResolver(pair.Files),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle(grpcreflect.NewHandlerV1(reflector))
+	upstream := newUpstream(t, mux)
+
+	conn, err := grpc.NewClient(upstream.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for name, source := range map[string]SchemaSource{
+		"connect": NewReflectSource(h2cClient(), upstream.String(), connect.WithGRPC()),
+		"grpc":    NewGRPCReflectSource(conn),
+	} {
+		schema, err := source.Load(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if got := schema.ServiceNames(); !slices.Equal(got, []string{"pair.v1.PublicService"}) {
+			t.Errorf("%s: services = %v", name, got)
+		}
+	}
+}
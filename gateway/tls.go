@@ -0,0 +1,363 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/http2"
+)
+
+// tlsReloadInterval bounds how often certificate files are checked for
+// changes.
+const tlsReloadInterval = time.Second
+
+// ClientTLS configures TLS toward an upstream. Certificate files are
+// reloaded when they change on disk, so rotated certificates are picked up
+// by new connections without a restart.
+type ClientTLS struct {
+	// CAFile is a PEM bundle verifying the upstream certificate. The system
+	// roots are used when empty.
+	CAFile string
+	// CertFile and KeyFile hold the PEM client certificate and key presented
+	// for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name sent with SNI and verified against the
+	// upstream certificate, which defaults to the upstream host.
+	ServerName string
+}
+
+// NewClientTLSConfig returns the TLS configuration described by c.
+func NewClientTLSConfig(c ClientTLS) (*tls.Config, error) {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("a client certificate requires both a certificate and a key file")
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+		NextProtos: []string{http2.NextProtoTLS},
+	}
+
+	if c.CertFile != "" {
+		certs, err := newKeyPairReloader(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.get()
+		}
+	}
+
+	if c.CAFile != "" {
+		roots, err := newCertPoolReloader(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// The roots of tls.Config cannot change once in use, so the chain is
+		// verified against the current bundle instead. The name verified is
+		// ServerName, or the upstream host set by ClientTLSConfigForHost: the
+		// connection state has no name for hosts given by IP.
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			pool, err := roots.get()
+			if err != nil {
+				return err
+			}
+
+			name := c.ServerName
+			if name == "" {
+				name = cs.ServerName
+			}
+
+			if name == "" {
+				return errors.New("tls: no server name to verify the upstream certificate against")
+			}
+
+			return verifyPeer(cs, pool, x509.ExtKeyUsageServerAuth, name)
+		}
+	}
+
+	return config, nil
+}
+
+// ClientTLSConfigForHost returns a copy of a configuration returned by
+// NewClientTLSConfig for the connections to host, an upstream host name or
+// IP, whose certificate is verified against host unless ServerName is set.
+// NewTLSTransport applies it to every connection.
+func ClientTLSConfigForHost(config *tls.Config, host string) *tls.Config {
+	config = config.Clone()
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+
+	if verify := config.VerifyConnection; verify != nil {
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if cs.ServerName == "" {
+				cs.ServerName = host
+			}
+
+			return verify(cs)
+		}
+	}
+
+	return config
+}
+
+// Client certificate policies of ServerTLS.
+const (
+	// ClientAuthNone does not ask clients for a certificate.
+	ClientAuthNone = "none"
+	// ClientAuthOptional verifies the certificate of the clients sending one.
+	ClientAuthOptional = "optional"
+	// ClientAuthRequire rejects clients without a valid certificate.
+	ClientAuthRequire = "require"
+)
+
+// ServerTLS configures TLS termination on a gateway listener. Certificate
+// files are reloaded when they change on disk.
+type ServerTLS struct {
+	// CertFile and KeyFile hold the PEM certificate and key of the listener.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM bundle verifying client certificates.
+	ClientCAFile string
+	// ClientAuth is one of ClientAuthNone, ClientAuthOptional or
+	// ClientAuthRequire. It defaults to ClientAuthRequire when ClientCAFile
+	// is set and to ClientAuthNone otherwise.
+	ClientAuth string
+}
+
+// NewServerTLSConfig returns the TLS configuration described by c, which
+// negotiates h2 and http/1.1 with ALPN.
+func NewServerTLSConfig(c ServerTLS) (*tls.Config, error) {
+	certs, err := newKeyPairReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{http2.NextProtoTLS, "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certs.get()
+		},
+	}
+
+	clientAuth := c.ClientAuth
+	if clientAuth == "" {
+		clientAuth = ClientAuthNone
+		if c.ClientCAFile != "" {
+			clientAuth = ClientAuthRequire
+		}
+	}
+
+	switch clientAuth {
+	case ClientAuthNone:
+		return config, nil
+	case ClientAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth %q", clientAuth)
+	}
+
+	if c.ClientCAFile == "" {
+		return nil, fmt.Errorf("client auth %q requires a client CA file", clientAuth)
+	}
+
+	clientCAs, err := newCertPoolReloader(c.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every handshake gets the current client CA bundle.
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool, err := clientCAs.get()
+		if err != nil {
+			return nil, err
+		}
+
+		clone := config.Clone()
+		clone.GetConfigForClient = nil
+		clone.ClientCAs = pool
+
+		return clone, nil
+	}
+
+	return config, nil
+}
+
+// verifyPeer verifies the certificate chain of the peer against roots.
+func verifyPeer(cs tls.ConnectionState, roots *x509.CertPool, usage x509.ExtKeyUsage, name string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: peer presented no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       name,
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+
+	return err
+}
+
+// NewTLSTransport returns an HTTP/2 transport reaching the upstream over TLS,
+// verifying the certificate of every upstream against its host, see
+// ClientTLSConfigForHost.
+func NewTLSTransport(config *tls.Config) *http2.Transport {
+	return &http2.Transport{
+		TLSClientConfig: config,
+		DialTLSContext: func(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+
+			dialer := &tls.Dialer{
+				Config: ClientTLSConfigForHost(config, host),
+			}
+
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// fileReloader caches a value loaded from files, loading it again when one of
+// them changes. A failed reload keeps the previous value.
+type fileReloader[T any] struct {
+	paths []string
+	load  func() (T, error)
+
+	mu      sync.Mutex
+	value   T
+	stamps  []fileStamp
+	checked time.Time
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newFileReloader[T any](load func() (T, error), paths ...string) (*fileReloader[T], error) {
+	r := &fileReloader[T]{
+		paths: paths,
+		load:  load,
+	}
+
+	stamps, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	r.value, r.stamps, r.checked = value, stamps, time.Now()
+
+	return r, nil
+}
+
+func (r *fileReloader[T]) stat() ([]fileStamp, error) {
+	stamps := make([]fileStamp, 0, len(r.paths))
+	for _, path := range r.paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		stamps = append(stamps, fileStamp{
+			modTime: fi.ModTime(),
+			size:    fi.Size(),
+		})
+	}
+
+	return stamps, nil
+}
+
+func (r *fileReloader[T]) get() (T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.checked) < tlsReloadInterval {
+		return r.value, nil
+	}
+
+	r.checked = now
+
+	stamps, err := r.stat()
+	if err != nil || sameStamps(stamps, r.stamps) {
+		return r.value, nil
+	}
+
+	value, err := r.load()
+	if err != nil {
+		// Files are often replaced one at a time, the next check retries.
+		log.Warn().Err(err).Strs("files", r.paths).Msg("could not reload certificates")
+		return r.value, nil
+	}
+
+	log.Info().Strs("files", r.paths).Msg("certificates reloaded")
+	r.value, r.stamps = value, stamps
+
+	return r.value, nil
+}
+
+func sameStamps(a, b []fileStamp) bool {
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newKeyPairReloader(certFile, keyFile string) (*fileReloader[*tls.Certificate], error) {
+	return newFileReloader(func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load key pair: %w", err)
+		}
+
+		return &cert, nil
+	}, certFile, keyFile)
+}
+
+func newCertPoolReloader(caFile string) (*fileReloader[*x509.CertPool], error) {
+	return newFileReloader(func() (*x509.CertPool, error) {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %q", caFile)
+		}
+
+		return pool, nil
+	}, caFile)
+}
@@ -0,0 +1,424 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// testCA issues certificates for the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a server certificate for the given DNS names and IPs.
+func (ca *testCA) issue(t *testing.T, dnsNames []string, ips ...net.IP) *tls.Certificate {
+	t.Helper()
+
+	return ca.sign(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "upstream"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	})
+}
+
+// issueClient returns a client certificate for name.
+func (ca *testCA) issueClient(t *testing.T, name string) *tls.Certificate {
+	t.Helper()
+
+	return ca.sign(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+// sign completes template with a new key and a validity period, and signs it.
+func (ca *testCA) sign(t *testing.T, template *x509.Certificate) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+}
+
+// newTLSUpstream serves h2 over TLS on 127.0.0.1 with the certificate cert
+// holds at every handshake, and returns its address.
+func newTLSUpstream(t *testing.T, cert *atomic.Pointer[tls.Certificate]) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{
+		// Rejected handshakes are expected.
+		ErrorLog: log.New(io.Discard, "", 0),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}),
+		TLSConfig: &tls.Config{
+			NextProtos: []string{http2.NextProtoTLS},
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return cert.Load(), nil
+			},
+		},
+	}
+
+	go func() {
+		_ = srv.ServeTLS(ln, "", "")
+	}()
+
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	return ln.Addr().String()
+}
+
+// get sends a request to addr over a new connection.
+func get(config *tls.Config, addr string) error {
+	transport := NewTLSTransport(config)
+	defer transport.CloseIdleConnections()
+
+	res, err := (&http.Client{Transport: transport}).Get("https://" + addr + "/")
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientTLSVerifiesUpstreamHost(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, caFile, ca.pem)
+
+	var cert atomic.Pointer[tls.Certificate]
+	addr := newTLSUpstream(t, &cert)
+
+	tests := []struct {
+		name       string
+		cert       *tls.Certificate
+		serverName string
+		ok         bool
+	}{
+		{
+			name: "ip",
+			cert: ca.issue(t, nil, net.IPv4(127, 0, 0, 1)),
+			ok:   true,
+		},
+		{
+			name: "ip mismatch",
+			cert: ca.issue(t, []string{"other.example"}, net.IPv4(10, 0, 0, 1)),
+		},
+		{
+			name:       "server name",
+			cert:       ca.issue(t, []string{"upstream.example"}),
+			serverName: "upstream.example",
+			ok:         true,
+		},
+		{
+			name:       "server name mismatch",
+			cert:       ca.issue(t, []string{"upstream.example"}),
+			serverName: "other.example",
+		},
+		{
+			name: "unknown authority",
+			cert: newTestCA(t, "other").issue(t, nil, net.IPv4(127, 0, 0, 1)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert.Store(tt.cert)
+
+			config, err := NewClientTLSConfig(ClientTLS{
+				CAFile:     caFile,
+				ServerName: tt.serverName,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = get(config, addr)
+			if tt.ok && err != nil {
+				t.Errorf("request failed: %v", err)
+			}
+
+			if !tt.ok && err == nil {
+				t.Errorf("request succeeded, the certificate must be rejected")
+			}
+		})
+	}
+}
+
+func TestClientTLSReloadsCABundle(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the certificate reload interval")
+	}
+
+	oldCA, newCA := newTestCA(t, "old"), newTestCA(t, "new")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, caFile, oldCA.pem)
+
+	var cert atomic.Pointer[tls.Certificate]
+	cert.Store(oldCA.issue(t, nil, net.IPv4(127, 0, 0, 1)))
+	addr := newTLSUpstream(t, &cert)
+
+	config, err := NewClientTLSConfig(ClientTLS{CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = get(config, addr); err != nil {
+		t.Fatalf("request with the first CA failed: %v", err)
+	}
+
+	// The upstream rotates to a certificate of the new CA, which the bundle
+	// does not hold yet.
+	cert.Store(newCA.issue(t, nil, net.IPv4(127, 0, 0, 1)))
+	if err = get(config, addr); err == nil {
+		t.Fatal("request succeeded with a certificate of a CA missing from the bundle")
+	}
+
+	writeFile(t, caFile, newCA.pem)
+	time.Sleep(tlsReloadInterval + 100*time.Millisecond)
+
+	if err = get(config, addr); err != nil {
+		t.Fatalf("request after the bundle rotation failed: %v", err)
+	}
+
+	// A certificate matching the new CA but not the upstream host is still
+	// rejected.
+	cert.Store(newCA.issue(t, []string{"other.example"}))
+	if err = get(config, addr); err == nil {
+		t.Fatal("request succeeded with a certificate for another host")
+	}
+}
+
+// writeKeyPair writes cert and its key as PEM files in dir and returns their
+// paths.
+func writeKeyPair(t *testing.T, dir string, cert *tls.Certificate) (string, string) {
+	t.Helper()
+
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}))
+
+	return certFile, keyFile
+}
+
+// newTLSGateway serves the user gateway over TLS with config and returns its
+// address.
+func newTLSGateway(t *testing.T, config *tls.Config) string {
+	t.Helper()
+
+	g, _ := newUserGateway(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := g.NewTLSServer("", config)
+	// Rejected handshakes are expected.
+	srv.ErrorLog = log.New(io.Discard, "", 0)
+
+	go func() {
+		_ = srv.ServeTLS(ln, "", "")
+	}()
+
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	return ln.Addr().String()
+}
+
+func TestServerTLS(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	certFile, keyFile := writeKeyPair(t, t.TempDir(), ca.issue(t, nil, net.IPv4(127, 0, 0, 1)))
+
+	config, err := NewServerTLSConfig(ServerTLS{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := newTLSGateway(t, config)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// HTTP/2, which gRPC requires, and HTTP/1.1 are negotiated with ALPN.
+	for proto, transport := range map[int]http.RoundTripper{
+		2: &http2.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		1: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+	} {
+		res, err := (&http.Client{Transport: transport}).Get("https://" + addr + "/v1/users/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK || res.ProtoMajor != proto {
+			t.Errorf("HTTP/%d status = %d, want HTTP/%d", res.ProtoMajor, res.StatusCode, proto)
+		}
+	}
+}
+
+func TestServerTLSClientAuth(t *testing.T) {
+	ca, clientCA := newTestCA(t, "ca"), newTestCA(t, "clients")
+
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, ca.issue(t, nil, net.IPv4(127, 0, 0, 1)))
+	clientCAFile := filepath.Join(dir, "clients.pem")
+	writeFile(t, clientCAFile, clientCA.pem)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	var (
+		trusted   = clientCA.issueClient(t, "client")
+		untrusted = newTestCA(t, "other").issueClient(t, "client")
+	)
+
+	tests := []struct {
+		clientAuth string
+		cert       *tls.Certificate
+		ok         bool
+	}{
+		{clientAuth: ClientAuthRequire, cert: trusted, ok: true},
+		{clientAuth: ClientAuthRequire},
+		{clientAuth: ClientAuthRequire, cert: untrusted},
+		{clientAuth: ClientAuthOptional, cert: trusted, ok: true},
+		{clientAuth: ClientAuthOptional, ok: true},
+		{clientAuth: ClientAuthOptional, cert: untrusted},
+		// ClientAuthRequire is the default with a client CA file.
+		{clientAuth: ""},
+	}
+
+	for _, tt := range tests {
+		config, err := NewServerTLSConfig(ServerTLS{
+			CertFile:     certFile,
+			KeyFile:      keyFile,
+			ClientCAFile: clientCAFile,
+			ClientAuth:   tt.clientAuth,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := newTLSGateway(t, config)
+
+		client := &tls.Config{RootCAs: roots}
+		if tt.cert != nil {
+			// Certificates would only be sent when issued by a CA the
+			// listener asks for.
+			cert := tt.cert
+			client.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return cert, nil
+			}
+		}
+
+		err = get(client, addr)
+		if tt.ok && err != nil {
+			t.Errorf("client auth %q, certificate %v: request failed: %v", tt.clientAuth, tt.cert != nil, err)
+		}
+
+		if !tt.ok && err == nil {
+			t.Errorf("client auth %q, certificate %v: request succeeded", tt.clientAuth, tt.cert != nil)
+		}
+	}
+
+	if _, err := NewServerTLSConfig(ServerTLS{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire}); err == nil {
+		t.Error("client auth without a client CA file accepted")
+	}
+
+	if _, err := NewServerTLSConfig(ServerTLS{CertFile: certFile, KeyFile: keyFile, ClientAuth: "always"}); err == nil {
+		t.Error("unknown client auth accepted")
+	}
+}
@@ -0,0 +1,261 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/codes"
+)
+
+// tracerName is the instrumentation scope of the spans of the gateway.
+const tracerName = "github.com/anhnmt/gprc-dynamic-proto/gateway"
+
+// Attributes of the spans of the gateway beyond the semantic conventions.
+const (
+	attrProtocol = attribute.Key("gateway.protocol")
+	attrUpstream = attribute.Key("gateway.upstream")
+)
+
+// propagator reads the trace context of incoming calls and writes it to the
+// upstream requests. W3C trace context wins over grpc-trace-bin when a call
+// carries both.
+var propagator = propagation.NewCompositeTextMapPropagator(
+	traceBinPropagator{},
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// startSpans starts the server span of the call along with its "transcode
+// request" child span, which covers the conversion of the request messages
+// until the proxy read the last of them, see traceTranscoding. Both start
+// when the gateway received the call since its method is only known once
+// routed.
+func (c *call) startSpans(ctx context.Context) context.Context {
+	service, method := string(c.method.Parent().FullName()), string(c.method.Name())
+
+	ctx, c.span = c.tracer.Start(ctx, service+"/"+method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithTimestamp(c.start),
+		trace.WithAttributes(
+			semconv.RPCSystemGRPC,
+			semconv.RPCService(service),
+			semconv.RPCMethod(method),
+			attrProtocol.String(c.protocol),
+		),
+	)
+
+	_, c.requestSpan = c.tracer.Start(ctx, "transcode request", trace.WithTimestamp(c.start))
+
+	return ctx
+}
+
+// traceTranscoding times the conversion of the messages of the call, next to
+// the client span of the upstream request. The "transcode request" span ends
+// once the proxy read the whole request body from the transcoder. The
+// "transcode response" span starts with the first bytes of the upstream
+// response written to the transcoder and ends once the transcoder wrote the
+// converted response to the client, see endSpan. ctx is the context of the
+// server span.
+func (c *call) traceTranscoding(ctx context.Context, w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if r.Body == nil || r.Body == http.NoBody {
+		c.requestSpan.End()
+	} else {
+		r.Body = &spanReader{ReadCloser: r.Body, span: c.requestSpan}
+	}
+
+	return &spanWriter{ResponseWriter: w, begin: func() {
+		_, c.responseSpan = c.tracer.Start(ctx, "transcode response")
+	}}
+}
+
+// endSpan ends the server span of the call with the status it completed
+// with.
+func (c *call) endSpan(code codes.Code) {
+	c.span.SetAttributes(
+		semconv.HTTPRequestMethodKey.String(c.httpMethod),
+		semconv.URLPath(c.path),
+		semconv.HTTPResponseStatusCode(c.recorder.status),
+		semconv.RPCGRPCStatusCodeKey.Int(int(code)),
+	)
+
+	if isServerError(code) {
+		c.span.SetStatus(otelcodes.Error, code.String())
+	}
+
+	// The request span is still running when the proxy gave up reading
+	// the request, ending it again does nothing.
+	c.requestSpan.End()
+	if c.responseSpan != nil {
+		c.responseSpan.End()
+	}
+
+	c.span.End()
+}
+
+// spanReader ends span once the request body is read or closed.
+type spanReader struct {
+	io.ReadCloser
+	span trace.Span
+}
+
+func (r *spanReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil {
+		r.span.End()
+	}
+
+	return n, err
+}
+
+func (r *spanReader) Close() error {
+	r.span.End()
+	return r.ReadCloser.Close()
+}
+
+// spanWriter calls begin once the response starts to be written.
+type spanWriter struct {
+	http.ResponseWriter
+	begin   func()
+	started bool
+}
+
+func (w *spanWriter) start() {
+	if !w.started {
+		w.started = true
+		w.begin()
+	}
+}
+
+func (w *spanWriter) WriteHeader(status int) {
+	w.start()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *spanWriter) Write(p []byte) (int, error) {
+	w.start()
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, which streaming responses rely on.
+func (w *spanWriter) Flush() {
+	w.start()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *spanWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// isServerError reports whether code marks a server span as failed, following
+// the semantic conventions of gRPC: the other codes are caused by the client.
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented,
+		codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+// startUpstreamSpan starts the client span of the request proxied to e and
+// writes its trace context to the request headers. Nothing is recorded for
+// calls without a server span.
+func startUpstreamSpan(r *http.Request, u *Upstream, e *Endpoint) (*http.Request, trace.Span) {
+	parent := trace.SpanFromContext(r.Context())
+	if !parent.SpanContext().IsValid() {
+		return r, noop.Span{}
+	}
+
+	// The path of the upstream request is always /package.Service/Method.
+	ctx, span := parent.TracerProvider().Tracer(tracerName).Start(r.Context(), r.URL.Path[1:],
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.RPCSystemGRPC,
+			semconv.ServerAddress(e.String()),
+			attrUpstream.String(u.Name),
+		),
+	)
+
+	r = r.WithContext(ctx)
+	r.Header = r.Header.Clone()
+	propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	return r, span
+}
+
+// traceBinHeader carries the trace context in the binary format of
+// OpenCensus, which gRPC servers instrumented with it still read.
+const traceBinHeader = "grpc-trace-bin"
+
+// traceBinPropagator propagates the trace context in traceBinHeader: a
+// version byte followed by the trace ID, span ID and trace options fields,
+// each prefixed with its field ID.
+type traceBinPropagator struct{}
+
+var _ propagation.TextMapPropagator = traceBinPropagator{}
+
+const traceBinLen = 29
+
+// Inject implements propagation.TextMapPropagator.
+func (traceBinPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	// The version and the trace ID field ID are zero.
+	var b [traceBinLen]byte
+	traceID, spanID := sc.TraceID(), sc.SpanID()
+
+	copy(b[2:18], traceID[:])
+	b[18] = 1
+	copy(b[19:27], spanID[:])
+	b[27] = 2
+	b[28] = byte(sc.TraceFlags() & trace.FlagsSampled)
+
+	// gRPC base64 encodes binary metadata.
+	carrier.Set(traceBinHeader, base64.RawStdEncoding.EncodeToString(b[:]))
+}
+
+// Extract implements propagation.TextMapPropagator.
+func (traceBinPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	value := carrier.Get(traceBinHeader)
+	if value == "" {
+		return ctx
+	}
+
+	b, err := decodeBinary(value)
+	if err != nil || len(b) < traceBinLen || b[0] != 0 || b[1] != 0 || b[18] != 1 || b[27] != 2 {
+		return ctx
+	}
+
+	var config trace.SpanContextConfig
+	copy(config.TraceID[:], b[2:18])
+	copy(config.SpanID[:], b[19:27])
+	config.TraceFlags = trace.TraceFlags(b[28]) & trace.FlagsSampled
+	config.Remote = true
+
+	sc := trace.NewSpanContext(config)
+	if !sc.IsValid() {
+		return ctx
+	}
+
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Fields implements propagation.TextMapPropagator.
+func (traceBinPropagator) Fields() []string {
+	return []string{traceBinHeader}
+}
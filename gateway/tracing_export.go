@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// Trace exporters supported by NewTracerProvider.
+const (
+	// TraceExporterOTLP sends spans to an OTLP collector over gRPC.
+	TraceExporterOTLP = "otlp"
+	// TraceExporterOTLPHTTP sends spans to an OTLP collector over HTTP.
+	TraceExporterOTLPHTTP = "otlp-http"
+	// TraceExporterStdout writes spans to the standard output.
+	TraceExporterStdout = "stdout"
+	// TraceExporterFile appends spans to a file.
+	TraceExporterFile = "file"
+)
+
+// DefaultTraceServiceName names the gateway in traces unless configured
+// otherwise or set with OTEL_SERVICE_NAME.
+const DefaultTraceServiceName = "grpc-dynamic-gateway"
+
+// TraceExport configures where the spans of NewTracerProvider are sent.
+type TraceExport struct {
+	// Exporter is one of the TraceExporter constants.
+	Exporter string
+	// Endpoint is the OTLP collector, a host:port or a URL. The
+	// OTEL_EXPORTER_OTLP_* environment variables apply when empty.
+	Endpoint string
+	// Insecure disables TLS towards Endpoint.
+	Insecure bool
+	// File is where TraceExporterFile writes.
+	File string
+	// SampleRatio is the ratio of the traces started by the gateway that are
+	// sampled. Calls carrying a trace context follow its sampling decision.
+	SampleRatio float64
+	// ServiceName defaults to DefaultTraceServiceName.
+	ServiceName string
+}
+
+// NewTracerProvider returns a tracer provider batching spans to the
+// configured exporter, to be passed to WithTracerProvider. Shutting it down
+// flushes the pending spans. Spans are written as one JSON object per line
+// by TraceExporterStdout and TraceExporterFile.
+func NewTracerProvider(ctx context.Context, export TraceExport) (*sdktrace.TracerProvider, error) {
+	exporter, err := newTraceExporter(ctx, export)
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s trace exporter: %w", export.Exporter, err)
+	}
+
+	serviceName := export.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultTraceServiceName
+	}
+
+	// The environment comes last so that it overrides the service name.
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create trace resource: %w", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(export.SampleRatio))),
+	), nil
+}
+
+func newTraceExporter(ctx context.Context, export TraceExport) (sdktrace.SpanExporter, error) {
+	isURL := strings.Contains(export.Endpoint, "://")
+
+	switch export.Exporter {
+	case TraceExporterOTLP:
+		var opts []otlptracegrpc.Option
+		switch {
+		case isURL:
+			opts = append(opts, otlptracegrpc.WithEndpointURL(export.Endpoint))
+		case export.Endpoint != "":
+			opts = append(opts, otlptracegrpc.WithEndpoint(export.Endpoint))
+		}
+
+		if export.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		return otlptracegrpc.New(ctx, opts...)
+	case TraceExporterOTLPHTTP:
+		var opts []otlptracehttp.Option
+		switch {
+		case isURL:
+			opts = append(opts, otlptracehttp.WithEndpointURL(export.Endpoint))
+		case export.Endpoint != "":
+			opts = append(opts, otlptracehttp.WithEndpoint(export.Endpoint))
+		}
+
+		if export.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		return otlptracehttp.New(ctx, opts...)
+	case TraceExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case TraceExporterFile:
+		f, err := os.OpenFile(export.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+
+		return &fileExporter{SpanExporter: exporter, file: f}, nil
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", export.Exporter)
+	}
+}
+
+// fileExporter closes the file spans are written to on shutdown.
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if cerr := e.file.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
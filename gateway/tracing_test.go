@@ -0,0 +1,250 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	userv1 "github.com/anhnmt/gprc-dynamic-proto/proto/gengo/user/v1"
+	"github.com/anhnmt/gprc-dynamic-proto/proto/gengo/user/v1/userv1connect"
+)
+
+// endedSpans waits until the spans named by keys, "name kind", have ended
+// and returns them by key.
+func endedSpans(t *testing.T, recorder *tracetest.SpanRecorder, keys ...string) map[string]sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+
+	// The server span ends once the handler returns, which may be after the
+	// client got the response.
+	eventually(t, "spans did not end", func() bool {
+		for _, span := range recorder.Ended() {
+			spans[span.Name()+" "+span.SpanKind().String()] = span
+		}
+
+		for _, key := range keys {
+			if spans[key] == nil {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	headers := make(chan http.Header, 1)
+	upstream := userUpstream()
+	_, addr := newTestGateway(t,
+		WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+		WithUpstream(newUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header.Clone()
+			upstream.ServeHTTP(w, r)
+		}))),
+		WithTracerProvider(tp),
+	)
+
+	// The call continues the trace of the client.
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	req := connect.NewRequest(&userv1.ListRequest{Page: 1})
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), parent), propagation.HeaderCarrier(req.Header()))
+
+	client := userv1connect.NewUserServiceClient(h2cClient(), addr, connect.WithGRPC())
+	if _, err := client.List(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := endedSpans(t, recorder, "user.v1.UserService/List server", "user.v1.UserService/List client")
+	server := spans["user.v1.UserService/List server"]
+	proxied := spans["user.v1.UserService/List client"]
+
+	if server.Parent().SpanID() != parent.SpanID() || server.SpanContext().TraceID() != parent.TraceID() {
+		t.Errorf("server span parent = %v", server.Parent())
+	}
+
+	if proxied.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("the client span is not a child of the server span")
+	}
+
+	if server.Status().Code == otelcodes.Error {
+		t.Errorf("server span status = %v", server.Status())
+	}
+
+	// The upstream request carries the client span in both formats.
+	header := <-headers
+	for _, p := range []propagation.TextMapPropagator{propagation.TraceContext{}, traceBinPropagator{}} {
+		sc := trace.SpanContextFromContext(p.Extract(context.Background(), propagation.HeaderCarrier(header)))
+		if sc.TraceID() != parent.TraceID() || sc.SpanID() != proxied.SpanContext().SpanID() {
+			t.Errorf("%T propagated %v", p, sc)
+		}
+	}
+}
+
+func TestTracingTranscoding(t *testing.T) {
+	const delay = 100 * time.Millisecond
+
+	recorder := tracetest.NewSpanRecorder()
+	upstream := userUpstream()
+	answered := make(chan time.Time, 1)
+	_, addr := newTestGateway(t,
+		WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+		WithUpstream(newUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			answered <- time.Now()
+			upstream.ServeHTTP(w, r)
+		}))),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+	)
+
+	// The client sends the JSON request slowly, the gateway converts it to
+	// protobuf for the upstream and converts the response back.
+	body, send := io.Pipe()
+	sent := make(chan time.Time, 1)
+	go func() {
+		_, _ = io.WriteString(send, `{"page":`)
+		time.Sleep(delay)
+		sent <- time.Now()
+		_, _ = io.WriteString(send, `1}`)
+		send.Close()
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, addr+"/user.v1.UserService/List", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+
+	spans := endedSpans(t, recorder,
+		"user.v1.UserService/List server",
+		"transcode request internal",
+		"user.v1.UserService/List client",
+		"transcode response internal",
+	)
+	server := spans["user.v1.UserService/List server"]
+	request := spans["transcode request internal"]
+	proxied := spans["user.v1.UserService/List client"]
+	response := spans["transcode response internal"]
+
+	for _, child := range []sdktrace.ReadOnlySpan{request, proxied, response} {
+		if child.Parent().SpanID() != server.SpanContext().SpanID() {
+			t.Errorf("span %s is not a child of the server span", child.Name())
+		}
+
+		if child.StartTime().Before(server.StartTime()) || child.EndTime().After(server.EndTime()) {
+			t.Errorf("span %s lasts from %v to %v, outside of the server span from %v to %v",
+				child.Name(), child.StartTime(), child.EndTime(), server.StartTime(), server.EndTime())
+		}
+	}
+
+	// The request is converted as it is received, the response once the
+	// upstream answered.
+	if last := <-sent; request.EndTime().Before(last) {
+		t.Errorf("request transcoded until %v, before the client sent it at %v", request.EndTime(), last)
+	}
+
+	if d := proxied.EndTime().Sub(proxied.StartTime()); d < delay {
+		t.Errorf("upstream request took %v, less than the upstream", d)
+	}
+
+	if first := <-answered; response.StartTime().Before(first) || response.StartTime().Before(request.EndTime()) {
+		t.Errorf("response transcoded from %v, before the upstream answered at %v", response.StartTime(), first)
+	}
+}
+
+func TestTracingServerErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream func(t *testing.T) Option
+		page     int32
+		failed   bool
+	}{
+		{
+			// Client errors do not fail the server span.
+			name:     "invalid argument",
+			upstream: func(t *testing.T) Option { return WithUpstream(newUserUpstream(t)) },
+			page:     -1,
+		},
+		{
+			name:     "unavailable",
+			upstream: func(t *testing.T) Option { return WithUpstream(closedURL(t)) },
+			failed:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			_, addr := newTestGateway(t,
+				WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+				tt.upstream(t),
+				WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+			)
+
+			client := userv1connect.NewUserServiceClient(h2cClient(), addr, connect.WithGRPC())
+			if _, err := client.List(context.Background(), connect.NewRequest(&userv1.ListRequest{Page: tt.page})); err == nil {
+				t.Fatal("List succeeded")
+			}
+
+			server := endedSpans(t, recorder, "user.v1.UserService/List server")["user.v1.UserService/List server"]
+
+			if failed := server.Status().Code == otelcodes.Error; failed != tt.failed {
+				t.Errorf("server span status = %v", server.Status())
+			}
+		})
+	}
+}
+
+func TestTraceBinPropagator(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0xa, 0xb},
+		SpanID:     trace.SpanID{0xc},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	header := make(http.Header)
+	traceBinPropagator{}.Inject(trace.ContextWithSpanContext(context.Background(), sc), propagation.HeaderCarrier(header))
+
+	got := trace.SpanContextFromContext(traceBinPropagator{}.Extract(context.Background(), propagation.HeaderCarrier(header)))
+	if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() || !got.IsSampled() || !got.IsRemote() {
+		t.Errorf("extracted %v from %q", got, header.Get(traceBinHeader))
+	}
+
+	for _, value := range []string{"", "not base64!", "AAAA"} {
+		header.Set(traceBinHeader, value)
+		if sc := trace.SpanContextFromContext(traceBinPropagator{}.Extract(context.Background(), propagation.HeaderCarrier(header))); sc.IsValid() {
+			t.Errorf("extracted %v from %q", sc, value)
+		}
+	}
+}
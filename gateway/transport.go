@@ -0,0 +1,23 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"golang.org/x/net/http2"
+)
+
+// NewH2CTransport returns an HTTP/2 transport that speaks cleartext h2c to
+// the upstream, which is what gRPC servers without TLS expect.
+func NewH2CTransport() *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			// If you're also using this client for non-h2c traffic, you may want
+			// to delegate to tls.Dial if the network isn't TCP or the addr isn't
+			// in an allowlist.
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+// UnixScheme is the scheme of Unix domain socket addresses, such as
+// unix:///run/app.sock.
+const UnixScheme = "unix"
+
+// unixSocketPath returns the socket path of a unix:// URL.
+func unixSocketPath(u *url.URL) (string, bool) {
+	if u.Scheme != UnixScheme {
+		return "", false
+	}
+
+	// unix:///run/app.sock has an empty host, unix://run/app.sock does not
+	// but is still commonly written for relative paths.
+	return u.Host + u.Path, true
+}
+
+// unixBaseURL is the base URL of the requests sent over a Unix socket,
+// whose authority the upstream server usually ignores.
+var unixBaseURL = &url.URL{
+	Scheme: "http",
+	Host:   "localhost",
+}
+
+// NewUnixTransport returns an HTTP/2 transport that speaks cleartext h2c over
+// the Unix domain socket at path, whatever the host of the request.
+func NewUnixTransport(path string) *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, _, _ string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}
+}
+
+// NewClient returns an HTTP client and the base URL reaching the Target of
+// the upstream, or its first endpoint when Target is not set, resolving
+// unix:// targets to their socket. It serves the clients talking to the
+// upstream outside of the proxy, such as reflection clients. The client
+// speaks h2c when the upstream has no Transport.
+func (u *Upstream) NewClient() (*http.Client, string) {
+	target := u.Target
+	if target == nil && len(u.Endpoints) > 0 {
+		target = u.Endpoints[0]
+	}
+
+	if target == nil {
+		target = &url.URL{}
+	}
+
+	if path, ok := unixSocketPath(target); ok {
+		return &http.Client{Transport: NewUnixTransport(path)}, unixBaseURL.String()
+	}
+
+	transport := u.Transport
+	if transport == nil {
+		transport = NewH2CTransport()
+	}
+
+	return &http.Client{Transport: transport}, target.String()
+}
+
+// Listen listens on addr, either a TCP host:port or a unix:// URL. A stale
+// socket file left by a previous process is removed first.
+func Listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, UnixScheme+"://") {
+		return net.Listen("tcp", addr)
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+
+	path, _ := unixSocketPath(u)
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+		// Only remove the socket when nothing is serving on it anymore.
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("socket %q is in use", path)
+		}
+
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("could not remove stale socket %q: %w", path, err)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
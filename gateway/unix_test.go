@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"connectrpc.com/connect"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// serveUnix serves handler over h2c on a new Unix socket and returns its
+// unix:// address.
+func serveUnix(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	addr := UnixScheme + "://" + filepath.Join(t.TempDir(), "s.sock")
+
+	ln, err := Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: h2c.NewHandler(handler, &http2.Server{})}
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	return addr
+}
+
+func TestUnixUpstream(t *testing.T) {
+	target, err := url.Parse(serveUnix(t, userUpstream()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, addr := newTestGateway(t,
+		WithSchemaSource(NewParserSource(testImportPaths, "user/v1/user.proto")),
+		WithUpstream(target),
+	)
+
+	res, err := http.Get(addr + "/v1/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status = %d", res.StatusCode)
+	}
+}
+
+func TestUnixListener(t *testing.T) {
+	g, _ := newUserGateway(t)
+
+	addr := serveUnix(t, g.NewServer("").Handler)
+	path := addr[len(UnixScheme+"://"):]
+
+	res, err := (&http.Client{Transport: NewUnixTransport(path)}).Get(unixBaseURL.String() + "/v1/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status = %d", res.StatusCode)
+	}
+
+	if _, err := Listen(addr); err == nil {
+		t.Error("socket in use listened on again")
+	}
+
+	// Sockets left by a process that is gone are replaced.
+	stale := UnixScheme + "://" + filepath.Join(t.TempDir(), "stale.sock")
+
+	ln, err := Listen(stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = Listen(stale)
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	ln.Close()
+}
+
+func TestUpstreamNewClient(t *testing.T) {
+	unixTarget, err := url.Parse(serveUnix(t, userUpstream()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		upstream *Upstream
+	}{
+		{name: "target", upstream: &Upstream{Target: newUserUpstream(t)}},
+		// Target is ignored, and may be unset, along with endpoints.
+		{name: "endpoints", upstream: &Upstream{Endpoints: []*url.URL{newUserUpstream(t), closedURL(t)}}},
+		{name: "unix", upstream: &Upstream{Target: unixTarget}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reflection only works over HTTP/2, the client must speak h2c.
+			httpClient, baseURL := tt.upstream.NewClient()
+
+			schema, err := NewReflectSource(httpClient, baseURL, connect.WithGRPC()).Load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkUserSchema(t, schema)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Upstream is a backend cluster requests are proxied to.
+type Upstream struct {
+	// Name identifies the upstream in logs and errors.
+	Name string
+	// Target is the base URL of the backend, or a unix:// URL for a Unix
+	// domain socket reached over h2c. It is ignored when Endpoints is set.
+	Target *url.URL
+	// Endpoints are the base URLs of the backends of the cluster, in the same
+	// form as Target. Requests are spread over them by Balancer.
+	Endpoints []*url.URL
+	// Balancer picks the endpoint of every request. It defaults to
+	// RoundRobin.
+	Balancer Balancer
+	// Transport is used to reach the backend. The gateway transport is used
+	// when nil.
+	Transport http.RoundTripper
+	// Timeout bounds every proxied request when positive.
+	Timeout time.Duration
+	// HealthCheck enables health checking of the endpoints when set.
+	HealthCheck *HealthCheck
+
+	// endpoints hold the state of the cluster. They are shared by every
+	// handler built for the upstream so that it survives reloads.
+	endpointsOnce sync.Once
+	endpoints     []*Endpoint
+}
+
+// Endpoint is a backend of an upstream cluster.
+type Endpoint struct {
+	// URL is the base URL of the backend.
+	URL *url.URL
+
+	// target and transport replace those of the upstream for Unix sockets.
+	target      *url.URL
+	transport   http.RoundTripper
+	outstanding atomic.Int64
+	health      endpointHealth
+	// reached is set once the endpoint answered a request or a probe.
+	reached atomic.Bool
+}
+
+// String returns the address of the endpoint, as used in logs and metrics.
+func (e *Endpoint) String() string {
+	if path, ok := unixSocketPath(e.URL); ok {
+		return UnixScheme + "://" + path
+	}
+
+	return e.URL.Host
+}
+
+// roundTripper returns the transport reaching the endpoint.
+func (e *Endpoint) roundTripper(transport http.RoundTripper) http.RoundTripper {
+	if e.transport != nil {
+		return e.transport
+	}
+
+	return transport
+}
+
+// Outstanding returns the number of requests being proxied to the endpoint.
+func (e *Endpoint) Outstanding() int64 {
+	return e.outstanding.Load()
+}
+
+// cluster returns the endpoints of the upstream.
+func (u *Upstream) cluster() []*Endpoint {
+	u.endpointsOnce.Do(func() {
+		targets := u.Endpoints
+		if len(targets) == 0 && u.Target != nil {
+			targets = []*url.URL{u.Target}
+		}
+
+		for _, target := range targets {
+			e := &Endpoint{
+				URL:    target,
+				target: target,
+			}
+
+			if path, ok := unixSocketPath(target); ok {
+				e.target = unixBaseURL
+				e.transport = NewUnixTransport(path)
+			}
+
+			u.endpoints = append(u.endpoints, e)
+		}
+	})
+
+	return u.endpoints
+}
+
+// errNoEndpoint reports a request that no endpoint of its upstream could
+// take.
+var errNoEndpoint = errors.New("no upstream endpoint available")
+
+// proxyErrors writes the errors of the proxy in the protocol of the request.
+var proxyErrors = connect.NewErrorWriter()
+
+// writeUnavailable fails a proxied request with Unavailable, which the
+// transcoder understands whatever the protocol of the client.
+func writeUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	_ = proxyErrors.Write(w, r, connect.NewError(connect.CodeUnavailable, err))
+}
+
+// newProxy returns the handler forwarding requests to the upstream.
+func (u *Upstream) newProxy(transport http.RoundTripper, m *gatewayMetrics) http.Handler {
+	if u.Transport != nil {
+		transport = u.Transport
+	}
+
+	balancer := u.Balancer
+	if balancer == nil {
+		balancer = RoundRobin()
+	}
+
+	endpoints := u.cluster()
+	proxies := make(map[*Endpoint]http.Handler, len(endpoints))
+	for _, e := range endpoints {
+		if u.HealthCheck != nil {
+			m.endpointHealth(u, e, e.Healthy())
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(e.target)
+		proxy.Transport = e.roundTripper(transport)
+		proxy.ModifyResponse = func(res *http.Response) error {
+			trace.SpanFromContext(res.Request.Context()).SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+
+			// Gateway errors from an intermediary count as failures, any
+			// other response shows the endpoint is serving.
+			switch res.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				e.reportFailure(u, m, fmt.Errorf("%w: %s", errUpstreamStatus, res.Status))
+			default:
+				e.reportSuccess(u, m)
+			}
+
+			return nil
+		}
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			// Requests canceled by the client say nothing of the endpoint.
+			if r.Context().Err() == nil {
+				e.reportFailure(u, m, err)
+				m.upstreamFailed(u, e)
+			}
+
+			span := trace.SpanFromContext(r.Context())
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+
+			log.Debug().Err(err).Str("upstream", u.Name).Str("endpoint", e.String()).Msg("proxy error")
+			writeUnavailable(w, r, fmt.Errorf("upstream %s unavailable", u.Name))
+		}
+		proxies[e] = proxy
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := balancer.Pick(r, u.available(m))
+		if e == nil {
+			writeUnavailable(w, r, errNoEndpoint)
+			return
+		}
+
+		e.outstanding.Add(1)
+		defer e.outstanding.Add(-1)
+
+		if u.Timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), u.Timeout)
+			defer cancel()
+
+			r = r.WithContext(ctx)
+		}
+
+		r, span := startUpstreamSpan(r, u, e)
+		defer span.End()
+
+		r = r.WithContext(httptrace.WithClientTrace(r.Context(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if !info.Reused {
+					m.upstreamConnected(u, e)
+				}
+			},
+		}))
+
+		proxies[e].ServeHTTP(w, r)
+	})
+}
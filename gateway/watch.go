@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// watchDebounce groups bursts of file events, such as an editor saving
+// several files or a checkout, into a single reload.
+const watchDebounce = 250 * time.Millisecond
+
+// Watch reloads the gateway whenever a .proto file below one of dirs is
+// created, modified, renamed or removed. It blocks until ctx is done. Failed
+// reloads are logged and the previous schema keeps being served.
+func (g *Gateway) Watch(ctx context.Context, dirs ...string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("could not create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	for _, dir := range dirs {
+		if err = addRecursive(watcher, dir); err != nil {
+			return err
+		}
+	}
+
+	log.Info().Strs("dirs", dirs).Msg("watching proto files")
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			log.Err(err).Msg("proto watcher error")
+		case event := <-watcher.Events:
+			// fsnotify is not recursive, directories created later are
+			// added as they appear.
+			if event.Has(fsnotify.Create) {
+				if err := addRecursive(watcher, event.Name); err != nil {
+					log.Err(err).Str("path", event.Name).Msg("could not watch directory")
+				}
+			}
+
+			if !strings.HasSuffix(event.Name, ".proto") || event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			log.Debug().Str("path", event.Name).Str("op", event.Op.String()).Msg("proto file changed")
+			timer.Reset(watchDebounce)
+		case <-timer.C:
+			if err := g.Reload(ctx); err != nil {
+				log.Err(err).Msg("could not reload schema, keeping the previous one")
+			}
+		}
+	}
+}
+
+// addRecursive watches dir and all of its subdirectories. Paths that are not
+// directories are ignored.
+func addRecursive(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files such as editor backups may vanish before being walked.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if err = watcher.Add(path); err != nil {
+			return fmt.Errorf("could not watch %q: %w", path, err)
+		}
+
+		return nil
+	})
+}
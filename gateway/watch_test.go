@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const echoProto = `
+syntax = "proto3";
+
+package echo.v1;
+
+service EchoService {
+  rpc Echo(EchoRequest) returns (EchoRequest);
+  // METHODS
+}
+
+message EchoRequest {
+  string text = 1;
+}
+`
+
+// withMethod returns echoProto with another method named name.
+func withMethod(name string) string {
+	return strings.Replace(echoProto, "// METHODS", "rpc "+name+"(EchoRequest) returns (EchoRequest);", 1)
+}
+
+// methodNames returns the methods of the first service of a schema.
+func methodNames(schema *Schema) []string {
+	methods := schema.Services[0].Methods()
+
+	names := make([]string, 0, methods.Len())
+	for i := 0; i < methods.Len(); i++ {
+		names = append(names, string(methods.Get(i).Name()))
+	}
+
+	return names
+}
+
+// newEchoGateway serves echo/v1/echo.proto from a temporary import path,
+// returned along with the gateway.
+func newEchoGateway(t *testing.T, opts ...Option) (*Gateway, string) {
+	t.Helper()
+
+	importPaths := writeProto(t, "echo/v1/echo.proto", echoProto)
+	g, err := New(context.Background(), append([]Option{
+		WithSchemaSource(NewParserSource(importPaths, "echo/v1/echo.proto")),
+		WithUpstream(&url.URL{Scheme: "http", Host: "localhost"}),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return g, importPaths[0]
+}
+
+func TestReload(t *testing.T) {
+	g, dir := newEchoGateway(t)
+	path := filepath.Join(dir, "echo", "v1", "echo.proto")
+
+	st := g.state.Load()
+	if err := g.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.state.Load() != st {
+		t.Error("unchanged schema swapped")
+	}
+
+	writeFile(t, path, []byte(withMethod("Shout")))
+	if err := g.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := methodNames(g.Schema()); len(got) != 2 || got[1] != "Shout" {
+		t.Errorf("methods after reload = %v", got)
+	}
+
+	select {
+	case <-st.replaced:
+	default:
+		t.Error("previous state not marked replaced")
+	}
+
+	// A broken file keeps the previous schema.
+	writeFile(t, path, []byte("syntax = \"proto3\";\nmessage {"))
+	if err := g.Reload(context.Background()); err == nil {
+		t.Fatal("broken schema loaded")
+	}
+
+	if got := methodNames(g.Schema()); len(got) != 2 {
+		t.Errorf("methods after a failed reload = %v", got)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	g, dir := newEchoGateway(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Watch(ctx, dir)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Watch = %v", err)
+		}
+	})
+
+	// The file is written until the reload, the watcher may not be ready
+	// for the first writes.
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		writeFile(t, filepath.Join(dir, "echo", "v1", "echo.proto"), []byte(withMethod("Shout")))
+		time.Sleep(2 * watchDebounce)
+
+		if len(methodNames(g.Schema())) == 2 {
+			return
+		}
+	}
+
+	t.Fatalf("schema not reloaded, methods = %v", methodNames(g.Schema()))
+}